@@ -0,0 +1,210 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package appcheck contains functions for verifying Firebase App Check tokens.
+package appcheck
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/transport"
+
+	"firebase.google.com/go/auth"
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+const jwksURL = "https://firebaseappcheck.googleapis.com/v1/jwks"
+const appCheckIssuer = "https://firebaseappcheck.googleapis.com/"
+
+// DecodedAppCheckToken represents a verified App Check token.
+//
+// Subject and AppID both contain the ID of the Firebase app to which the token was issued. Any
+// additional JWT claims can be accessed via the Claims map.
+type DecodedAppCheckToken struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	AppID     string
+	Claims    map[string]interface{}
+}
+
+// Client is the interface for the Firebase App Check service.
+type Client struct {
+	ks        auth.KeySource
+	projectID string
+	clock     func() time.Time
+}
+
+// NewClient creates a new instance of the Firebase App Check Client.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// the App Check service through firebase.App.
+func NewClient(ctx context.Context, c *internal.AppCheckConfig) (*Client, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project id is required to access app check client")
+	}
+
+	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		ks:        auth.NewJWKSKeySource(jwksURL, hc),
+		projectID: c.ProjectID,
+		clock:     time.Now,
+	}, nil
+}
+
+// VerifyToken verifies the signature and the payload of the provided App Check token.
+//
+// VerifyToken accepts a signed JWT issued by the Firebase App Check service, and verifies that
+// it has been signed by one of the keys published at the App Check JWKS endpoint. It also
+// verifies that the token was issued to the project the SDK is configured with, and that it
+// has not expired. The issuer of the token must be the App Check service of the project, which
+// is identified in the issuer by the project number that also appears in the audience. If the
+// token is valid, VerifyToken returns the decoded claims.
+func (c *Client) VerifyToken(token string) (*DecodedAppCheckToken, error) {
+	if token == "" {
+		return nil, errors.New("app check token must be a non-empty string")
+	}
+	s := strings.Split(token, ".")
+	if len(s) != 3 {
+		return nil, errors.New("incorrect number of segments")
+	}
+
+	var h struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decode(s[0], &h); err != nil {
+		return nil, err
+	}
+	var p struct {
+		Issuer    string   `json:"iss"`
+		Subject   string   `json:"sub"`
+		Audience  audience `json:"aud"`
+		ExpiresAt int64    `json:"exp"`
+		IssuedAt  int64    `json:"iat"`
+	}
+	if err := decode(s[1], &p); err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{})
+	if err := decode(s[1], &claims); err != nil {
+		return nil, err
+	}
+
+	projectResource := "projects/" + c.projectID
+	now := c.clock().Unix()
+	var err error
+	if h.KeyID == "" {
+		err = errors.New("app check token has no 'kid' header")
+	} else if h.Algorithm != "RS256" {
+		err = fmt.Errorf("app check token has invalid algorithm. Expected 'RS256' but got %q", h.Algorithm)
+	} else if h.Type != "JWT" {
+		err = fmt.Errorf("app check token has invalid type. Expected 'JWT' but got %q", h.Type)
+	} else if !p.Audience.contains(projectResource) {
+		err = fmt.Errorf("app check token has invalid 'aud' (audience) claim. Expected %q in %q",
+			projectResource, []string(p.Audience))
+	} else if !p.Audience.hasIssuer(p.Issuer) {
+		err = fmt.Errorf("app check token has invalid 'iss' (issuer) claim. Expected %q followed by "+
+			"the project number in 'aud' but got %q", appCheckIssuer, p.Issuer)
+	} else if p.IssuedAt > now {
+		err = fmt.Errorf("app check token issued at future timestamp: %d", p.IssuedAt)
+	} else if p.ExpiresAt < now {
+		err = fmt.Errorf("app check token has expired. Expired at: %d", p.ExpiresAt)
+	} else if p.Subject == "" {
+		err = errors.New("app check token has empty 'sub' (subject) claim")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := auth.VerifySignature(context.Background(), token, c.ks); err != nil {
+		return nil, err
+	}
+
+	for _, r := range []string{"iss", "sub", "aud", "exp", "iat"} {
+		delete(claims, r)
+	}
+	return &DecodedAppCheckToken{
+		Issuer:    p.Issuer,
+		Subject:   p.Subject,
+		Audience:  p.Audience,
+		ExpiresAt: time.Unix(p.ExpiresAt, 0),
+		IssuedAt:  time.Unix(p.IssuedAt, 0),
+		AppID:     p.Subject,
+		Claims:    claims,
+	}, nil
+}
+
+// audience is the 'aud' claim of a JWT, which may either be a single string or an array of
+// strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*a = audience(l)
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIssuer reports whether iss is the App Check issuer of a project whose number is in the
+// audience.
+func (a audience) hasIssuer(iss string) bool {
+	if !strings.HasPrefix(iss, appCheckIssuer) {
+		return false
+	}
+	number := strings.TrimPrefix(iss, appCheckIssuer)
+	if number == "" || strings.Trim(number, "0123456789") != "" {
+		return false
+	}
+	return a.contains("projects/" + number)
+}
+
+func decode(s string, i interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(bytes.NewBuffer(decoded)).Decode(i)
+}
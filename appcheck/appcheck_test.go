@@ -0,0 +1,363 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appcheck
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/auth"
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+const testProjectID = "test-project"
+const testIssuer = appCheckIssuer + "12345678"
+
+// testNow is the current time of testClient, so that tests do not depend on the wall clock.
+var testNow = time.Unix(1500000000, 0)
+
+var testKey *rsa.PrivateKey
+var testClient *Client
+
+func TestMain(m *testing.M) {
+	var err error
+	testKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	conf := &internal.AppCheckConfig{
+		ProjectID: testProjectID,
+		Opts: []option.ClientOption{
+			option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}),
+		},
+	}
+	testClient, err = NewClient(context.Background(), conf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	testClient.ks = auth.NewStaticKeySource(&auth.PublicKey{Kid: "key1", Key: &testKey.PublicKey})
+	testClient.clock = func() time.Time { return testNow }
+	os.Exit(m.Run())
+}
+
+func TestNoProjectID(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.AppCheckConfig{})
+	if client != nil || err == nil {
+		t.Errorf("NewClient() = (%v, %v); want = (nil, error)", client, err)
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	now := testNow.Unix()
+	token := signToken(t, nil, map[string]interface{}{
+		"iss":    testIssuer,
+		"sub":    "1:12345678:android:abc",
+		"aud":    []string{"projects/12345678", "projects/" + testProjectID},
+		"iat":    now - 10,
+		"exp":    now + 3600,
+		"custom": "value",
+	})
+
+	decoded, err := testClient.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DecodedAppCheckToken{
+		Issuer:    testIssuer,
+		Subject:   "1:12345678:android:abc",
+		Audience:  []string{"projects/12345678", "projects/" + testProjectID},
+		ExpiresAt: time.Unix(now+3600, 0),
+		IssuedAt:  time.Unix(now-10, 0),
+		AppID:     "1:12345678:android:abc",
+		Claims:    map[string]interface{}{"custom": "value"},
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("VerifyToken() = %#v; want = %#v", decoded, want)
+	}
+}
+
+func TestAudience(t *testing.T) {
+	cases := []struct {
+		json string
+		want audience
+	}{
+		{`"projects/test-project"`, audience{"projects/test-project"}},
+		{`["projects/12345678", "projects/test-project"]`, audience{"projects/12345678", "projects/test-project"}},
+	}
+	for _, tc := range cases {
+		var a audience
+		if err := json.Unmarshal([]byte(tc.json), &a); err != nil || !reflect.DeepEqual(a, tc.want) {
+			t.Errorf("Unmarshal(%s) = (%v, %v); want = (%v, nil)", tc.json, a, err, tc.want)
+		}
+	}
+}
+
+func TestVerifyTokenInvalid(t *testing.T) {
+	now := testNow.Unix()
+	validPayload := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": testIssuer,
+			"sub": "app",
+			"aud": []string{"projects/12345678", "projects/" + testProjectID},
+			"iat": now,
+			"exp": now + 3600,
+		}
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		header  map[string]interface{}
+		payload func(p map[string]interface{})
+		key     *rsa.PrivateKey
+		want    string
+	}{
+		{
+			name:   "NoKid",
+			header: map[string]interface{}{"alg": "RS256", "typ": "JWT"},
+			want:   "app check token has no 'kid' header",
+		},
+		{
+			name:   "WrongAlgorithm",
+			header: map[string]interface{}{"alg": "HS256", "typ": "JWT", "kid": "key1"},
+			want:   "app check token has invalid algorithm",
+		},
+		{
+			name:   "WrongType",
+			header: map[string]interface{}{"alg": "RS256", "typ": "JOSE", "kid": "key1"},
+			want:   "app check token has invalid type",
+		},
+		{
+			name:    "WrongAudience",
+			payload: func(p map[string]interface{}) { p["aud"] = []string{"projects/other-project"} },
+			want:    "app check token has invalid 'aud' (audience) claim",
+		},
+		{
+			name:    "WrongIssuer",
+			payload: func(p map[string]interface{}) { p["iss"] = "https://securetoken.google.com/test-project" },
+			want:    "app check token has invalid 'iss' (issuer) claim",
+		},
+		{
+			name:    "OtherProjectIssuer",
+			payload: func(p map[string]interface{}) { p["iss"] = appCheckIssuer + "87654321" },
+			want:    "app check token has invalid 'iss' (issuer) claim",
+		},
+		{
+			name:    "NoProjectNumberIssuer",
+			payload: func(p map[string]interface{}) { p["iss"] = appCheckIssuer },
+			want:    "app check token has invalid 'iss' (issuer) claim",
+		},
+		{
+			name:    "ProjectIDIssuer",
+			payload: func(p map[string]interface{}) { p["iss"] = appCheckIssuer + testProjectID },
+			want:    "app check token has invalid 'iss' (issuer) claim",
+		},
+		{
+			name:    "SingleAudience",
+			payload: func(p map[string]interface{}) { p["aud"] = "projects/" + testProjectID },
+			want:    "app check token has invalid 'iss' (issuer) claim",
+		},
+		{
+			name:    "FutureIssuedAt",
+			payload: func(p map[string]interface{}) { p["iat"] = now + 1000 },
+			want:    "app check token issued at future timestamp",
+		},
+		{
+			name:    "Expired",
+			payload: func(p map[string]interface{}) { p["exp"] = now - 1 },
+			want:    "app check token has expired",
+		},
+		{
+			name:    "EmptySubject",
+			payload: func(p map[string]interface{}) { delete(p, "sub") },
+			want:    "app check token has empty 'sub' (subject) claim",
+		},
+		{
+			name: "WrongSignature",
+			key:  otherKey,
+			want: "failed to verify token signature",
+		},
+		{
+			name:   "UnknownKid",
+			header: map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": "key2"},
+			want:   "failed to verify token signature",
+		},
+	}
+	for _, tc := range cases {
+		p := validPayload()
+		if tc.payload != nil {
+			tc.payload(p)
+		}
+		key := testKey
+		if tc.key != nil {
+			key = tc.key
+		}
+		token := signTokenWithKey(t, key, tc.header, p)
+		decoded, err := testClient.VerifyToken(token)
+		if decoded != nil || err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("VerifyToken(%s) = (%v, %v); want = (nil, %q)", tc.name, decoded, err, tc.want)
+		}
+	}
+}
+
+func TestVerifyTokenClock(t *testing.T) {
+	now := testNow.Unix()
+	token := signToken(t, nil, map[string]interface{}{
+		"iss": testIssuer,
+		"sub": "app",
+		"aud": []string{"projects/12345678", "projects/" + testProjectID},
+		"iat": now,
+		"exp": now + 3600,
+	})
+	client := *testClient
+	cases := []struct {
+		now   time.Time
+		valid bool
+	}{
+		{testNow.Add(-time.Second), false},
+		{testNow, true},
+		{testNow.Add(time.Hour), true},
+		{testNow.Add(time.Hour + time.Second), false},
+	}
+	for _, tc := range cases {
+		client.clock = func() time.Time { return tc.now }
+		decoded, err := client.VerifyToken(token)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("VerifyToken(%v) = (%v, %v); want valid = %v", tc.now, decoded, err, tc.valid)
+		}
+	}
+}
+
+func TestVerifyTokenWithJWKS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []interface{}{
+				jwk("key1", &testKey.PublicKey),
+				map[string]string{
+					"kty": "EC",
+					"kid": "ec-key",
+					"crv": "P-256",
+					"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+					"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+				},
+			},
+		})
+	}))
+	defer s.Close()
+
+	client := &Client{
+		ks:        auth.NewJWKSKeySource(s.URL, nil),
+		projectID: testProjectID,
+		clock:     testClient.clock,
+	}
+	now := testNow.Unix()
+	payload := map[string]interface{}{
+		"iss": testIssuer,
+		"sub": "app",
+		"aud": []string{"projects/12345678", "projects/" + testProjectID},
+		"iat": now,
+		"exp": now + 3600,
+	}
+	for i := 0; i < 2; i++ {
+		if decoded, err := client.VerifyToken(signToken(t, nil, payload)); err != nil || decoded.AppID != "app" {
+			t.Errorf("VerifyToken() = (%v, %v); want = (token, nil)", decoded, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("JWKS calls = %d; want = 1", calls)
+	}
+
+	// Keys that are not RSA keys are not used to verify App Check tokens.
+	header := map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": "ec-key"}
+	if decoded, err := client.VerifyToken(signToken(t, header, payload)); decoded != nil || err == nil {
+		t.Errorf("VerifyToken(ec-key) = (%v, %v); want = (nil, error)", decoded, err)
+	}
+}
+
+func TestVerifyTokenMalformed(t *testing.T) {
+	for _, token := range []string{"", "foo", "foo.bar", "foo.bar.baz", "a.b.c.d"} {
+		decoded, err := testClient.VerifyToken(token)
+		if decoded != nil || err == nil {
+			t.Errorf("VerifyToken(%q) = (%v, %v); want = (nil, error)", token, decoded, err)
+		}
+	}
+}
+
+func signToken(t *testing.T, header, payload map[string]interface{}) string {
+	return signTokenWithKey(t, testKey, header, payload)
+}
+
+func signTokenWithKey(t *testing.T, key *rsa.PrivateKey, header, payload map[string]interface{}) string {
+	if header == nil {
+		header = map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": "key1"}
+	}
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	ss := encode(header) + "." + encode(payload)
+	h := sha256.Sum256([]byte(ss))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ss + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// jwk returns the JSON Web Key representation of the given RSA public key.
+func jwk(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
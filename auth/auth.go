@@ -16,13 +16,11 @@
 package auth
 
 import (
-	"crypto/rsa"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"firebase.google.com/go/internal"
 	"golang.org/x/net/context"
@@ -32,6 +30,7 @@ import (
 
 const firebaseAudience = "https://identitytoolkit.googleapis.com/google.identity.identitytoolkit.v1.IdentityToolkit"
 const googleCertURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+const idToolkitV1Endpoint = "https://identitytoolkit.googleapis.com/v1"
 const issuerPrefix = "https://securetoken.google.com/"
 const tokenExpSeconds = 3600
 
@@ -46,15 +45,37 @@ var clk clock = &systemClock{}
 //
 // Token provides typed accessors to the common JWT fields such as Audience (aud) and Expiry (exp).
 // Additionally it provides a UID field, which indicates the user ID of the account to which this token
-// belongs. Any additional JWT claims can be accessed via the Claims map of Token.
+// belongs, and typed accessors to the user profile and sign-in information included by Firebase Auth.
+// Any additional JWT claims can be accessed via the Claims map of Token. For backwards compatibility,
+// the Claims map also contains the claims that have typed accessors.
 type Token struct {
-	Issuer   string                 `json:"iss"`
-	Audience string                 `json:"aud"`
-	Expires  int64                  `json:"exp"`
-	IssuedAt int64                  `json:"iat"`
-	Subject  string                 `json:"sub,omitempty"`
-	UID      string                 `json:"uid,omitempty"`
-	Claims   map[string]interface{} `json:"-"`
+	Issuer        string                 `json:"iss"`
+	Audience      string                 `json:"aud"`
+	Expires       int64                  `json:"exp"`
+	IssuedAt      int64                  `json:"iat"`
+	Subject       string                 `json:"sub,omitempty"`
+	UID           string                 `json:"uid,omitempty"`
+	AuthTime      int64                  `json:"auth_time"`
+	Email         string                 `json:"email"`
+	EmailVerified bool                   `json:"email_verified"`
+	Name          string                 `json:"name"`
+	Picture       string                 `json:"picture"`
+	PhoneNumber   string                 `json:"phone_number"`
+	Firebase      FirebaseInfo           `json:"firebase"`
+	Claims        map[string]interface{} `json:"-"`
+}
+
+// FirebaseInfo contains the Firebase-specific claims of an ID token.
+//
+// SignInProvider is the ID of the provider the user signed in with (e.g. "password" or
+// "google.com"), and SignInSecondFactor is the ID of the second factor the user signed in with,
+// if any. Identities maps provider IDs to the list of identifiers of the user at each provider.
+// Tenant is the ID of the tenant the user belongs to, if any.
+type FirebaseInfo struct {
+	SignInProvider     string                 `json:"sign_in_provider"`
+	SignInSecondFactor string                 `json:"sign_in_second_factor"`
+	Tenant             string                 `json:"tenant"`
+	Identities         map[string]interface{} `json:"identities"`
 }
 
 // Client is the interface for the Firebase auth service.
@@ -64,15 +85,13 @@ type Token struct {
 type Client struct {
 	hc        *internal.HTTPClient
 	is        *identitytoolkit.Service
-	ks        keySource
+	ks        KeySource
 	projectID string
-	snr       signer
+	snr       internal.Signer
 	version   string
-}
 
-type signer interface {
-	Email() (string, error)
-	Sign(b []byte) ([]byte, error)
+	// To enable testing against arbitrary endpoints.
+	idToolkitV1Endpoint string
 }
 
 // NewClient creates a new instance of the Firebase Auth Client.
@@ -80,39 +99,12 @@ type signer interface {
 // This function can only be invoked from within the SDK. Client applications should access the
 // the Auth service through firebase.App.
 func NewClient(ctx context.Context, c *internal.AuthConfig) (*Client, error) {
-	var (
-		err   error
-		email string
-		pk    *rsa.PrivateKey
-	)
-	if c.Creds != nil && len(c.Creds.JSON) > 0 {
-		var svcAcct struct {
-			ClientEmail string `json:"client_email"`
-			PrivateKey  string `json:"private_key"`
-		}
-		if err := json.Unmarshal(c.Creds.JSON, &svcAcct); err != nil {
-			return nil, err
-		}
-		if svcAcct.PrivateKey != "" {
-			pk, err = parseKey(svcAcct.PrivateKey)
-			if err != nil {
-				return nil, err
-			}
-		}
-		email = svcAcct.ClientEmail
-	}
-
-	var snr signer
-	if email != "" && pk != nil {
-		snr = serviceAcctSigner{email: email, pk: pk}
-	} else {
-		snr, err = newSigner(ctx)
-		if err != nil {
-			return nil, err
-		}
+	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
+	snr, err := internal.NewSigner(ctx, c.Creds, c.ServiceAccountID, hc)
 	if err != nil {
 		return nil, err
 	}
@@ -123,15 +115,25 @@ func NewClient(ctx context.Context, c *internal.AuthConfig) (*Client, error) {
 	}
 
 	return &Client{
-		hc:        &internal.HTTPClient{Client: hc},
-		is:        is,
-		ks:        newHTTPKeySource(googleCertURL, hc),
-		projectID: c.ProjectID,
-		snr:       snr,
-		version:   "Go/Admin/" + c.Version,
+		hc:                  &internal.HTTPClient{Client: hc, ErrParser: parseErrorResponse},
+		is:                  is,
+		ks:                  newHTTPKeySource(googleCertURL, hc),
+		projectID:           c.ProjectID,
+		snr:                 snr,
+		version:             "Go/Admin/" + c.Version,
+		idToolkitV1Endpoint: idToolkitV1Endpoint,
 	}, nil
 }
 
+// SetKeySource sets the KeySource used to obtain the public keys for verifying ID tokens.
+//
+// By default, ID tokens are verified using the public certificates published by Google. A custom
+// KeySource can be used to verify tokens issued by an emulator or a test setup. SetKeySource must
+// not be called concurrently with VerifyIDToken.
+func (c *Client) SetKeySource(ks KeySource) {
+	c.ks = ks
+}
+
 // CustomToken creates a signed custom authentication token with the specified user ID. The resulting
 // JWT can be used in a Firebase client SDK to trigger an authentication flow. See
 // https://firebase.google.com/docs/auth/admin/create-custom-tokens#sign_in_using_custom_tokens_on_clients
@@ -143,6 +145,58 @@ func (c *Client) CustomToken(uid string) (string, error) {
 // CustomTokenWithClaims is similar to CustomToken, but in addition to the user ID, it also encodes
 // all the key-value pairs in the provided map as claims in the resulting JWT.
 func (c *Client) CustomTokenWithClaims(uid string, devClaims map[string]interface{}) (string, error) {
+	if err := validateDeveloperClaimNames(devClaims); err != nil {
+		return "", err
+	}
+	return c.customToken(context.Background(), uid, devClaims, tokenExpSeconds*time.Second, "")
+}
+
+// CustomTokenOptions specifies the contents of a custom token.
+//
+// All fields are optional. Claims are encoded as developer claims in the resulting JWT, and
+// become available in the ID tokens of the user after sign-in. ExpiresIn is the lifetime of the
+// custom token, and must not exceed one hour, which is also the default. TenantID is the ID of
+// the tenant the user signs in to.
+type CustomTokenOptions struct {
+	Claims    map[string]interface{}
+	ExpiresIn time.Duration
+	TenantID  string
+}
+
+// CustomTokenWithOptions is similar to CustomToken, but creates a token with the contents
+// specified in opts.
+//
+// Unlike CustomTokenWithClaims, CustomTokenWithOptions rejects developer claims that would fail
+// the sign-in on the client, or would not be returned as they were set: claim values other than
+// nil, strings, booleans, numbers, []interface{} and map[string]interface{} holding such values,
+// and claims whose serialized size exceeds 1000 characters. If the token is signed remotely by
+// the IAM service, the signing request is bound to ctx. opts may be nil.
+func (c *Client) CustomTokenWithOptions(ctx context.Context, uid string, opts *CustomTokenOptions) (string, error) {
+	var o CustomTokenOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.ExpiresIn == 0 {
+		o.ExpiresIn = tokenExpSeconds * time.Second
+	} else if o.ExpiresIn < time.Second || o.ExpiresIn > tokenExpSeconds*time.Second {
+		return "", fmt.Errorf("custom token expiry must be between 1 second and %d seconds", tokenExpSeconds)
+	}
+	if len(o.TenantID) > 128 {
+		return "", errors.New("tenant id must not be longer than 128 characters")
+	}
+	if err := validateDeveloperClaimNames(o.Claims); err != nil {
+		return "", err
+	}
+	if err := validateDeveloperClaimValues(o.Claims); err != nil {
+		return "", err
+	}
+	return c.customToken(ctx, uid, o.Claims, o.ExpiresIn, o.TenantID)
+}
+
+func (c *Client) customToken(
+	ctx context.Context, uid string, devClaims map[string]interface{}, exp time.Duration, tenantID string) (string, error) {
+
 	iss, err := c.snr.Email()
 	if err != nil {
 		return "", err
@@ -152,6 +206,21 @@ func (c *Client) CustomTokenWithClaims(uid string, devClaims map[string]interfac
 		return "", errors.New("uid must be non-empty, and not longer than 128 characters")
 	}
 
+	now := clk.Now().Unix()
+	payload := &customToken{
+		Iss:      iss,
+		Sub:      iss,
+		Aud:      firebaseAudience,
+		UID:      uid,
+		Iat:      now,
+		Exp:      now + int64(exp/time.Second),
+		TenantID: tenantID,
+		Claims:   devClaims,
+	}
+	return encodeToken(ctx, c.snr, defaultHeader(), payload)
+}
+
+func validateDeveloperClaimNames(devClaims map[string]interface{}) error {
 	var disallowed []string
 	for _, k := range reservedClaims {
 		if _, contains := devClaims[k]; contains {
@@ -159,22 +228,65 @@ func (c *Client) CustomTokenWithClaims(uid string, devClaims map[string]interfac
 		}
 	}
 	if len(disallowed) == 1 {
-		return "", fmt.Errorf("developer claim %q is reserved and cannot be specified", disallowed[0])
+		return fmt.Errorf("developer claim %q is reserved and cannot be specified", disallowed[0])
 	} else if len(disallowed) > 1 {
-		return "", fmt.Errorf("developer claims %q are reserved and cannot be specified", strings.Join(disallowed, ", "))
+		return fmt.Errorf("developer claims %q are reserved and cannot be specified", strings.Join(disallowed, ", "))
 	}
+	return nil
+}
 
-	now := clk.Now().Unix()
-	payload := &customToken{
-		Iss:    iss,
-		Sub:    iss,
-		Aud:    firebaseAudience,
-		UID:    uid,
-		Iat:    now,
-		Exp:    now + tokenExpSeconds,
-		Claims: devClaims,
-	}
-	return encodeToken(c.snr, defaultHeader(), payload)
+func validateDeveloperClaimValues(devClaims map[string]interface{}) error {
+	if len(devClaims) == 0 {
+		return nil
+	}
+	if err := validateDeveloperClaimTypes(devClaims); err != nil {
+		return err
+	}
+	b, err := json.Marshal(devClaims)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxLenPayloadCC {
+		return fmt.Errorf("serialized developer claims must not exceed %d characters", maxLenPayloadCC)
+	}
+	return nil
+}
+
+// validateDeveloperClaimTypes checks the value of each claim with validateClaimValue, without
+// checking the size of the claims.
+func validateDeveloperClaimTypes(devClaims map[string]interface{}) error {
+	for k, v := range devClaims {
+		if err := validateClaimValue(v); err != nil {
+			return fmt.Errorf("developer claim %q has an unsupported value: %v", k, err)
+		}
+	}
+	return nil
+}
+
+// validateClaimValue checks that v only consists of the types a JSON claim value can be decoded
+// to: nil, strings, booleans, numbers, []interface{} and map[string]interface{}.
+func validateClaimValue(v interface{}) error {
+	switch v := v.(type) {
+	case nil, string, bool, json.Number,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return nil
+	case []interface{}:
+		for _, e := range v {
+			if err := validateClaimValue(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		for _, e := range v {
+			if err := validateClaimValue(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("values of type %T are not supported", v)
+	}
 }
 
 // VerifyIDToken verifies the signature	and payload of the provided ID token.
@@ -185,16 +297,61 @@ func (c *Client) CustomTokenWithClaims(uid string, devClaims map[string]interfac
 // https://firebase.google.com/docs/auth/admin/verify-id-tokens#retrieve_id_tokens_on_clients for
 // more details on how to obtain an ID token in a client app.
 func (c *Client) VerifyIDToken(idToken string) (*Token, error) {
+	return c.VerifyIDTokenWithOptions(context.Background(), idToken, nil)
+}
+
+// BackendError is returned when an ID token cannot be checked because a call made to verify it
+// failed, such as fetching the public keys used to verify token signatures, or looking up the user
+// to check for revocation. The token itself may be valid, and the check may succeed if retried.
+type BackendError struct {
+	// Err is the error returned by the failed call.
+	Err error
+}
+
+func (e *BackendError) Error() string {
+	return e.Err.Error()
+}
+
+// VerifierOptions specifies how ID tokens are verified.
+//
+// All fields are optional. ClockSkew is the amount of time by which the local clock may differ from
+// the clock of the token issuer. Tokens issued up to ClockSkew in the future, or expired up to
+// ClockSkew in the past, are accepted. ExtraAudiences lists additional values accepted in the 'aud'
+// claim, besides the project ID. Clock returns the current time, and defaults to time.Now.
+type VerifierOptions struct {
+	ClockSkew      time.Duration
+	ExtraAudiences []string
+	Clock          func() time.Time
+}
+
+// VerifyIDTokenWithOptions verifies the signature and payload of the provided ID token, like
+// VerifyIDToken, applying the given options.
+//
+// If the public keys used to verify tokens have to be fetched, the fetch is bound to ctx, and a
+// failure to fetch them is returned as a *BackendError. opts may be nil, in which case tokens are
+// verified exactly like VerifyIDToken does.
+func (c *Client) VerifyIDTokenWithOptions(ctx context.Context, idToken string, opts *VerifierOptions) (*Token, error) {
 	if c.projectID == "" {
 		return nil, errors.New("project id not available")
 	}
 	if idToken == "" {
 		return nil, fmt.Errorf("ID token must be a non-empty string")
 	}
+	var o VerifierOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.ClockSkew < 0 {
+		return nil, errors.New("clock skew must not be negative")
+	}
+	now := clk.Now()
+	if o.Clock != nil {
+		now = o.Clock()
+	}
 
 	h := &jwtHeader{}
 	p := &Token{}
-	if err := decodeToken(idToken, c.ks, h, p); err != nil {
+	if err := decodeToken(ctx, idToken, c.ks, h, p); err != nil {
 		return nil, err
 	}
 
@@ -211,18 +368,18 @@ func (c *Client) VerifyIDToken(idToken string) (*Token, error) {
 		} else {
 			err = fmt.Errorf("ID token has no 'kid' header")
 		}
-	} else if h.Algorithm != "RS256" {
-		err = fmt.Errorf("ID token has invalid incorrect algorithm. Expected 'RS256' but got %q. %s",
-			h.Algorithm, verifyTokenMsg)
-	} else if p.Audience != c.projectID {
+	} else if !isSupportedAlgorithm(h.Algorithm) {
+		err = fmt.Errorf("ID token has invalid incorrect algorithm. Expected one of 'RS256', 'ES256', "+
+			"'ES384' or 'ES512' but got %q. %s", h.Algorithm, verifyTokenMsg)
+	} else if !isAcceptedAudience(p.Audience, c.projectID, o.ExtraAudiences) {
 		err = fmt.Errorf("ID token has invalid 'aud' (audience) claim. Expected %q but got %q. %s %s",
 			c.projectID, p.Audience, projectIDMsg, verifyTokenMsg)
 	} else if p.Issuer != issuer {
 		err = fmt.Errorf("ID token has invalid 'iss' (issuer) claim. Expected %q but got %q. %s %s",
 			issuer, p.Issuer, projectIDMsg, verifyTokenMsg)
-	} else if p.IssuedAt > clk.Now().Unix() {
+	} else if p.IssuedAt > now.Add(o.ClockSkew).Unix() {
 		err = fmt.Errorf("ID token issued at future timestamp: %d", p.IssuedAt)
-	} else if p.Expires < clk.Now().Unix() {
+	} else if p.Expires < now.Add(-o.ClockSkew).Unix() {
 		err = fmt.Errorf("ID token has expired. Expired at: %d", p.Expires)
 	} else if p.Subject == "" {
 		err = fmt.Errorf("ID token has empty 'sub' (subject) claim. %s", verifyTokenMsg)
@@ -237,22 +394,57 @@ func (c *Client) VerifyIDToken(idToken string) (*Token, error) {
 	return p, nil
 }
 
-func parseKey(key string) (*rsa.PrivateKey, error) {
-	block, _ := pem.Decode([]byte(key))
-	if block == nil {
-		return nil, fmt.Errorf("no private key data found in: %v", key)
+// isSupportedAlgorithm reports whether alg is one of the JWT signing algorithms supported by
+// verifySignature, which cover all the keys ParseJWKS accepts.
+func isSupportedAlgorithm(alg string) bool {
+	switch alg {
+	case "RS256", "ES256", "ES384", "ES512":
+		return true
 	}
-	k := block.Bytes
-	parsedKey, err := x509.ParsePKCS8PrivateKey(k)
-	if err != nil {
-		parsedKey, err = x509.ParsePKCS1PrivateKey(k)
-		if err != nil {
-			return nil, fmt.Errorf("private key should be a PEM or plain PKSC1 or PKCS8; parse error: %v", err)
+	return false
+}
+
+func isAcceptedAudience(aud, projectID string, extra []string) bool {
+	if aud == projectID {
+		return true
+	}
+	for _, a := range extra {
+		if aud == a {
+			return true
 		}
 	}
-	parsed, ok := parsedKey.(*rsa.PrivateKey)
-	if !ok {
-		return nil, errors.New("private key is not an RSA key")
+	return false
+}
+
+// VerifyIDTokenAndCheckRevoked verifies the provided ID token, and additionally checks that the
+// token has not been revoked.
+//
+// Unlike VerifyIDToken, this function makes an RPC call to look up the user account, and
+// rejects the token if it was issued before the tokens of the user were last revoked, or if the
+// user account has been disabled. A failure to look up the user account is returned as a
+// *BackendError.
+func (c *Client) VerifyIDTokenAndCheckRevoked(ctx context.Context, idToken string) (*Token, error) {
+	p, err := c.VerifyIDTokenWithOptions(ctx, idToken, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	call := c.is.Relyingparty.GetAccountInfo(&identitytoolkit.IdentitytoolkitRelyingpartyGetAccountInfoRequest{
+		LocalId: []string{p.UID},
+	})
+	c.setHeader(call)
+	resp, err := call.Context(ctx).Do()
+	if err != nil {
+		return nil, &BackendError{Err: err}
+	}
+	if len(resp.Users) == 0 {
+		return nil, fmt.Errorf("cannot find user %q", p.UID)
+	}
+	if resp.Users[0].Disabled {
+		return nil, errors.New("user account is disabled")
 	}
-	return parsed, nil
+	if p.IssuedAt < resp.Users[0].ValidSince {
+		return nil, errors.New("ID token has been revoked")
+	}
+	return p, nil
 }
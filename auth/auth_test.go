@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -48,7 +50,7 @@ var defaultTestOpts = []option.ClientOption{
 func TestMain(m *testing.M) {
 	var (
 		err   error
-		ks    keySource
+		ks    KeySource
 		ctx   context.Context
 		creds *google.DefaultCredentials
 		opts  []option.ClientOption
@@ -83,7 +85,7 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalln(err)
 	}
-	client.ks = ks
+	client.SetKeySource(ks)
 
 	testGetUserResponse, err = ioutil.ReadFile("../testdata/get_user.json")
 	if err != nil {
@@ -174,6 +176,117 @@ func TestCustomTokenError(t *testing.T) {
 	}
 }
 
+func TestCustomTokenWithOptions(t *testing.T) {
+	claims := map[string]interface{}{
+		"foo":     "bar",
+		"premium": true,
+		"count":   float64(123),
+	}
+	opts := &CustomTokenOptions{
+		Claims:    claims,
+		ExpiresIn: 10 * time.Minute,
+		TenantID:  "tenant1",
+	}
+	token, err := client.CustomTokenWithOptions(context.Background(), "user1", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCustomToken(t, token, claims)
+
+	p := &customToken{}
+	if err := decodeToken(context.Background(), token, client.ks, &jwtHeader{}, p); err != nil {
+		t.Fatal(err)
+	}
+	if p.UID != "user1" || p.TenantID != "tenant1" {
+		t.Errorf("CustomTokenWithOptions() = (uid: %q, tenant: %q); want = (%q, %q)",
+			p.UID, p.TenantID, "user1", "tenant1")
+	}
+	if p.Exp-p.Iat != 600 {
+		t.Errorf("Exp - Iat = %d; want = 600", p.Exp-p.Iat)
+	}
+}
+
+func TestCustomTokenWithNilOptions(t *testing.T) {
+	token, err := client.CustomTokenWithOptions(context.Background(), "user1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCustomToken(t, token, nil)
+
+	p := &customToken{}
+	if err := decodeToken(context.Background(), token, client.ks, &jwtHeader{}, p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Exp-p.Iat != tokenExpSeconds || p.TenantID != "" {
+		t.Errorf("CustomTokenWithOptions() = (exp: %d, tenant: %q); want = (%d, \"\")",
+			p.Exp-p.Iat, p.TenantID, tokenExpSeconds)
+	}
+}
+
+func TestCustomTokenWithOptionsNestedClaims(t *testing.T) {
+	claims := map[string]interface{}{
+		"roles":   []interface{}{"admin", nil, int64(1)},
+		"profile": map[string]interface{}{"level": uint8(2), "tags": []interface{}{"a", false}},
+		"score":   json.Number("1.5"),
+	}
+	token, err := client.CustomTokenWithOptions(context.Background(), "user1", &CustomTokenOptions{Claims: claims})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &customToken{}
+	if err := decodeToken(context.Background(), token, client.ks, &jwtHeader{}, p); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"roles":   []interface{}{"admin", nil, 1.0},
+		"profile": map[string]interface{}{"level": 2.0, "tags": []interface{}{"a", false}},
+		"score":   1.5,
+	}
+	if !reflect.DeepEqual(p.Claims, want) {
+		t.Errorf("Claims = %v; want = %v", p.Claims, want)
+	}
+}
+
+func TestCustomTokenWithOptionsError(t *testing.T) {
+	cases := []struct {
+		name string
+		uid  string
+		opts *CustomTokenOptions
+	}{
+		{"EmptyName", "", nil},
+		{"LongUid", strings.Repeat("a", 129), nil},
+		{"NegativeExpiry", "uid", &CustomTokenOptions{ExpiresIn: -time.Minute}},
+		{"ShortExpiry", "uid", &CustomTokenOptions{ExpiresIn: time.Millisecond}},
+		{"LongExpiry", "uid", &CustomTokenOptions{ExpiresIn: time.Hour + time.Second}},
+		{"LongTenantID", "uid", &CustomTokenOptions{TenantID: strings.Repeat("a", 129)}},
+		{"ReservedClaim", "uid", &CustomTokenOptions{Claims: map[string]interface{}{"sub": "1234"}}},
+		{"ChanClaim", "uid", &CustomTokenOptions{Claims: map[string]interface{}{"foo": make(chan int)}}},
+		{"FuncClaim", "uid", &CustomTokenOptions{Claims: map[string]interface{}{"foo": func() {}}}},
+		{"NestedClaim", "uid", &CustomTokenOptions{Claims: map[string]interface{}{
+			"foo": map[string]interface{}{"bar": complex(1, 2)},
+		}}},
+		{"StructClaim", "uid", &CustomTokenOptions{Claims: map[string]interface{}{
+			"foo": struct{ Bar string }{"baz"},
+		}}},
+		{"TimeClaim", "uid", &CustomTokenOptions{Claims: map[string]interface{}{"foo": time.Now()}}},
+		{"TypedSliceClaim", "uid", &CustomTokenOptions{Claims: map[string]interface{}{"foo": []string{"bar"}}}},
+		{"NestedStructClaim", "uid", &CustomTokenOptions{Claims: map[string]interface{}{
+			"foo": []interface{}{"bar", map[string]interface{}{"baz": &CustomTokenOptions{}}},
+		}}},
+		{"LargeClaims", "uid", &CustomTokenOptions{Claims: map[string]interface{}{
+			"foo": strings.Repeat("a", 1000),
+		}}},
+	}
+
+	for _, tc := range cases {
+		token, err := client.CustomTokenWithOptions(context.Background(), tc.uid, tc.opts)
+		if token != "" || err == nil {
+			t.Errorf("CustomTokenWithOptions(%q) = (%q, %v); want = (\"\", error)", tc.name, token, err)
+		}
+	}
+}
+
 func TestCustomTokenInvalidCredential(t *testing.T) {
 	// AuthConfig with nil Creds
 	conf := &internal.AuthConfig{Opts: defaultTestOpts}
@@ -206,6 +319,58 @@ func TestVerifyIDToken(t *testing.T) {
 	}
 }
 
+func TestVerifyIDTokenFirebaseClaims(t *testing.T) {
+	authTime := time.Now().Unix() - 200
+	token := getIDToken(mockIDTokenPayload{
+		"auth_time":      authTime,
+		"email":          "user@example.com",
+		"email_verified": true,
+		"name":           "Test User",
+		"picture":        "https://example.com/user.png",
+		"phone_number":   "+11234567890",
+		"firebase": map[string]interface{}{
+			"sign_in_provider":      "password",
+			"sign_in_second_factor": "phone",
+			"tenant":                "tenant-1",
+			"identities": map[string]interface{}{
+				"email": []interface{}{"user@example.com"},
+			},
+		},
+	})
+	ft, err := client.VerifyIDToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ft.AuthTime != authTime {
+		t.Errorf("AuthTime = %d; want = %d", ft.AuthTime, authTime)
+	}
+	if ft.Email != "user@example.com" || !ft.EmailVerified {
+		t.Errorf("Email = (%q, %v); want = (%q, true)", ft.Email, ft.EmailVerified, "user@example.com")
+	}
+	if ft.Name != "Test User" || ft.Picture != "https://example.com/user.png" {
+		t.Errorf("Name, Picture = (%q, %q); want = (%q, %q)",
+			ft.Name, ft.Picture, "Test User", "https://example.com/user.png")
+	}
+	if ft.PhoneNumber != "+11234567890" {
+		t.Errorf("PhoneNumber = %q; want = %q", ft.PhoneNumber, "+11234567890")
+	}
+	want := FirebaseInfo{
+		SignInProvider:     "password",
+		SignInSecondFactor: "phone",
+		Tenant:             "tenant-1",
+		Identities: map[string]interface{}{
+			"email": []interface{}{"user@example.com"},
+		},
+	}
+	if !reflect.DeepEqual(ft.Firebase, want) {
+		t.Errorf("Firebase = %#v; want = %#v", ft.Firebase, want)
+	}
+	if ft.Claims["email"] != "user@example.com" {
+		t.Errorf("Claims['email'] = %v; want = %q", ft.Claims["email"], "user@example.com")
+	}
+}
+
 func TestVerifyIDTokenInvalidSignature(t *testing.T) {
 	parts := strings.Split(testIDToken, ".")
 	token := fmt.Sprintf("%s:%s:invalidsignature", parts[0], parts[1])
@@ -273,15 +438,87 @@ func TestCertificateRequestError(t *testing.T) {
 	defer func() {
 		client.ks = ks
 	}()
-	if _, err := client.VerifyIDToken(testIDToken); err == nil {
-		t.Error("VeridyIDToken() = nil; want error")
+	_, err := client.VerifyIDToken(testIDToken)
+	if be, ok := err.(*BackendError); !ok || be.Err.Error() != "mock error" {
+		t.Errorf("VerifyIDToken() = %v; want = BackendError(mock error)", err)
+	}
+}
+
+func TestVerifyIDTokenWithOptions(t *testing.T) {
+	now := time.Now().Unix()
+	cases := []struct {
+		name  string
+		token string
+		opts  *VerifierOptions
+	}{
+		{"NilOptions", testIDToken, nil},
+		{"FutureTokenWithinSkew", getIDToken(mockIDTokenPayload{"iat": now + 30}),
+			&VerifierOptions{ClockSkew: time.Minute}},
+		{"ExpiredTokenWithinSkew", getIDToken(mockIDTokenPayload{"iat": now - 1000, "exp": now - 30}),
+			&VerifierOptions{ClockSkew: time.Minute}},
+		{"ExtraAudience", getIDToken(mockIDTokenPayload{"aud": "other-audience"}),
+			&VerifierOptions{ExtraAudiences: []string{"foo", "other-audience"}}},
+		{"Clock", getIDToken(mockIDTokenPayload{"iat": now - 1000, "exp": now - 100}),
+			&VerifierOptions{Clock: func() time.Time { return time.Unix(now-500, 0) }}},
+	}
+	for _, tc := range cases {
+		ft, err := client.VerifyIDTokenWithOptions(context.Background(), tc.token, tc.opts)
+		if err != nil {
+			t.Errorf("VerifyIDTokenWithOptions(%s) = %v; want = nil", tc.name, err)
+		} else if ft.UID != "1234567890" {
+			t.Errorf("UID = %q; want = %q", ft.UID, "1234567890")
+		}
+	}
+}
+
+func TestVerifyIDTokenWithOptionsError(t *testing.T) {
+	now := time.Now().Unix()
+	cases := []struct {
+		name  string
+		token string
+		opts  *VerifierOptions
+	}{
+		{"FutureTokenOutsideSkew", getIDToken(mockIDTokenPayload{"iat": now + 120}),
+			&VerifierOptions{ClockSkew: time.Minute}},
+		{"ExpiredTokenOutsideSkew", getIDToken(mockIDTokenPayload{"iat": now - 1000, "exp": now - 120}),
+			&VerifierOptions{ClockSkew: time.Minute}},
+		{"NegativeSkew", testIDToken, &VerifierOptions{ClockSkew: -time.Minute}},
+		{"BadAudience", getIDToken(mockIDTokenPayload{"aud": "bad-audience"}),
+			&VerifierOptions{ExtraAudiences: []string{"other-audience"}}},
+		{"Clock", testIDToken,
+			&VerifierOptions{Clock: func() time.Time { return time.Now().Add(2 * time.Hour) }}},
+	}
+	for _, tc := range cases {
+		if ft, err := client.VerifyIDTokenWithOptions(context.Background(), tc.token, tc.opts); ft != nil || err == nil {
+			t.Errorf("VerifyIDTokenWithOptions(%s) = (%v, %v); want = (nil, error)", tc.name, ft, err)
+		}
+	}
+}
+
+func TestVerifyIDTokenWithOptionsCancelledContext(t *testing.T) {
+	s := newCertServer(t, "100")
+	defer s.srv.Close()
+	block := make(chan struct{})
+	defer close(block)
+	s.set(false, block)
+
+	ks := client.ks
+	client.ks = newHTTPKeySource(s.srv.URL, http.DefaultClient)
+	defer func() {
+		client.ks = ks
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if ft, err := client.VerifyIDTokenWithOptions(ctx, testIDToken, nil); ft != nil || err == nil {
+		t.Errorf("VerifyIDTokenWithOptions() = (%v, %v); want = (nil, error)", ft, err)
 	}
 }
 
 func verifyCustomToken(t *testing.T, token string, expected map[string]interface{}) {
 	h := &jwtHeader{}
 	p := &customToken{}
-	if err := decodeToken(token, client.ks, h, p); err != nil {
+	if err := decodeToken(context.Background(), token, client.ks, h, p); err != nil {
 		t.Fatal(err)
 	}
 
@@ -327,7 +564,7 @@ func getIDTokenWithKid(kid string, p mockIDTokenPayload) string {
 	}
 	h := defaultHeader()
 	h.KeyID = kid
-	token, err := encodeToken(client.snr, h, pCopy)
+	token, err := encodeToken(context.Background(), client.snr, h, pCopy)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -342,21 +579,21 @@ func (p mockIDTokenPayload) decode(s string) error {
 
 // mockKeySource provides access to a set of in-memory public keys.
 type mockKeySource struct {
-	keys []*publicKey
+	keys []*PublicKey
 	err  error
 }
 
-func (k *mockKeySource) Keys() ([]*publicKey, error) {
+func (k *mockKeySource) Keys() ([]*PublicKey, error) {
 	return k.keys, k.err
 }
 
 // fileKeySource loads a set of public keys from the local file system.
 type fileKeySource struct {
 	FilePath   string
-	CachedKeys []*publicKey
+	CachedKeys []*PublicKey
 }
 
-func (f *fileKeySource) Keys() ([]*publicKey, error) {
+func (f *fileKeySource) Keys() ([]*PublicKey, error) {
 	if f.CachedKeys == nil {
 		certs, err := ioutil.ReadFile(f.FilePath)
 		if err != nil {
@@ -374,15 +611,15 @@ func (f *fileKeySource) Keys() ([]*publicKey, error) {
 // is used in tests to verify custom tokens and mock ID tokens when they are signed with
 // App Engine private keys.
 type aeKeySource struct {
-	keys []*publicKey
+	keys []*PublicKey
 }
 
-func newAEKeySource(ctx context.Context) (keySource, error) {
+func newAEKeySource(ctx context.Context) (KeySource, error) {
 	certs, err := appengine.PublicCertificates(ctx)
 	if err != nil {
 		return nil, err
 	}
-	keys := make([]*publicKey, len(certs))
+	keys := make([]*PublicKey, len(certs))
 	for i, cert := range certs {
 		pk, err := parsePublicKey("mock-key-id-1", cert.Data)
 		if err != nil {
@@ -394,6 +631,6 @@ func newAEKeySource(ctx context.Context) (keySource, error) {
 }
 
 // Keys returns the RSA Public Keys managed by App Engine.
-func (k aeKeySource) Keys() ([]*publicKey, error) {
+func (k aeKeySource) Keys() ([]*PublicKey, error) {
 	return k.keys, nil
 }
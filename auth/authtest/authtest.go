@@ -0,0 +1,538 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package authtest provides an in-memory fake of the Firebase Auth backend, for use in tests.
+//
+// A Server implements the user management endpoints used by auth.Client (creating, updating,
+// looking up, deleting and listing users), and serves the public certificates used to verify ID
+// tokens. Server.IDToken mints ID tokens that auth.Client accepts. All state is kept in memory,
+// and discarded when the Server is closed.
+//
+//	s, err := authtest.NewServer("test-project")
+//	...
+//	defer s.Close()
+//	client, err := s.NewClient(ctx)
+//	...
+//	u, err := client.CreateUser(ctx, (&auth.UserToCreate{}).Email("user@example.com"))
+package authtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/identitytoolkit/v3"
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/auth"
+	"firebase.google.com/go/internal"
+)
+
+const certPath = "/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+const relyingpartyPath = "/identitytoolkit/v3/relyingparty/"
+const issuerPrefix = "https://securetoken.google.com/"
+const keyID = "authtest-key"
+const maxResults = 1000
+
+// Server is an in-memory fake of the Firebase Auth backend.
+type Server struct {
+	// ProjectID is the ID of the project the Server acts as the backend for. ID tokens minted by
+	// the Server are issued for this project.
+	ProjectID string
+
+	srv  *httptest.Server
+	key  *rsa.PrivateKey
+	cert []byte
+
+	mu    sync.Mutex
+	users map[string]*identitytoolkit.UserInfo
+}
+
+// NewServer starts a new Server that acts as the Auth backend of the given project.
+//
+// The caller should call Close when finished, to shut it down.
+func NewServer(projectID string) (*Server, error) {
+	if projectID == "" {
+		return nil, errors.New("project id must not be empty")
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := selfSignedCert(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ProjectID: projectID,
+		key:       key,
+		cert:      cert,
+		users:     make(map[string]*identitytoolkit.UserInfo),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s, nil
+}
+
+// Close shuts down the Server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the base URL of the Server.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// ClientOptions returns the options that direct the HTTP requests of an SDK client to the Server.
+//
+// The options can be passed to firebase.NewApp, along with a firebase.Config that specifies the
+// ProjectID of the Server, to obtain an App whose auth.Client talks to the Server. All requests
+// made with these options are sent to the Server, regardless of their destination.
+func (s *Server) ClientOptions() []option.ClientOption {
+	hc := &http.Client{Transport: &redirectTransport{target: s.srv.URL}}
+	return []option.ClientOption{option.WithHTTPClient(hc)}
+}
+
+// NewClient returns an auth.Client that talks to the Server.
+//
+// The client can manage users and verify ID tokens minted by the Server. It cannot mint custom
+// tokens, since it is not initialized with service account credentials.
+func (s *Server) NewClient(ctx context.Context) (*auth.Client, error) {
+	return auth.NewClient(ctx, &internal.AuthConfig{
+		Opts:      s.ClientOptions(),
+		ProjectID: s.ProjectID,
+	})
+}
+
+// IDToken returns an ID token for the given user ID, signed with the key of the Server.
+//
+// The token is valid for one hour, and is accepted by auth.Client.VerifyIDToken for clients
+// that talk to the Server. The given claims are added to the token, and may override the
+// standard claims (e.g. to create expired tokens, or tokens issued for another project).
+func (s *Server) IDToken(uid string, claims map[string]interface{}) (string, error) {
+	if uid == "" {
+		return "", errors.New("uid must not be empty")
+	}
+	now := time.Now().Unix()
+	payload := map[string]interface{}{
+		"iss":       issuerPrefix + s.ProjectID,
+		"aud":       s.ProjectID,
+		"iat":       now,
+		"exp":       now + 3600,
+		"auth_time": now,
+		"sub":       uid,
+		"firebase": map[string]interface{}{
+			"sign_in_provider": "custom",
+			"identities":       map[string]interface{}{},
+		},
+	}
+	for k, v := range claims {
+		payload[k] = v
+	}
+
+	encode := func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), nil
+	}
+	h, err := encode(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	if err != nil {
+		return "", err
+	}
+	p, err := encode(payload)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(h + "." + p))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return h + "." + p + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// redirectTransport sends all requests to the target server, preserving their paths.
+type redirectTransport struct {
+	target string
+}
+
+func (t *redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	u, err := url.Parse(t.target)
+	if err != nil {
+		return nil, err
+	}
+	req := r.WithContext(r.Context())
+	req.URL = &url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+	}
+	req.Host = u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == certPath {
+		b, _ := json.Marshal(map[string]string{keyID: string(s.cert)})
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+		return
+	}
+
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, relyingpartyPath) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND")
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST")
+		return
+	}
+
+	handlers := map[string]func([]byte) (interface{}, error){
+		"signupNewUser":   s.signupNewUser,
+		"setAccountInfo":  s.setAccountInfo,
+		"getAccountInfo":  s.getAccountInfo,
+		"deleteAccount":   s.deleteAccount,
+		"downloadAccount": s.downloadAccount,
+	}
+	handler, ok := handlers[strings.TrimPrefix(r.URL.Path, relyingpartyPath)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND")
+		return
+	}
+
+	s.mu.Lock()
+	resp, err := handler(b)
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	b, _ = json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"errors": []interface{}{
+				map[string]interface{}{"domain": "global", "reason": "invalid", "message": message},
+			},
+		},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (s *Server) signupNewUser(b []byte) (interface{}, error) {
+	var req identitytoolkit.IdentitytoolkitRelyingpartySignupNewUserRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, errors.New("INVALID_REQUEST")
+	}
+
+	uid := req.LocalId
+	if uid == "" {
+		var err error
+		if uid, err = newUID(); err != nil {
+			return nil, err
+		}
+	} else if _, ok := s.users[uid]; ok {
+		return nil, errors.New("DUPLICATE_LOCAL_ID")
+	}
+	if err := s.checkUnique("", req.Email, req.PhoneNumber); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	u := &identitytoolkit.UserInfo{
+		LocalId:       uid,
+		DisplayName:   req.DisplayName,
+		Email:         req.Email,
+		EmailVerified: req.EmailVerified,
+		PhoneNumber:   req.PhoneNumber,
+		PhotoUrl:      req.PhotoUrl,
+		Disabled:      req.Disabled,
+		CreatedAt:     now.UnixNano() / int64(time.Millisecond),
+		ValidSince:    now.Unix(),
+	}
+	if req.Password != "" {
+		setPassword(u, req.Password, now)
+	}
+	updateProviders(u)
+	s.users[uid] = u
+	return &identitytoolkit.SignupNewUserResponse{
+		Kind:        "identitytoolkit#SignupNewUserResponse",
+		LocalId:     uid,
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+	}, nil
+}
+
+func (s *Server) setAccountInfo(b []byte) (interface{}, error) {
+	var req identitytoolkit.IdentitytoolkitRelyingpartySetAccountInfoRequest
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, errors.New("INVALID_REQUEST")
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, errors.New("INVALID_REQUEST")
+	}
+
+	u, ok := s.users[req.LocalId]
+	if !ok {
+		return nil, errors.New("USER_NOT_FOUND")
+	}
+	if err := s.checkUnique(u.LocalId, req.Email, req.PhoneNumber); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if req.DisplayName != "" {
+		u.DisplayName = req.DisplayName
+	}
+	if req.Email != "" {
+		u.Email = req.Email
+	}
+	if req.PhoneNumber != "" {
+		u.PhoneNumber = req.PhoneNumber
+	}
+	if req.PhotoUrl != "" {
+		u.PhotoUrl = req.PhotoUrl
+	}
+	if req.Password != "" {
+		setPassword(u, req.Password, now)
+	}
+	if req.CustomAttributes != "" {
+		u.CustomAttributes = req.CustomAttributes
+	}
+	if _, ok := fields["disableUser"]; ok {
+		u.Disabled = req.DisableUser
+	}
+	if _, ok := fields["emailVerified"]; ok {
+		u.EmailVerified = req.EmailVerified
+	}
+	if req.ValidSince != 0 {
+		u.ValidSince = req.ValidSince
+	}
+	for _, attr := range req.DeleteAttribute {
+		switch attr {
+		case "DISPLAY_NAME":
+			u.DisplayName = ""
+		case "PHOTO_URL":
+			u.PhotoUrl = ""
+		}
+	}
+	for _, p := range req.DeleteProvider {
+		if p == "phone" {
+			u.PhoneNumber = ""
+		}
+	}
+	updateProviders(u)
+	return &identitytoolkit.SetAccountInfoResponse{
+		Kind:        "identitytoolkit#SetAccountInfoResponse",
+		LocalId:     u.LocalId,
+		Email:       u.Email,
+		DisplayName: u.DisplayName,
+	}, nil
+}
+
+func (s *Server) getAccountInfo(b []byte) (interface{}, error) {
+	var req identitytoolkit.IdentitytoolkitRelyingpartyGetAccountInfoRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, errors.New("INVALID_REQUEST")
+	}
+
+	var users []*identitytoolkit.UserInfo
+	for _, u := range s.sortedUsers() {
+		if contains(req.LocalId, u.LocalId) ||
+			(u.Email != "" && contains(req.Email, u.Email)) ||
+			(u.PhoneNumber != "" && contains(req.PhoneNumber, u.PhoneNumber)) {
+			users = append(users, copyUser(u))
+		}
+	}
+	return &identitytoolkit.GetAccountInfoResponse{
+		Kind:  "identitytoolkit#GetAccountInfoResponse",
+		Users: users,
+	}, nil
+}
+
+func (s *Server) deleteAccount(b []byte) (interface{}, error) {
+	var req identitytoolkit.IdentitytoolkitRelyingpartyDeleteAccountRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, errors.New("INVALID_REQUEST")
+	}
+	if _, ok := s.users[req.LocalId]; !ok {
+		return nil, errors.New("USER_NOT_FOUND")
+	}
+	delete(s.users, req.LocalId)
+	return &identitytoolkit.DeleteAccountResponse{Kind: "identitytoolkit#DeleteAccountResponse"}, nil
+}
+
+func (s *Server) downloadAccount(b []byte) (interface{}, error) {
+	var req identitytoolkit.IdentitytoolkitRelyingpartyDownloadAccountRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return nil, errors.New("INVALID_REQUEST")
+	}
+	size := int(req.MaxResults)
+	if size <= 0 || size > maxResults {
+		size = maxResults
+	}
+
+	var users []*identitytoolkit.UserInfo
+	var next string
+	for _, u := range s.sortedUsers() {
+		if u.LocalId <= req.NextPageToken {
+			continue
+		}
+		if len(users) == size {
+			next = users[len(users)-1].LocalId
+			break
+		}
+		users = append(users, copyUser(u))
+	}
+	return &identitytoolkit.DownloadAccountResponse{
+		Kind:          "identitytoolkit#DownloadAccountResponse",
+		Users:         users,
+		NextPageToken: next,
+	}, nil
+}
+
+// checkUnique checks that no user other than the one identified by uid has the given email or
+// phone number.
+func (s *Server) checkUnique(uid, email, phone string) error {
+	for _, u := range s.users {
+		if u.LocalId == uid {
+			continue
+		}
+		if email != "" && strings.EqualFold(u.Email, email) {
+			return errors.New("EMAIL_EXISTS")
+		}
+		if phone != "" && u.PhoneNumber == phone {
+			return errors.New("PHONE_NUMBER_EXISTS")
+		}
+	}
+	return nil
+}
+
+func (s *Server) sortedUsers() []*identitytoolkit.UserInfo {
+	var users []*identitytoolkit.UserInfo
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].LocalId < users[j].LocalId })
+	return users
+}
+
+// setPassword stores a fake password hash in the same format as the Firebase Auth emulator.
+func setPassword(u *identitytoolkit.UserInfo, password string, now time.Time) {
+	u.Salt = "fakeSalt"
+	u.PasswordHash = "fakeHash:salt=fakeSalt:password=" + password
+	u.PasswordUpdatedAt = float64(now.UnixNano() / int64(time.Millisecond))
+}
+
+// updateProviders rebuilds the provider data of a user, based on its email and phone number.
+func updateProviders(u *identitytoolkit.UserInfo) {
+	u.ProviderUserInfo = nil
+	if u.Email != "" && u.PasswordHash != "" {
+		u.ProviderUserInfo = append(u.ProviderUserInfo, &identitytoolkit.UserInfoProviderUserInfo{
+			ProviderId:  "password",
+			RawId:       u.Email,
+			FederatedId: u.Email,
+			Email:       u.Email,
+			DisplayName: u.DisplayName,
+			PhotoUrl:    u.PhotoUrl,
+		})
+	}
+	if u.PhoneNumber != "" {
+		u.ProviderUserInfo = append(u.ProviderUserInfo, &identitytoolkit.UserInfoProviderUserInfo{
+			ProviderId:  "phone",
+			RawId:       u.PhoneNumber,
+			PhoneNumber: u.PhoneNumber,
+		})
+	}
+}
+
+func copyUser(u *identitytoolkit.UserInfo) *identitytoolkit.UserInfo {
+	c := *u
+	c.ProviderUserInfo = nil
+	for _, p := range u.ProviderUserInfo {
+		pc := *p
+		c.ProviderUserInfo = append(c.ProviderUserInfo, &pc)
+	}
+	return &c
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// newUID returns a random 28-character user ID, like the ones assigned by Firebase Auth.
+func newUID() (string, error) {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 28)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = chars[int(b[i])%len(chars)]
+	}
+	return string(b), nil
+}
+
+func selfSignedCert(key *rsa.PrivateKey) ([]byte, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "authtest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
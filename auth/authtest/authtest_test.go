@@ -0,0 +1,266 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authtest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+
+	"firebase.google.com/go/auth"
+)
+
+func newTestClient(t *testing.T) (*Server, *auth.Client) {
+	s, err := NewServer("mock-project-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := s.NewClient(context.Background())
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+func TestNewServerError(t *testing.T) {
+	if s, err := NewServer(""); s != nil || err == nil {
+		t.Errorf("NewServer('') = (%v, %v); want = (nil, error)", s, err)
+	}
+}
+
+func TestUserLifecycle(t *testing.T) {
+	s, client := newTestClient(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	params := (&auth.UserToCreate{}).
+		Email("user@example.com").
+		Password("secret").
+		DisplayName("Test User").
+		PhoneNumber("+15555550100")
+	u, err := client.CreateUser(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.UID == "" || u.Email != "user@example.com" || u.DisplayName != "Test User" {
+		t.Errorf("CreateUser() = %#v; want user with email and display name", u.UserInfo)
+	}
+	if len(u.ProviderUserInfo) != 2 {
+		t.Errorf("ProviderUserInfo = %d; want = 2", len(u.ProviderUserInfo))
+	}
+
+	if got, err := client.GetUserByEmail(ctx, "user@example.com"); err != nil || got.UID != u.UID {
+		t.Errorf("GetUserByEmail() = (%v, %v); want = (%q, nil)", got, err, u.UID)
+	}
+	if got, err := client.GetUserByPhoneNumber(ctx, "+15555550100"); err != nil || got.UID != u.UID {
+		t.Errorf("GetUserByPhoneNumber() = (%v, %v); want = (%q, nil)", got, err, u.UID)
+	}
+
+	update := (&auth.UserToUpdate{}).
+		DisplayName("").
+		PhoneNumber("").
+		Disabled(true).
+		EmailVerified(true).
+		CustomClaims(map[string]interface{}{"admin": true})
+	u, err = client.UpdateUser(ctx, u.UID, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.DisplayName != "" || u.PhoneNumber != "" || !u.Disabled || !u.EmailVerified {
+		t.Errorf("UpdateUser() = %#v; want updated user", u)
+	}
+	if u.CustomClaims["admin"] != true {
+		t.Errorf("CustomClaims = %v; want = {admin: true}", u.CustomClaims)
+	}
+
+	u, err = client.UpdateUser(ctx, u.UID, (&auth.UserToUpdate{}).Disabled(false))
+	if err != nil || u.Disabled {
+		t.Errorf("UpdateUser(Disabled(false)) = (%v, %v); want = (enabled user, nil)", u, err)
+	}
+
+	if err := client.DeleteUser(ctx, u.UID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.GetUser(ctx, u.UID); got != nil || err == nil {
+		t.Errorf("GetUser() = (%v, %v); want = (nil, error)", got, err)
+	}
+	if err := client.DeleteUser(ctx, u.UID); err == nil {
+		t.Errorf("DeleteUser() = nil; want = error")
+	}
+}
+
+func TestCreateUserWithUID(t *testing.T) {
+	s, client := newTestClient(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	u, err := client.CreateUser(ctx, (&auth.UserToCreate{}).UID("user1"))
+	if err != nil || u.UID != "user1" {
+		t.Fatalf("CreateUser() = (%v, %v); want = (user1, nil)", u, err)
+	}
+	if u, err := client.CreateUser(ctx, (&auth.UserToCreate{}).UID("user1")); u != nil || err == nil {
+		t.Errorf("CreateUser(DuplicateUID) = (%v, %v); want = (nil, error)", u, err)
+	}
+}
+
+func TestDuplicateEmailAndPhone(t *testing.T) {
+	s, client := newTestClient(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	if _, err := client.CreateUser(ctx, (&auth.UserToCreate{}).Email("user@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateUser(ctx, (&auth.UserToCreate{}).PhoneNumber("+15555550100")); err != nil {
+		t.Fatal(err)
+	}
+	other, err := client.CreateUser(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := client.CreateUser(ctx, (&auth.UserToCreate{}).Email("user@example.com")); u != nil || err == nil {
+		t.Errorf("CreateUser(DuplicateEmail) = (%v, %v); want = (nil, error)", u, err)
+	}
+	if u, err := client.UpdateUser(ctx, other.UID, (&auth.UserToUpdate{}).PhoneNumber("+15555550100")); u != nil || err == nil {
+		t.Errorf("UpdateUser(DuplicatePhone) = (%v, %v); want = (nil, error)", u, err)
+	}
+	if u, err := client.UpdateUser(ctx, "unknown", (&auth.UserToUpdate{}).DisplayName("foo")); u != nil || err == nil {
+		t.Errorf("UpdateUser(UnknownUser) = (%v, %v); want = (nil, error)", u, err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	s, client := newTestClient(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	want := make(map[string]bool)
+	for i := 0; i < 5; i++ {
+		uid := fmt.Sprintf("user%d", i)
+		if _, err := client.CreateUser(ctx, (&auth.UserToCreate{}).UID(uid)); err != nil {
+			t.Fatal(err)
+		}
+		want[uid] = true
+	}
+
+	it := client.Users(ctx, "")
+	it.PageInfo().MaxSize = 2
+	var uids []string
+	for {
+		u, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, u.UID)
+	}
+	if len(uids) != len(want) {
+		t.Errorf("Users() = %v; want = %d users", uids, len(want))
+	}
+	for _, uid := range uids {
+		if !want[uid] {
+			t.Errorf("Users() = %v; unexpected user %q", uids, uid)
+		}
+		delete(want, uid)
+	}
+
+	pager := iterator.NewPager(client.Users(ctx, ""), 2, "")
+	var page []*auth.ExportedUserRecord
+	token, err := pager.NextPage(&page)
+	if err != nil || len(page) != 2 || token != "user1" {
+		t.Errorf("NextPage() = (%d users, %q, %v); want = (2, %q, nil)", len(page), token, err, "user1")
+	}
+}
+
+func TestIDToken(t *testing.T) {
+	s, client := newTestClient(t)
+	defer s.Close()
+
+	token, err := s.IDToken("user1", map[string]interface{}{"admin": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft, err := client.VerifyIDToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft.UID != "user1" || ft.Claims["admin"] != true || ft.Firebase.SignInProvider != "custom" {
+		t.Errorf("VerifyIDToken() = %#v; want token for user1 with admin claim", ft)
+	}
+
+	expired, err := s.IDToken("user1", map[string]interface{}{
+		"iat": time.Now().Unix() - 7200,
+		"exp": time.Now().Unix() - 3600,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft, err := client.VerifyIDToken(expired); ft != nil || err == nil {
+		t.Errorf("VerifyIDToken(expired) = (%v, %v); want = (nil, error)", ft, err)
+	}
+
+	if token, err := s.IDToken("", nil); token != "" || err == nil {
+		t.Errorf("IDToken('') = (%q, %v); want = ('', error)", token, err)
+	}
+}
+
+func TestIDTokenOtherServer(t *testing.T) {
+	s, client := newTestClient(t)
+	defer s.Close()
+	other, err := NewServer("mock-project-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	token, err := other.IDToken("user1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft, err := client.VerifyIDToken(token); ft != nil || err == nil {
+		t.Errorf("VerifyIDToken() = (%v, %v); want = (nil, error)", ft, err)
+	}
+}
+
+func TestVerifyIDTokenAndCheckRevoked(t *testing.T) {
+	s, client := newTestClient(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	u, err := client.CreateUser(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.IDToken(u.UID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ft, err := client.VerifyIDTokenAndCheckRevoked(ctx, token); err != nil || ft.UID != u.UID {
+		t.Fatalf("VerifyIDTokenAndCheckRevoked() = (%v, %v); want = (token, nil)", ft, err)
+	}
+
+	if _, err := client.UpdateUser(ctx, u.UID, (&auth.UserToUpdate{}).Disabled(true)); err != nil {
+		t.Fatal(err)
+	}
+	if ft, err := client.VerifyIDTokenAndCheckRevoked(ctx, token); ft != nil || err == nil {
+		t.Errorf("VerifyIDTokenAndCheckRevoked(disabled) = (%v, %v); want = (nil, error)", ft, err)
+	}
+}
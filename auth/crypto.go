@@ -16,26 +16,41 @@ package auth
 
 import (
 	"crypto"
-	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/sha512"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
-// publicKey represents a parsed RSA public key along with its unique key ID.
-type publicKey struct {
-	Kid string
-	Key *rsa.PublicKey
+// defaultJWKSMaxAge is the duration for which keys fetched from a JSON Web Key Set are cached
+// when the response does not carry a max-age cache-control directive.
+const defaultJWKSMaxAge = 6 * time.Hour
+
+// PublicKey represents a parsed public key along with its unique key ID.
+//
+// Key is either an *rsa.PublicKey or an *ecdsa.PublicKey. Algorithm optionally restricts the
+// JWT signing algorithm (e.g. "RS256" or "ES256") the key may be used with. If empty, the key
+// may be used with any algorithm that matches its type.
+type PublicKey struct {
+	Kid       string
+	Algorithm string
+	Key       crypto.PublicKey
 }
 
 // clock is used to query the current local time.
@@ -57,22 +72,102 @@ func (m *mockClock) Now() time.Time {
 	return m.now
 }
 
-// keySource is used to obtain a set of public keys, which can be used to verify cryptographic
+// KeySource is used to obtain a set of public keys, which can be used to verify cryptographic
 // signatures.
-type keySource interface {
-	Keys() ([]*publicKey, error)
+type KeySource interface {
+	Keys() ([]*PublicKey, error)
+}
+
+// contextKeySource is implemented by key sources that may perform I/O to obtain keys, and
+// can bind that I/O to a context.
+type contextKeySource interface {
+	keysContext(ctx context.Context) ([]*PublicKey, error)
+}
+
+// keysWithContext returns the keys of ks, binding any I/O performed to ctx when ks supports it.
+func keysWithContext(ctx context.Context, ks KeySource) ([]*PublicKey, error) {
+	if cks, ok := ks.(contextKeySource); ok {
+		return cks.keysContext(ctx)
+	}
+	return ks.Keys()
+}
+
+// NewJWKSKeySource returns a KeySource that fetches public keys from the JSON Web Key Set
+// hosted at the given URI.
+//
+// Keys are cached in memory, and refreshed based on the standard HTTP cache-control headers of
+// the response. Keys are cached for 6 hours if the response carries no max-age directive. If hc
+// is nil, http.DefaultClient is used to fetch the keys.
+func NewJWKSKeySource(uri string, hc *http.Client) KeySource {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	ks := newHTTPKeySource(uri, hc)
+	ks.parse = ParseJWKS
+	ks.defaultMaxAge = defaultJWKSMaxAge
+	return ks
+}
+
+// VerifySignature verifies the signature of a JWT with the public keys obtained from ks.
+//
+// The signature must be made with the algorithm named in the 'alg' header of the token, which
+// must be RS256, ES256, ES384 or ES512, by one of the keys whose ID matches the 'kid' header. The
+// claims of the token are not checked. VerifySignature lets other services that sign JWTs with
+// published keys, such as App Check, verify them the same way ID tokens are verified. If the keys
+// have to be fetched, the fetch is bound to ctx, and a failure to fetch them is returned as a
+// *BackendError.
+func VerifySignature(ctx context.Context, token string, ks KeySource) error {
+	s := strings.Split(token, ".")
+	if len(s) != 3 {
+		return errors.New("incorrect number of segments")
+	}
+	h := &jwtHeader{}
+	if err := decode(s[0], h); err != nil {
+		return err
+	}
+	if h.KeyID == "" {
+		return errors.New("token has no 'kid' header")
+	}
+	return verifyTokenSignature(ctx, s, h, ks)
 }
 
-// httpKeySource fetches RSA public keys from a remote HTTP server, and caches them in
+// NewStaticKeySource returns a KeySource that always returns the given set of public keys.
+func NewStaticKeySource(keys ...*PublicKey) KeySource {
+	return staticKeySource(keys)
+}
+
+type staticKeySource []*PublicKey
+
+func (k staticKeySource) Keys() ([]*PublicKey, error) {
+	if len(k) == 0 {
+		return nil, errors.New("no public keys available")
+	}
+	return k, nil
+}
+
+// httpKeySource fetches public keys from a remote HTTP server, and caches them in
 // memory. It also handles cache! invalidation and refresh based on the standard HTTP
 // cache-control headers.
+//
+// Mutex guards the cached keys and statistics, but is never held while fetching keys. Fetches
+// are serialized by a separate mutex, and while one is in flight, callers are served the
+// previously cached keys, even if they have expired.
 type httpKeySource struct {
 	KeyURI     string
 	HTTPClient *http.Client
-	CachedKeys []*publicKey
+	CachedKeys []*PublicKey
 	ExpiryTime time.Time
 	Clock      clock
 	Mutex      *sync.Mutex
+
+	parse      func([]byte) ([]*PublicKey, error)
+	fetchMutex sync.Mutex
+	refreshing bool
+	stats      KeySourceStats
+
+	// defaultMaxAge is how long keys are cached when the response has no max-age directive. If
+	// zero, such responses are rejected.
+	defaultMaxAge time.Duration
 }
 
 func newHTTPKeySource(uri string, hc *http.Client) *httpKeySource {
@@ -81,53 +176,118 @@ func newHTTPKeySource(uri string, hc *http.Client) *httpKeySource {
 		HTTPClient: hc,
 		Clock:      systemClock{},
 		Mutex:      &sync.Mutex{},
+		parse:      parsePublicKeys,
 	}
 }
 
-// Keys returns the RSA Public Keys hosted at this key source's URI. Refreshes the data if
+// Keys returns the public keys hosted at this key source's URI. Refreshes the data if
 // the cache is stale.
-func (k *httpKeySource) Keys() ([]*publicKey, error) {
+func (k *httpKeySource) Keys() ([]*PublicKey, error) {
+	return k.keysContext(context.Background())
+}
+
+func (k *httpKeySource) keysContext(ctx context.Context) ([]*PublicKey, error) {
 	k.Mutex.Lock()
-	defer k.Mutex.Unlock()
-	if len(k.CachedKeys) == 0 || k.hasExpired() {
-		err := k.refreshKeys()
-		if err != nil && len(k.CachedKeys) == 0 {
-			return nil, err
+	if len(k.CachedKeys) > 0 {
+		if !k.hasExpired() {
+			k.stats.Hits++
+			keys := k.CachedKeys
+			k.Mutex.Unlock()
+			return keys, nil
+		}
+		if k.refreshing {
+			k.stats.StaleHits++
+			keys := k.CachedKeys
+			k.Mutex.Unlock()
+			return keys, nil
 		}
 	}
+	k.stats.Misses++
+	k.Mutex.Unlock()
+
+	err := k.refreshKeys(ctx, false)
+	k.Mutex.Lock()
+	defer k.Mutex.Unlock()
+	if err != nil && len(k.CachedKeys) == 0 {
+		return nil, err
+	}
 	return k.CachedKeys, nil
 }
 
+// Stats returns a snapshot of the cache statistics of this key source.
+func (k *httpKeySource) Stats() KeySourceStats {
+	k.Mutex.Lock()
+	defer k.Mutex.Unlock()
+	return k.stats
+}
+
 // hasExpired indicates whether the cache has expired.
 func (k *httpKeySource) hasExpired() bool {
 	return k.Clock.Now().After(k.ExpiryTime)
 }
 
-func (k *httpKeySource) refreshKeys() error {
-	k.CachedKeys = nil
-	resp, err := k.HTTPClient.Get(k.KeyURI)
+// refreshKeys fetches the keys from the remote server. Unless force is set, the keys are not
+// fetched if another caller has refreshed them while this caller was waiting for its turn. On
+// failure the previously cached keys are retained. The fetch is cancelled when ctx is done.
+func (k *httpKeySource) refreshKeys(ctx context.Context, force bool) error {
+	k.fetchMutex.Lock()
+	defer k.fetchMutex.Unlock()
+
+	k.Mutex.Lock()
+	if !force && len(k.CachedKeys) > 0 && !k.hasExpired() {
+		k.Mutex.Unlock()
+		return nil
+	}
+	k.refreshing = true
+	k.Mutex.Unlock()
+
+	keys, maxAge, err := k.fetchKeys(ctx)
+
+	k.Mutex.Lock()
+	defer k.Mutex.Unlock()
+	k.refreshing = false
 	if err != nil {
+		k.stats.RefreshErrors++
 		return err
 	}
+	k.stats.Refreshes++
+	k.stats.LastRefresh = k.Clock.Now()
+	k.CachedKeys = keys
+	k.ExpiryTime = k.stats.LastRefresh.Add(maxAge)
+	return nil
+}
+
+func (k *httpKeySource) fetchKeys(ctx context.Context) ([]*PublicKey, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, k.KeyURI, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := k.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
 	defer resp.Body.Close()
 	contents, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("failed to fetch public keys; http status: %d", resp.StatusCode)
 	}
 
-	newKeys, err := parsePublicKeys(contents)
+	newKeys, err := k.parse(contents)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
 
 	maxAge, err := findMaxAge(resp)
 	if err != nil {
-		return err
+		if k.defaultMaxAge == 0 {
+			return nil, 0, err
+		}
+		maxAge = &k.defaultMaxAge
 	}
-
-	k.CachedKeys = append([]*publicKey(nil), newKeys...)
-	k.ExpiryTime = k.Clock.Now().Add(*maxAge)
-	return nil
+	return append([]*PublicKey(nil), newKeys...), *maxAge, nil
 }
 
 func findMaxAge(resp *http.Response) (*time.Duration, error) {
@@ -147,14 +307,14 @@ func findMaxAge(resp *http.Response) (*time.Duration, error) {
 	return nil, errors.New("Could not find expiry time from HTTP headers")
 }
 
-func parsePublicKeys(keys []byte) ([]*publicKey, error) {
+func parsePublicKeys(keys []byte) ([]*PublicKey, error) {
 	m := make(map[string]string)
 	err := json.Unmarshal(keys, &m)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []*publicKey
+	var result []*PublicKey
 	for kid, key := range m {
 		pubKey, err := parsePublicKey(kid, []byte(key))
 		if err != nil {
@@ -165,7 +325,7 @@ func parsePublicKeys(keys []byte) ([]*publicKey, error) {
 	return result, nil
 }
 
-func parsePublicKey(kid string, key []byte) (*publicKey, error) {
+func parsePublicKey(kid string, key []byte) (*PublicKey, error) {
 	block, _ := pem.Decode(key)
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
@@ -175,38 +335,143 @@ func parsePublicKey(kid string, key []byte) (*publicKey, error) {
 	if !ok {
 		return nil, errors.New("Certificate is not a RSA key")
 	}
-	return &publicKey{kid, pk}, nil
+	return &PublicKey{Kid: kid, Key: pk}, nil
 }
 
-func verifySignature(parts []string, k *publicKey) error {
-	content := parts[0] + "." + parts[1]
-	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
-	if err != nil {
-		return err
+// ParseJWKS parses the public keys in the given JSON Web Key Set.
+//
+// RSA keys and EC keys on the P-256, P-384 and P-521 curves are supported. Keys of other types,
+// and keys whose 'use' parameter indicates that they are not meant for verifying signatures,
+// are ignored.
+func ParseJWKS(b []byte) ([]*PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, err
 	}
 
-	h := sha256.New()
-	h.Write([]byte(content))
-	return rsa.VerifyPKCS1v15(k.Key, crypto.SHA256, h.Sum(nil), []byte(signature))
+	var result []*PublicKey
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		switch jwk.Kty {
+		case "RSA":
+			n, err := decodeBigInt(jwk.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeBigInt(jwk.E)
+			if err != nil {
+				return nil, err
+			}
+			if !e.IsInt64() || e.Int64() <= 1 || e.Int64() > 1<<31-1 {
+				return nil, fmt.Errorf("invalid exponent in public key %q", jwk.Kid)
+			}
+			key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return nil, fmt.Errorf("unsupported curve %q in public key %q", jwk.Crv, jwk.Kid)
+			}
+			x, err := decodeBigInt(jwk.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := decodeBigInt(jwk.Y)
+			if err != nil {
+				return nil, err
+			}
+			if !curve.IsOnCurve(x, y) {
+				return nil, fmt.Errorf("invalid point in public key %q", jwk.Kid)
+			}
+			key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		default:
+			continue
+		}
+		result = append(result, &PublicKey{Kid: jwk.Kid, Algorithm: jwk.Alg, Key: key})
+	}
+	if len(result) == 0 {
+		return nil, errors.New("no signature verification keys found in the key set")
+	}
+	return result, nil
 }
 
-type serviceAcctSigner struct {
-	email string
-	pk    *rsa.PrivateKey
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
 }
 
-func (s serviceAcctSigner) Email() (string, error) {
-	if s.email == "" {
-		return "", errors.New("service account email not available")
+// verifySignature verifies the signature of a JWT, split into its three parts, using the given
+// signing algorithm and public key.
+func verifySignature(parts []string, alg string, k *PublicKey) error {
+	if k.Algorithm != "" && k.Algorithm != alg {
+		return fmt.Errorf("key %q cannot be used with algorithm %q", k.Kid, alg)
+	}
+	content := parts[0] + "." + parts[1]
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
 	}
-	return s.email, nil
-}
 
-func (s serviceAcctSigner) Sign(ss []byte) ([]byte, error) {
-	if s.pk == nil {
-		return nil, errors.New("private key not available")
+	switch key := k.Key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return fmt.Errorf("algorithm %q cannot be used with an RSA key", alg)
+		}
+		h := sha256.Sum256([]byte(content))
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], signature)
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch {
+		case alg == "ES256" && key.Curve == elliptic.P256():
+			h := sha256.Sum256([]byte(content))
+			digest = h[:]
+		case alg == "ES384" && key.Curve == elliptic.P384():
+			h := sha512.Sum384([]byte(content))
+			digest = h[:]
+		case alg == "ES512" && key.Curve == elliptic.P521():
+			h := sha512.Sum512([]byte(content))
+			digest = h[:]
+		default:
+			return fmt.Errorf("algorithm %q cannot be used with the EC key %q", alg, k.Kid)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T", k.Key)
 	}
-	hash := sha256.New()
-	hash.Write([]byte(ss))
-	return rsa.SignPKCS1v15(rand.Reader, s.pk, crypto.SHA256, hash.Sum(nil))
 }
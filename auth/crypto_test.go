@@ -15,13 +15,26 @@
 package auth
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"testing"
 	"time"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
 )
 
 type mockHTTPResponse struct {
@@ -205,16 +218,323 @@ func TestParsePublicKeysError(t *testing.T) {
 	}
 }
 
-func TestDefaultServiceAcctSigner(t *testing.T) {
-	signer := &serviceAcctSigner{}
-	if email, err := signer.Email(); email != "" || err == nil {
-		t.Errorf("Email() = (%v, %v); want = ('', error)", email, err)
+func TestJWKSKeySource(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []interface{}{
+			rsaJWK("rsa-key", &rsaKey.PublicKey),
+			ecJWK("ec-key", &ecKey.PublicKey),
+			map[string]string{"kty": "RSA", "kid": "enc-key", "use": "enc"},
+			map[string]string{"kty": "oct", "kid": "secret-key", "k": "c2VjcmV0"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc, rc := newTestHTTPClient(jwks)
+	ks := NewJWKSKeySource("http://mock.url", hc)
+	keys, err := ks.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Keys() = %d; want = 2", len(keys))
+	}
+	if pk, ok := keys[0].Key.(*rsa.PublicKey); !ok || keys[0].Kid != "rsa-key" ||
+		keys[0].Algorithm != "RS256" || pk.N.Cmp(rsaKey.N) != 0 || pk.E != rsaKey.E {
+		t.Errorf("Keys()[0] = %#v; want = rsa-key", keys[0])
+	}
+	if pk, ok := keys[1].Key.(*ecdsa.PublicKey); !ok || keys[1].Kid != "ec-key" ||
+		keys[1].Algorithm != "ES256" || pk.X.Cmp(ecKey.X) != 0 || pk.Y.Cmp(ecKey.Y) != 0 {
+		t.Errorf("Keys()[1] = %#v; want = ec-key", keys[1])
+	}
+
+	if _, err := ks.Keys(); err != nil {
+		t.Fatal(err)
+	}
+	if rc.closeCount != 1 {
+		t.Errorf("HTTP calls = %d; want = 1", rc.closeCount)
+	}
+}
+
+func TestJWKSKeySourceDefaultMaxAge(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []interface{}{rsaJWK("rsa-key", &rsaKey.PublicKey)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hc, _ := newTestHTTPClient(jwks)
+	hc.Transport.(*mockHTTPResponse).Response.Header = http.Header{}
+	ks := NewJWKSKeySource("http://mock.url", hc).(*httpKeySource)
+	ks.Clock = &mockClock{now: time.Unix(0, 0)}
+	if _, err := ks.Keys(); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(0, 0).Add(defaultJWKSMaxAge); ks.ExpiryTime != want {
+		t.Errorf("ExpiryTime = %v; want = %v", ks.ExpiryTime, want)
+	}
+}
+
+func TestHTTPKeySourceErrorStatus(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc, _ := newTestHTTPClient(data)
+	hc.Transport.(*mockHTTPResponse).Response.StatusCode = http.StatusInternalServerError
+	ks := newHTTPKeySource("http://mock.url", hc)
+	if keys, err := ks.Keys(); keys != nil || err == nil {
+		t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
+	}
+}
+
+func TestParseJWKSError(t *testing.T) {
+	cases := []string{
+		"",
+		"not-json",
+		`{"keys": []}`,
+		`{"keys": [{"kty": "oct", "kid": "k"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "use": "enc", "n": "AQAB", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "n": "!!", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "n": "AQAB", "e": "AQ"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "k", "n": "", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "EC", "kid": "k", "crv": "P-192", "x": "AQ", "y": "AQ"}]}`,
+		`{"keys": [{"kty": "EC", "kid": "k", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+	}
+	for _, tc := range cases {
+		if keys, err := ParseJWKS([]byte(tc)); keys != nil || err == nil {
+			t.Errorf("ParseJWKS(%q) = (%v, %v); want = (nil, error)", tc, keys, err)
+		}
+	}
+}
+
+func TestStaticKeySource(t *testing.T) {
+	want := []*PublicKey{{Kid: "key1"}, {Kid: "key2"}}
+	ks := NewStaticKeySource(want...)
+	keys, err := ks.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("Keys() = %v; want = %v", keys, want)
+	}
+
+	if keys, err := NewStaticKeySource().Keys(); keys != nil || err == nil {
+		t.Errorf("Keys() = (%v, %v); want = (nil, error)", keys, err)
+	}
+}
+
+func TestVerifyIDTokenWithStaticKeySource(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(context.Background(), &internal.AuthConfig{
+		Opts:      defaultTestOpts,
+		ProjectID: "mock-project-id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetKeySource(NewStaticKeySource(
+		&PublicKey{Kid: "ec-key", Algorithm: "ES256", Key: &ecKey.PublicKey},
+		&PublicKey{Kid: "rsa-key", Key: &rsaKey.PublicKey},
+	))
+
+	payload := mockIDTokenPayload{
+		"aud": "mock-project-id",
+		"iss": "https://securetoken.google.com/mock-project-id",
+		"iat": time.Now().Unix() - 100,
+		"exp": time.Now().Unix() + 3600,
+		"sub": "1234567890",
+	}
+	ecToken, err := encodeToken(context.Background(), ecSigner{ecKey}, jwtHeader{Algorithm: "ES256", Type: "JWT", KeyID: "ec-key"}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := c.VerifyIDToken(ecToken); err != nil || tok.UID != "1234567890" {
+		t.Errorf("VerifyIDToken(ES256) = (%v, %v); want = (token, nil)", tok, err)
+	}
+
+	rsaToken, err := encodeToken(context.Background(), internal.NewServiceAccountSigner("", rsaKey), jwtHeader{Algorithm: "RS256", Type: "JWT", KeyID: "rsa-key"}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := c.VerifyIDToken(rsaToken); err != nil || tok.UID != "1234567890" {
+		t.Errorf("VerifyIDToken(RS256) = (%v, %v); want = (token, nil)", tok, err)
+	}
+
+	// An RS256 token presented under the kid of the EC key must not verify.
+	mismatched, err := encodeToken(context.Background(), internal.NewServiceAccountSigner("", rsaKey), jwtHeader{Algorithm: "RS256", Type: "JWT", KeyID: "ec-key"}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok, err := c.VerifyIDToken(mismatched); tok != nil || err == nil {
+		t.Errorf("VerifyIDToken(mismatched) = (%v, %v); want = (nil, error)", tok, err)
+	}
+}
+
+func TestVerifyIDTokenLargerCurves(t *testing.T) {
+	c, err := NewClient(context.Background(), &internal.AuthConfig{
+		Opts:      defaultTestOpts,
+		ProjectID: "mock-project-id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := mockIDTokenPayload{
+		"aud": "mock-project-id",
+		"iss": "https://securetoken.google.com/mock-project-id",
+		"iat": time.Now().Unix() - 100,
+		"exp": time.Now().Unix() + 3600,
+		"sub": "1234567890",
+	}
+	cases := []struct {
+		alg   string
+		curve elliptic.Curve
+	}{
+		{"ES384", elliptic.P384()},
+		{"ES512", elliptic.P521()},
+	}
+	for _, tc := range cases {
+		ecKey, err := ecdsa.GenerateKey(tc.curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetKeySource(NewStaticKeySource(&PublicKey{Kid: "ec-key", Algorithm: tc.alg, Key: &ecKey.PublicKey}))
+		h := jwtHeader{Algorithm: tc.alg, Type: "JWT", KeyID: "ec-key"}
+		token, err := encodeToken(context.Background(), ecSigner{ecKey}, h, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok, err := c.VerifyIDToken(token); err != nil || tok.UID != "1234567890" {
+			t.Errorf("VerifyIDToken(%s) = (%v, %v); want = (token, nil)", tc.alg, tok, err)
+		}
+	}
+}
+
+func TestVerifySignatureKeyMismatch(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := []string{"e30", "e30", ""}
+	cases := []struct {
+		alg string
+		key *PublicKey
+	}{
+		{"ES256", &PublicKey{Kid: "k", Key: &ecKey.PublicKey}},
+		{"RS256", &PublicKey{Kid: "k", Key: &ecKey.PublicKey}},
+		{"ES384", &PublicKey{Kid: "k", Algorithm: "ES256", Key: &ecKey.PublicKey}},
+		{"ES384", &PublicKey{Kid: "k", Key: &ecKey.PublicKey}},
+		{"RS256", &PublicKey{Kid: "k", Key: "not a key"}},
+	}
+	for _, tc := range cases {
+		if err := verifySignature(parts, tc.alg, tc.key); err == nil {
+			t.Errorf("verifySignature(%q, %v) = nil; want = error", tc.alg, tc.key)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	ctx := context.Background()
+	if err := VerifySignature(ctx, testIDToken, client.ks); err != nil {
+		t.Errorf("VerifySignature() = %v; want = nil", err)
 	}
-	if sig, err := signer.Sign([]byte("")); sig != nil || err == nil {
-		t.Errorf("Sign() = (%v, %v); want = ('', error)", sig, err)
+
+	for _, token := range []string{"foo.bar", getIDTokenWithKid("", nil), getIDTokenWithKid("unknown", nil)} {
+		if err := VerifySignature(ctx, token, client.ks); err == nil {
+			t.Errorf("VerifySignature(%q) = nil; want = error", token)
+		}
+	}
+
+	ks := &mockKeySource{nil, errors.New("mock error")}
+	if err := VerifySignature(ctx, testIDToken, ks); err == nil {
+		t.Error("VerifySignature() = nil; want = error")
+	} else if _, ok := err.(*BackendError); !ok {
+		t.Errorf("VerifySignature() = %v; want = BackendError", err)
 	}
 }
 
+// ecSigner signs JWTs with the ES256, ES384 or ES512 algorithm, depending on the curve of its
+// key.
+type ecSigner struct {
+	pk *ecdsa.PrivateKey
+}
+
+func (s ecSigner) Email() (string, error) {
+	return "", errors.New("email not available")
+}
+
+func (s ecSigner) Sign(ctx context.Context, b []byte) ([]byte, error) {
+	var digest []byte
+	switch s.pk.Curve {
+	case elliptic.P384():
+		h := sha512.Sum384(b)
+		digest = h[:]
+	case elliptic.P521():
+		h := sha512.Sum512(b)
+		digest = h[:]
+	default:
+		h := sha256.Sum256(b)
+		digest = h[:]
+	}
+	r, ss, err := ecdsa.Sign(rand.Reader, s.pk, digest)
+	if err != nil {
+		return nil, err
+	}
+	size := (s.pk.Curve.Params().BitSize + 7) / 8
+	return append(padBytes(r, size), padBytes(ss, size)...), nil
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	x := padBytes(key.X, 32)
+	y := padBytes(key.Y, 32)
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"alg": "ES256",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+// padBytes returns the big-endian representation of i, left-padded with zeros to size bytes.
+func padBytes(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
 func verifyHTTPKeySource(ks *httpKeySource, rc *mockReadCloser) error {
 	mc := &mockClock{now: time.Unix(0, 0)}
 	ks.Clock = mc
@@ -0,0 +1,352 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/identitytoolkit/v3"
+)
+
+const (
+	maxClaimsUpdateAttempts = 5
+	defaultBatchConcurrency = 10
+)
+
+// ClaimsSizeError is returned when an update would make the serialized custom claims of a user
+// larger than the 1000 characters allowed by the backend.
+type ClaimsSizeError struct {
+	// Size is the length of the serialized claims that would have resulted from the update.
+	Size int
+
+	// Keys are the names of the claims added or grown by the update, from the one that grew the
+	// payload the most to the one that grew it the least.
+	Keys []string
+}
+
+func (e *ClaimsSizeError) Error() string {
+	return fmt.Sprintf("serialized custom claims must not exceed %d characters; got %d after updating claims %q",
+		maxLenPayloadCC, e.Size, strings.Join(e.Keys, ", "))
+}
+
+// MergeCustomUserClaims merges the given claims into the existing custom claims of a user.
+//
+// Claims in patch replace the existing claims of the same name, and claims with a nil value
+// are removed. Other existing claims are left as they are. If the merged claims would exceed the
+// size limit, a *ClaimsSizeError naming the offending claims is returned, and the user is not
+// updated.
+//
+// Claim values must be of the types accepted by CustomTokenWithOptions.
+//
+// The update is NOT atomic, and concurrent updates are not detected. The Identity Toolkit API
+// offers no precondition or version for the custom claims of a user, so an update made by
+// another caller between the read and the write of the claims is overwritten without an error,
+// and no client-side check can rule this out. MergeCustomUserClaims only guarantees that its own
+// patch is present right after it returns: the claims are read back after the write, and the
+// patch is applied again if a later update has discarded it. Services that update the claims
+// of the same users must serialize those updates themselves, for example with a lock per user.
+func (c *Client) MergeCustomUserClaims(ctx context.Context, uid string, patch map[string]interface{}) error {
+	if err := validateUID(uid); err != nil {
+		return err
+	}
+	if len(patch) == 0 {
+		return errors.New("claims to merge must not be empty")
+	}
+	if err := validateDeveloperClaimNames(patch); err != nil {
+		return err
+	}
+	// Nil values delete claims. The size of the claims is checked once they are merged, so that
+	// the claims that exceed the limit can be reported.
+	set := make(map[string]interface{}, len(patch))
+	for k, v := range patch {
+		if v != nil {
+			set[k] = v
+		}
+	}
+	if err := validateDeveloperClaimTypes(set); err != nil {
+		return err
+	}
+	return c.patchCustomClaimsBestEffort(ctx, uid, patch)
+}
+
+// RemoveCustomUserClaims removes the custom claims with the given names from a user, leaving
+// the other custom claims of the user as they are.
+//
+// Claims that the user does not have are ignored. Like MergeCustomUserClaims, the update is a
+// best-effort read-modify-write cycle that is not atomic.
+func (c *Client) RemoveCustomUserClaims(ctx context.Context, uid string, keys ...string) error {
+	if err := validateUID(uid); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return errors.New("claims to remove must not be empty")
+	}
+	patch := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		patch[k] = nil
+	}
+	return c.patchCustomClaimsBestEffort(ctx, uid, patch)
+}
+
+// patchCustomClaimsBestEffort applies patch to the claims of the user, and reapplies it when the
+// claims read back after the write do not match the written ones. It cannot detect updates made
+// between its read and its write, which are lost.
+func (c *Client) patchCustomClaimsBestEffort(ctx context.Context, uid string, patch map[string]interface{}) error {
+	for i := 0; i < maxClaimsUpdateAttempts; i++ {
+		u, err := c.GetUser(ctx, uid)
+		if err != nil {
+			return err
+		}
+		claims := applyClaimsPatch(u.CustomClaims, patch)
+		if claimsEqual(claims, u.CustomClaims) {
+			return nil
+		}
+		if err := checkClaimsSize(u.CustomClaims, claims, patch); err != nil {
+			return err
+		}
+		if err := c.SetCustomUserClaims(ctx, uid, claims); err != nil {
+			return err
+		}
+
+		u, err = c.GetUser(ctx, uid)
+		if err != nil {
+			return err
+		}
+		if claimsEqual(claims, u.CustomClaims) {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update the custom claims of user %q: claims overwritten after %d attempts",
+		uid, maxClaimsUpdateAttempts)
+}
+
+func applyClaimsPatch(claims, patch map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(claims)+len(patch))
+	for k, v := range claims {
+		result[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(result, k)
+		} else {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// claimsEqual reports whether two sets of claims serialize to the same JSON. Claims read from
+// the backend hold numbers as float64, so comparing the serialized form is more reliable than
+// comparing the values.
+func claimsEqual(a, b map[string]interface{}) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+func checkClaimsSize(old, claims, patch map[string]interface{}) error {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	if len(b) <= maxLenPayloadCC {
+		return nil
+	}
+
+	growth := make(map[string]int)
+	var keys []string
+	for k, v := range patch {
+		if v == nil {
+			continue
+		}
+		if g := claimSize(k, v) - claimSize(k, old[k]); g > 0 {
+			growth[k] = g
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if growth[keys[i]] != growth[keys[j]] {
+			return growth[keys[i]] > growth[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return &ClaimsSizeError{Size: len(b), Keys: keys}
+}
+
+// claimSize returns the number of characters the claim adds to the serialized claims, including
+// the separator. A nil value adds nothing.
+func claimSize(k string, v interface{}) int {
+	if v == nil {
+		return 0
+	}
+	kb, _ := json.Marshal(k)
+	vb, _ := json.Marshal(v)
+	return len(kb) + len(vb) + 2
+}
+
+// ClaimsBatchOptions configures a SetCustomUserClaimsBatch job.
+type ClaimsBatchOptions struct {
+	// Concurrency is the maximum number of updates in flight at any time. Defaults to 10.
+	Concurrency int
+
+	// QPS is the maximum number of updates started per second. Zero means no limit.
+	QPS float64
+}
+
+// ClaimsBatchResult reports the outcome of a SetCustomUserClaimsBatch job.
+type ClaimsBatchResult struct {
+	SuccessCount int
+	FailureCount int
+
+	// Errors maps the UIDs of the users that could not be updated to the cause of the failure.
+	Errors map[string]error
+}
+
+// SetCustomUserClaimsBatch sets the custom claims of many users, as SetCustomUserClaims would
+// for each of them.
+//
+// The claims of every user are validated before any update is made, and invalid ones are
+// reported without being sent to the backend. Updates then run with at most opts.Concurrency in
+// flight, and are started no faster than opts.QPS per second, so that large jobs stay within the
+// backend quota. The outcome for each user is reported in the returned result. If ctx is
+// cancelled, the updates that have not been made yet are reported as failed with the context
+// error. An error is returned only if opts are invalid.
+func (c *Client) SetCustomUserClaimsBatch(ctx context.Context, claims map[string]map[string]interface{}, opts *ClaimsBatchOptions) (*ClaimsBatchResult, error) {
+	return c.setCustomUserClaimsBatch(ctx, claims, opts, newBatchTicker)
+}
+
+// batchTicker returns a channel that receives a value every d, and a function that stops the
+// ticker. It is replaced in tests to control when updates are started.
+type batchTicker func(d time.Duration) (<-chan time.Time, func())
+
+func newBatchTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+func (c *Client) setCustomUserClaimsBatch(
+	ctx context.Context, claims map[string]map[string]interface{}, opts *ClaimsBatchOptions,
+	ticker batchTicker) (*ClaimsBatchResult, error) {
+	if opts == nil {
+		opts = &ClaimsBatchOptions{}
+	}
+	if opts.Concurrency < 0 || opts.QPS < 0 {
+		return nil, errors.New("concurrency and qps must not be negative")
+	}
+	concurrency := opts.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	result := &ClaimsBatchResult{Errors: make(map[string]error)}
+	var mu sync.Mutex
+	report := func(uid string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			result.Errors[uid] = err
+			result.FailureCount++
+		} else {
+			result.SuccessCount++
+		}
+	}
+
+	uids := make([]string, 0, len(claims))
+	for uid := range claims {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	type update struct {
+		uid  string
+		user *UserToUpdate
+	}
+	var updates []*update
+	for _, uid := range uids {
+		cc := claims[uid]
+		if cc == nil {
+			cc = map[string]interface{}{}
+		}
+		u := (&UserToUpdate{}).CustomClaims(cc)
+		err := validateUID(uid)
+		if err == nil {
+			err = u.preparePayload(&identitytoolkit.IdentitytoolkitRelyingpartySetAccountInfoRequest{})
+		}
+		if err != nil {
+			report(uid, err)
+			continue
+		}
+		updates = append(updates, &update{uid: uid, user: u})
+	}
+
+	var tick <-chan time.Time
+	if opts.QPS > 0 {
+		var stop func()
+		tick, stop = ticker(time.Duration(float64(time.Second) / opts.QPS))
+		defer stop()
+	}
+
+	jobs := make(chan *update)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				report(u.uid, c.updateUser(ctx, u.uid, u.user))
+			}
+		}()
+	}
+
+	for i, u := range updates {
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() == nil {
+			select {
+			case jobs <- u:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		for _, u := range updates[i:] {
+			report(u.uid, ctx.Err())
+		}
+		break
+	}
+	close(jobs)
+	wg.Wait()
+	return result, nil
+}
@@ -0,0 +1,398 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// claimsServer is a mock backend that stores the custom claims of a single user.
+type claimsServer struct {
+	mu     sync.Mutex
+	claims string
+	sets   int
+	// onSet is called after each update of the claims, to simulate updates made by others.
+	onSet func(s *claimsServer)
+	srv   *httptest.Server
+}
+
+func newClaimsServer(t *testing.T, claims string) (*claimsServer, *Client) {
+	cs := &claimsServer{claims: claims}
+	cs.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		var resp interface{}
+		if strings.HasSuffix(r.URL.Path, "setAccountInfo") {
+			var req struct {
+				CustomAttributes string `json:"customAttributes"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			cs.claims = req.CustomAttributes
+			cs.sets++
+			if cs.onSet != nil {
+				cs.onSet(cs)
+			}
+			resp = map[string]string{"localId": "user1"}
+		} else {
+			resp = map[string]interface{}{
+				"users": []map[string]string{{"localId": "user1", "customAttributes": cs.claims}},
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+
+	s := echoServer(nil, t)
+	s.Close()
+	s.Client.is.BasePath = cs.srv.URL + "/"
+	return cs, s.Client
+}
+
+func (cs *claimsServer) decoded(t *testing.T) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(cs.claims), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMergeCustomUserClaims(t *testing.T) {
+	cs, client := newClaimsServer(t, `{"admin": true, "level": 1}`)
+	defer cs.srv.Close()
+
+	patch := map[string]interface{}{"level": 2, "team": "blue", "admin": nil}
+	if err := client.MergeCustomUserClaims(context.Background(), "user1", patch); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"level": 2.0, "team": "blue"}
+	if got := cs.decoded(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeCustomUserClaims() = %v; want = %v", got, want)
+	}
+
+	// Merging claims the user already has does not update the user.
+	if err := client.MergeCustomUserClaims(context.Background(), "user1", map[string]interface{}{"level": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if cs.sets != 1 {
+		t.Errorf("MergeCustomUserClaims() updates = %d; want = 1", cs.sets)
+	}
+}
+
+func TestRemoveCustomUserClaims(t *testing.T) {
+	cs, client := newClaimsServer(t, `{"admin": true, "level": 1, "team": "blue"}`)
+	defer cs.srv.Close()
+
+	if err := client.RemoveCustomUserClaims(context.Background(), "user1", "admin", "team", "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"level": 1.0}
+	if got := cs.decoded(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("RemoveCustomUserClaims() = %v; want = %v", got, want)
+	}
+
+	if err := client.RemoveCustomUserClaims(context.Background(), "user1", "level"); err != nil {
+		t.Fatal(err)
+	}
+	if cs.claims != "{}" {
+		t.Errorf("RemoveCustomUserClaims() = %q; want = %q", cs.claims, "{}")
+	}
+}
+
+func TestMergeCustomUserClaimsReappliedAfterOverwrite(t *testing.T) {
+	cs, client := newClaimsServer(t, `{"admin": true}`)
+	defer cs.srv.Close()
+
+	// Another service overwrites the claims right after the first update.
+	cs.onSet = func(s *claimsServer) {
+		if s.sets == 1 {
+			s.claims = `{"admin": true, "other": "value"}`
+		}
+	}
+	if err := client.MergeCustomUserClaims(context.Background(), "user1", map[string]interface{}{"team": "blue"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"admin": true, "other": "value", "team": "blue"}
+	if got := cs.decoded(t); !reflect.DeepEqual(got, want) || cs.sets != 2 {
+		t.Errorf("MergeCustomUserClaims() = (%v, %d updates); want = (%v, 2 updates)", got, cs.sets, want)
+	}
+
+	// Claims are overwritten after every update.
+	cs.onSet = func(s *claimsServer) {
+		s.claims = `{"other": "value"}`
+	}
+	if err := client.MergeCustomUserClaims(context.Background(), "user1", map[string]interface{}{"team": "red"}); err == nil {
+		t.Errorf("MergeCustomUserClaims() = nil; want = error")
+	}
+}
+
+func TestMergeCustomUserClaimsTooLarge(t *testing.T) {
+	cs, client := newClaimsServer(t, `{"a": "`+strings.Repeat("a", 500)+`", "b": "short"}`)
+	defer cs.srv.Close()
+
+	patch := map[string]interface{}{
+		"a": "shorter",
+		"b": strings.Repeat("b", 300),
+		"c": strings.Repeat("c", 700),
+		"d": 1,
+	}
+	err := client.MergeCustomUserClaims(context.Background(), "user1", patch)
+	se, ok := err.(*ClaimsSizeError)
+	if !ok {
+		t.Fatalf("MergeCustomUserClaims() = %v; want = ClaimsSizeError", err)
+	}
+	if want := []string{"c", "b", "d"}; !reflect.DeepEqual(se.Keys, want) {
+		t.Errorf("ClaimsSizeError.Keys = %v; want = %v", se.Keys, want)
+	}
+	if se.Size <= maxLenPayloadCC {
+		t.Errorf("ClaimsSizeError.Size = %d; want > %d", se.Size, maxLenPayloadCC)
+	}
+	if cs.sets != 0 {
+		t.Errorf("MergeCustomUserClaims() updates = %d; want = 0", cs.sets)
+	}
+}
+
+func TestInvalidMergeCustomUserClaims(t *testing.T) {
+	cs, client := newClaimsServer(t, `{}`)
+	defer cs.srv.Close()
+
+	cases := []struct {
+		uid   string
+		patch map[string]interface{}
+	}{
+		{"", map[string]interface{}{"a": 1}},
+		{"user1", nil},
+		{"user1", map[string]interface{}{"sub": "other"}},
+		{"user1", map[string]interface{}{"ch": make(chan int)}},
+		{"user1", map[string]interface{}{"since": time.Unix(0, 0)}},
+		{"user1", map[string]interface{}{"roles": []string{"admin"}}},
+	}
+	for _, tc := range cases {
+		if err := client.MergeCustomUserClaims(context.Background(), tc.uid, tc.patch); err == nil {
+			t.Errorf("MergeCustomUserClaims(%q, %v) = nil; want = error", tc.uid, tc.patch)
+		}
+	}
+	if err := client.RemoveCustomUserClaims(context.Background(), "user1"); err == nil {
+		t.Errorf("RemoveCustomUserClaims() = nil; want = error")
+	}
+	if err := client.RemoveCustomUserClaims(context.Background(), "", "a"); err == nil {
+		t.Errorf("RemoveCustomUserClaims() = nil; want = error")
+	}
+}
+
+// batchServer is a mock backend for SetCustomUserClaimsBatch. The UID of every update is sent on
+// started when the update arrives, and the update is held until release is closed.
+type batchServer struct {
+	srv       *httptest.Server
+	started   chan string
+	release   chan struct{}
+	mu        sync.Mutex
+	updated   map[string]string
+	active    int
+	maxActive int
+}
+
+func newBatchServer(t *testing.T, size int) (*batchServer, *Client) {
+	bs := &batchServer{
+		started: make(chan string, size),
+		release: make(chan struct{}),
+		updated: map[string]string{},
+	}
+	bs.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			LocalID          string `json:"localId"`
+			CustomAttributes string `json:"customAttributes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bs.mu.Lock()
+		bs.active++
+		if bs.active > bs.maxActive {
+			bs.maxActive = bs.active
+		}
+		bs.mu.Unlock()
+		bs.started <- req.LocalID
+		<-bs.release
+		bs.mu.Lock()
+		bs.active--
+		bs.updated[req.LocalID] = req.CustomAttributes
+		bs.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if req.LocalID == "missing" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"message": "USER_NOT_FOUND"}}`))
+			return
+		}
+		w.Write([]byte(`{"localId": "` + req.LocalID + `"}`))
+	}))
+	s := echoServer(nil, t)
+	s.Close()
+	s.Client.is.BasePath = bs.srv.URL + "/"
+	return bs, s.Client
+}
+
+// waitStarted waits for the next update to arrive at the server.
+func (bs *batchServer) waitStarted(t *testing.T) {
+	select {
+	case <-bs.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("update not started")
+	}
+}
+
+func TestSetCustomUserClaimsBatch(t *testing.T) {
+	claims := map[string]map[string]interface{}{
+		"missing":  {"admin": true},
+		"reserved": {"sub": "other"},
+		"cleared":  nil,
+		"":         {"admin": true},
+	}
+	for i := 0; i < 20; i++ {
+		claims[fmt.Sprintf("user%d", i)] = map[string]interface{}{"role": i}
+	}
+	bs, client := newBatchServer(t, len(claims))
+	defer bs.srv.Close()
+
+	type batchResult struct {
+		result *ClaimsBatchResult
+		err    error
+	}
+	done := make(chan batchResult)
+	go func() {
+		result, err := client.SetCustomUserClaimsBatch(context.Background(), claims, &ClaimsBatchOptions{Concurrency: 3})
+		done <- batchResult{result, err}
+	}()
+
+	// Hold the first updates until three are in flight, which is as many as Concurrency allows.
+	for i := 0; i < 3; i++ {
+		bs.waitStarted(t)
+	}
+	close(bs.release)
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	result := r.result
+	if result.SuccessCount != 21 || result.FailureCount != 3 || len(result.Errors) != 3 {
+		t.Errorf("SetCustomUserClaimsBatch() = %+v; want = 21 successes and 3 failures", result)
+	}
+	for _, uid := range []string{"missing", "reserved", ""} {
+		if result.Errors[uid] == nil {
+			t.Errorf("SetCustomUserClaimsBatch() error for %q = nil; want = error", uid)
+		}
+	}
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if _, ok := bs.updated["reserved"]; ok {
+		t.Errorf("SetCustomUserClaimsBatch() sent invalid claims to the backend")
+	}
+	if bs.updated["user7"] != `{"role":7}` || bs.updated["cleared"] != "{}" {
+		t.Errorf("SetCustomUserClaimsBatch() = (%q, %q); want = (%q, %q)",
+			bs.updated["user7"], bs.updated["cleared"], `{"role":7}`, "{}")
+	}
+	if bs.maxActive != 3 {
+		t.Errorf("SetCustomUserClaimsBatch() concurrency = %d; want = 3", bs.maxActive)
+	}
+}
+
+func TestSetCustomUserClaimsBatchQPS(t *testing.T) {
+	claims := map[string]map[string]interface{}{}
+	for i := 0; i < 5; i++ {
+		claims[fmt.Sprintf("user%d", i)] = map[string]interface{}{"role": i}
+	}
+	bs, client := newBatchServer(t, len(claims))
+	defer bs.srv.Close()
+	close(bs.release)
+
+	var interval time.Duration
+	tick := make(chan time.Time)
+	ticker := func(d time.Duration) (<-chan time.Time, func()) {
+		interval = d
+		return tick, func() {}
+	}
+	done := make(chan *ClaimsBatchResult)
+	go func() {
+		result, err := client.setCustomUserClaimsBatch(context.Background(), claims, &ClaimsBatchOptions{QPS: 50}, ticker)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+
+	// The first update starts right away, and each of the others waits for a tick.
+	bs.waitStarted(t)
+	for i := 1; i < 5; i++ {
+		select {
+		case tick <- time.Time{}:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("tick %d not consumed", i)
+		}
+		bs.waitStarted(t)
+	}
+	result := <-done
+	if result == nil || result.SuccessCount != 5 {
+		t.Errorf("SetCustomUserClaimsBatch() = %+v; want = 5 successes", result)
+	}
+	if interval != 20*time.Millisecond {
+		t.Errorf("SetCustomUserClaimsBatch() interval = %v; want = 20ms", interval)
+	}
+}
+
+func TestSetCustomUserClaimsBatchCancelled(t *testing.T) {
+	s := echoServer([]byte(`{"localId": "user"}`), t)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	claims := map[string]map[string]interface{}{
+		"user1": {"admin": true},
+		"user2": {"admin": true},
+	}
+	result, err := s.Client.SetCustomUserClaimsBatch(ctx, claims, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SuccessCount != 0 || result.FailureCount != 2 || result.Errors["user1"] != context.Canceled {
+		t.Errorf("SetCustomUserClaimsBatch() = %+v; want = 2 cancelled updates", result)
+	}
+}
+
+func TestSetCustomUserClaimsBatchError(t *testing.T) {
+	s := echoServer(nil, t)
+	defer s.Close()
+
+	for _, opts := range []*ClaimsBatchOptions{{Concurrency: -1}, {QPS: -1}} {
+		if result, err := s.Client.SetCustomUserClaimsBatch(context.Background(), nil, opts); result != nil || err == nil {
+			t.Errorf("SetCustomUserClaimsBatch(%+v) = (%v, %v); want = (nil, error)", opts, result, err)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+)
+
+// ExportFormat is the file format of a user export.
+type ExportFormat int
+
+const (
+	// ExportFormatJSON is the JSON format written by `firebase auth:export users.json`.
+	ExportFormatJSON ExportFormat = iota
+
+	// ExportFormatCSV is the CSV format written by `firebase auth:export users.csv`. Unlike the
+	// JSON format, it only includes the provider info of the google.com, facebook.com,
+	// twitter.com and github.com providers.
+	ExportFormatCSV
+)
+
+// csvProviders maps the IDs of the providers included in the CSV format to the index of their
+// first column. Each provider has four columns: ID, email, display name and photo URL.
+var csvProviders = map[string]int{
+	"google.com":   7,
+	"facebook.com": 11,
+	"twitter.com":  15,
+	"github.com":   19,
+}
+
+const csvColumns = 28
+
+var (
+	toStdBase64     = strings.NewReplacer("-", "+", "_", "/")
+	toWebSafeBase64 = strings.NewReplacer("+", "-", "/", "_")
+)
+
+type exportedUser struct {
+	LocalID          string             `json:"localId"`
+	Email            string             `json:"email,omitempty"`
+	EmailVerified    bool               `json:"emailVerified"`
+	PasswordHash     string             `json:"passwordHash,omitempty"`
+	Salt             string             `json:"salt,omitempty"`
+	DisplayName      string             `json:"displayName,omitempty"`
+	PhotoURL         string             `json:"photoUrl,omitempty"`
+	LastSignedInAt   string             `json:"lastSignedInAt,omitempty"`
+	CreatedAt        string             `json:"createdAt,omitempty"`
+	PhoneNumber      string             `json:"phoneNumber,omitempty"`
+	Disabled         bool               `json:"disabled"`
+	CustomAttributes string             `json:"customAttributes,omitempty"`
+	ProviderUserInfo []exportedProvider `json:"providerUserInfo"`
+}
+
+type exportedProvider struct {
+	ProviderID  string `json:"providerId"`
+	RawID       string `json:"rawId"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+	PhotoURL    string `json:"photoUrl,omitempty"`
+}
+
+// ExportUsers writes all the user accounts of the project to w, in the given format.
+//
+// The output has the same layout as the one written by the `firebase auth:export` command of the
+// Firebase CLI, and includes the password hashes and salts of the users. Users are fetched from
+// the client page by page, and written as they are fetched. Password hashes and salts are
+// written in standard base64 encoding, as the Firebase CLI does.
+func ExportUsers(ctx context.Context, c *Client, w io.Writer, format ExportFormat) error {
+	if format != ExportFormatJSON && format != ExportFormatCSV {
+		return fmt.Errorf("unsupported export format: %d", format)
+	}
+
+	bw := bufio.NewWriter(w)
+	var cw *csv.Writer
+	if format == ExportFormatJSON {
+		bw.WriteString("{\"users\": [")
+	} else {
+		cw = csv.NewWriter(bw)
+	}
+
+	it := c.Users(ctx, "")
+	for i := 0; ; i++ {
+		u, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		eu, err := newExportedUser(u)
+		if err != nil {
+			return err
+		}
+		if cw != nil {
+			err = cw.Write(eu.csvRecord())
+		} else {
+			var b []byte
+			if b, err = json.Marshal(eu); err == nil {
+				if i > 0 {
+					bw.WriteString(",")
+				}
+				bw.WriteString("\n  ")
+				_, err = bw.Write(b)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	} else {
+		bw.WriteString("\n]}\n")
+	}
+	return bw.Flush()
+}
+
+// ParseUserExport parses user accounts written by ExportUsers, or by the `firebase auth:export`
+// command of the Firebase CLI.
+//
+// Password hashes and salts are returned in the web-safe base64 encoding used by
+// ExportedUserRecord. Use ExportedUserRecord.UserToCreate to create the parsed users in a
+// project.
+func ParseUserExport(r io.Reader, format ExportFormat) ([]*ExportedUserRecord, error) {
+	var users []*exportedUser
+	switch format {
+	case ExportFormatJSON:
+		var export struct {
+			Users []*exportedUser `json:"users"`
+		}
+		if err := json.NewDecoder(r).Decode(&export); err != nil {
+			return nil, err
+		}
+		users = export.Users
+	case ExportFormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, rec := range records {
+			u, err := parseCSVRecord(rec)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			users = append(users, u)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported export format: %d", format)
+	}
+
+	var result []*ExportedUserRecord
+	for _, u := range users {
+		eu, err := u.exportedUserRecord()
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %v", u.LocalID, err)
+		}
+		result = append(result, eu)
+	}
+	return result, nil
+}
+
+// UserToCreate returns the parameters to create a copy of the user with CreateUser, for
+// example to import a user parsed by ParseUserExport into another project.
+//
+// The UID, profile, custom claims, timestamps and provider data of the user are copied. The
+// password and phone providers are omitted from the provider data, since they are derived from
+// the password hash and the phone number. The password hash of the user is only copied if config
+// is not nil, in which case config must be the hash configuration of the project the user was
+// exported from. Otherwise the copy has no password.
+func (u *ExportedUserRecord) UserToCreate(config *HashConfig) *UserToCreate {
+	user := (&UserToCreate{}).
+		UID(u.UID).
+		Disabled(u.Disabled).
+		EmailVerified(u.EmailVerified)
+	if u.Email != "" {
+		user.Email(u.Email)
+	}
+	if u.DisplayName != "" {
+		user.DisplayName(u.DisplayName)
+	}
+	if u.PhoneNumber != "" {
+		user.PhoneNumber(u.PhoneNumber)
+	}
+	if u.PhotoURL != "" {
+		user.PhotoURL(u.PhotoURL)
+	}
+	if len(u.CustomClaims) > 0 {
+		user.CustomClaims(u.CustomClaims)
+	}
+	if m := u.UserMetadata; m != nil {
+		if m.CreationTimestamp != 0 {
+			user.CreatedAt(time.Unix(0, m.CreationTimestamp*int64(time.Millisecond)))
+		}
+		if m.LastLogInTimestamp != 0 {
+			user.LastLoginAt(time.Unix(0, m.LastLogInTimestamp*int64(time.Millisecond)))
+		}
+	}
+
+	var providers []*UserInfo
+	for _, p := range u.ProviderUserInfo {
+		if p.ProviderID != "password" && p.ProviderID != "phone" {
+			providers = append(providers, p)
+		}
+	}
+	if len(providers) > 0 {
+		user.ProviderData(providers...)
+	}
+	if config != nil && u.PasswordHash != "" {
+		user.PasswordHash(u.PasswordHash, u.PasswordSalt, *config)
+	}
+	return user
+}
+
+func newExportedUser(u *ExportedUserRecord) (*exportedUser, error) {
+	eu := &exportedUser{
+		LocalID:          u.UID,
+		Email:            u.Email,
+		EmailVerified:    u.EmailVerified,
+		PasswordHash:     toStdBase64.Replace(u.PasswordHash),
+		Salt:             toStdBase64.Replace(u.PasswordSalt),
+		DisplayName:      u.DisplayName,
+		PhotoURL:         u.PhotoURL,
+		PhoneNumber:      u.PhoneNumber,
+		Disabled:         u.Disabled,
+		ProviderUserInfo: []exportedProvider{},
+	}
+	if u.UserMetadata != nil {
+		eu.CreatedAt = formatTimestamp(u.UserMetadata.CreationTimestamp)
+		eu.LastSignedInAt = formatTimestamp(u.UserMetadata.LastLogInTimestamp)
+	}
+	if len(u.CustomClaims) > 0 {
+		b, err := json.Marshal(u.CustomClaims)
+		if err != nil {
+			return nil, err
+		}
+		eu.CustomAttributes = string(b)
+	}
+	for _, p := range u.ProviderUserInfo {
+		eu.ProviderUserInfo = append(eu.ProviderUserInfo, exportedProvider{
+			ProviderID:  p.ProviderID,
+			RawID:       p.UID,
+			Email:       p.Email,
+			DisplayName: p.DisplayName,
+			PhotoURL:    p.PhotoURL,
+		})
+	}
+	return eu, nil
+}
+
+func (u *exportedUser) exportedUserRecord() (*ExportedUserRecord, error) {
+	if u.LocalID == "" {
+		return nil, errors.New("user id must not be empty")
+	}
+	created, err := parseTimestamp(u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	lastLogin, err := parseTimestamp(u.LastSignedInAt)
+	if err != nil {
+		return nil, err
+	}
+
+	var cc map[string]interface{}
+	if u.CustomAttributes != "" {
+		if err := json.Unmarshal([]byte(u.CustomAttributes), &cc); err != nil {
+			return nil, fmt.Errorf("invalid custom attributes: %v", err)
+		}
+		if len(cc) == 0 {
+			cc = nil
+		}
+	}
+
+	var providers []*UserInfo
+	for _, p := range u.ProviderUserInfo {
+		providers = append(providers, &UserInfo{
+			DisplayName: p.DisplayName,
+			Email:       p.Email,
+			PhotoURL:    p.PhotoURL,
+			ProviderID:  p.ProviderID,
+			UID:         p.RawID,
+		})
+	}
+
+	return &ExportedUserRecord{
+		UserRecord: &UserRecord{
+			UserInfo: &UserInfo{
+				DisplayName: u.DisplayName,
+				Email:       u.Email,
+				PhoneNumber: u.PhoneNumber,
+				PhotoURL:    u.PhotoURL,
+				ProviderID:  defaultProviderID,
+				UID:         u.LocalID,
+			},
+			CustomClaims:     cc,
+			Disabled:         u.Disabled,
+			EmailVerified:    u.EmailVerified,
+			ProviderUserInfo: providers,
+			UserMetadata: &UserMetadata{
+				CreationTimestamp:  created,
+				LastLogInTimestamp: lastLogin,
+			},
+		},
+		PasswordHash: toWebSafeBase64.Replace(u.PasswordHash),
+		PasswordSalt: toWebSafeBase64.Replace(u.Salt),
+	}, nil
+}
+
+func (u *exportedUser) csvRecord() []string {
+	rec := make([]string, csvColumns)
+	rec[0] = u.LocalID
+	rec[1] = u.Email
+	rec[2] = strconv.FormatBool(u.EmailVerified)
+	rec[3] = u.PasswordHash
+	rec[4] = u.Salt
+	rec[5] = u.DisplayName
+	rec[6] = u.PhotoURL
+	for _, p := range u.ProviderUserInfo {
+		if idx, ok := csvProviders[p.ProviderID]; ok {
+			rec[idx] = p.RawID
+			rec[idx+1] = p.Email
+			rec[idx+2] = p.DisplayName
+			rec[idx+3] = p.PhotoURL
+		}
+	}
+	rec[23] = u.CreatedAt
+	rec[24] = u.LastSignedInAt
+	rec[25] = u.PhoneNumber
+	rec[26] = strconv.FormatBool(u.Disabled)
+	rec[27] = u.CustomAttributes
+	return rec
+}
+
+func parseCSVRecord(rec []string) (*exportedUser, error) {
+	// Older versions of the Firebase CLI do not write the last two columns.
+	if len(rec) != csvColumns && len(rec) != csvColumns-2 {
+		return nil, fmt.Errorf("expected %d columns but got %d", csvColumns, len(rec))
+	}
+	rec = append(rec, make([]string, csvColumns-len(rec))...)
+
+	emailVerified, err := parseBool(rec[2])
+	if err != nil {
+		return nil, err
+	}
+	disabled, err := parseBool(rec[26])
+	if err != nil {
+		return nil, err
+	}
+	u := &exportedUser{
+		LocalID:          rec[0],
+		Email:            rec[1],
+		EmailVerified:    emailVerified,
+		PasswordHash:     rec[3],
+		Salt:             rec[4],
+		DisplayName:      rec[5],
+		PhotoURL:         rec[6],
+		CreatedAt:        rec[23],
+		LastSignedInAt:   rec[24],
+		PhoneNumber:      rec[25],
+		Disabled:         disabled,
+		CustomAttributes: rec[27],
+	}
+	for _, id := range []string{"google.com", "facebook.com", "twitter.com", "github.com"} {
+		idx := csvProviders[id]
+		if rec[idx] == "" {
+			continue
+		}
+		u.ProviderUserInfo = append(u.ProviderUserInfo, exportedProvider{
+			ProviderID:  id,
+			RawID:       rec[idx],
+			Email:       rec[idx+1],
+			DisplayName: rec[idx+2],
+			PhotoURL:    rec[idx+3],
+		})
+	}
+	return u, nil
+}
+
+func formatTimestamp(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return strconv.FormatInt(ts, 10)
+}
+
+func parseTimestamp(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	ts, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp: %q", s)
+	}
+	return ts, nil
+}
+
+func parseBool(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean: %q", s)
+	}
+	return b, nil
+}
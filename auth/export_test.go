@@ -0,0 +1,265 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestExportUsersJSON(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+
+	var buf bytes.Buffer
+	if err := ExportUsers(context.Background(), s.Client, &buf, ExportFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var export struct {
+		Users []map[string]interface{} `json:"users"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &export); err != nil {
+		t.Fatal(err)
+	}
+	if len(export.Users) != 3 {
+		t.Fatalf("ExportUsers() = %d users; want = 3", len(export.Users))
+	}
+	u := export.Users[0]
+	want := map[string]interface{}{
+		"localId":          "testuser",
+		"passwordHash":     "passwordhash1",
+		"salt":             "salt1",
+		"createdAt":        "1234567890",
+		"lastSignedInAt":   "1233211232",
+		"customAttributes": `{"admin":true,"package":"gold"}`,
+	}
+	for k, v := range want {
+		if u[k] != v {
+			t.Errorf("ExportUsers() %s = %v; want = %v", k, u[k], v)
+		}
+	}
+
+	users, err := ParseUserExport(&buf, ExportFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Firebase CLI format does not include the phone numbers of providers, or the time
+	// tokens were last revoked.
+	wantUser := *testUser
+	wantUser.TokensValidAfterMillis = 0
+	wantUser.ProviderUserInfo = []*UserInfo{
+		testUser.ProviderUserInfo[0],
+		{ProviderID: "phone", UID: "testuid"},
+	}
+	for i, u := range users {
+		if !reflect.DeepEqual(u.UserRecord, &wantUser) {
+			t.Errorf("ParseUserExport()[%d] = %#v; want = %#v", i, u.UserRecord, &wantUser)
+		}
+	}
+	if users[2].PasswordHash != "passwordhash3" || users[2].PasswordSalt != "salt3" {
+		t.Errorf("ParseUserExport()[2] = (%q, %q); want = (%q, %q)",
+			users[2].PasswordHash, users[2].PasswordSalt, "passwordhash3", "salt3")
+	}
+}
+
+func TestExportUsersCSV(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+
+	var buf bytes.Buffer
+	if err := ExportUsers(context.Background(), s.Client, &buf, ExportFormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("ExportUsers() = %d lines; want = 3", len(lines))
+	}
+	want := `testuser,testuser@example.com,true,passwordhash1,salt1,Test User,` +
+		`http://www.example.com/testuser/photo.png,,,,,,,,,,,,,,,,,1234567890,1233211232,` +
+		`+1234567890,false,"{""admin"":true,""package"":""gold""}"`
+	if lines[0] != want {
+		t.Errorf("ExportUsers() = %q; want = %q", lines[0], want)
+	}
+
+	users, err := ParseUserExport(&buf, ExportFormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The CSV format only includes the providers with dedicated columns.
+	wantUser := *testUser
+	wantUser.TokensValidAfterMillis = 0
+	wantUser.ProviderUserInfo = nil
+	for i, u := range users {
+		if !reflect.DeepEqual(u.UserRecord, &wantUser) {
+			t.Errorf("ParseUserExport()[%d] = %#v; want = %#v", i, u.UserRecord, &wantUser)
+		}
+	}
+}
+
+func TestParseUserExportCSV(t *testing.T) {
+	csv := "uid1,user@example.com,false,a+b/c=,s+a/lt,,,google-id,g@example.com,G User,,,,,,,,,,gh-id,,,,100,200,\n"
+	users, err := ParseUserExport(strings.NewReader(csv), ExportFormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ExportedUserRecord{
+		UserRecord: &UserRecord{
+			UserInfo: &UserInfo{
+				UID:        "uid1",
+				Email:      "user@example.com",
+				ProviderID: defaultProviderID,
+			},
+			ProviderUserInfo: []*UserInfo{
+				{ProviderID: "google.com", UID: "google-id", Email: "g@example.com", DisplayName: "G User"},
+				{ProviderID: "github.com", UID: "gh-id"},
+			},
+			UserMetadata: &UserMetadata{CreationTimestamp: 100, LastLogInTimestamp: 200},
+		},
+		PasswordHash: "a-b_c=",
+		PasswordSalt: "s-a_lt",
+	}
+	if len(users) != 1 || !reflect.DeepEqual(users[0], want) {
+		t.Errorf("ParseUserExport() = %#v; want = %#v", users, want)
+	}
+}
+
+func TestParseUserExportError(t *testing.T) {
+	cases := []struct {
+		data   string
+		format ExportFormat
+	}{
+		{`{"users": [`, ExportFormatJSON},
+		{`{"users": [{"email": "user@example.com"}]}`, ExportFormatJSON},
+		{`{"users": [{"localId": "uid1", "createdAt": "yesterday"}]}`, ExportFormatJSON},
+		{`{"users": [{"localId": "uid1", "customAttributes": "not json"}]}`, ExportFormatJSON},
+		{"uid1,user@example.com,false\n", ExportFormatCSV},
+		{"uid1,,maybe,,,,,,,,,,,,,,,,,,,,,,,,,\n", ExportFormatCSV},
+		{"{}", ExportFormat(42)},
+	}
+	for _, tc := range cases {
+		if users, err := ParseUserExport(strings.NewReader(tc.data), tc.format); users != nil || err == nil {
+			t.Errorf("ParseUserExport(%q) = (%v, %v); want = (nil, error)", tc.data, users, err)
+		}
+	}
+}
+
+func TestExportUsersError(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+
+	var buf bytes.Buffer
+	if err := ExportUsers(context.Background(), s.Client, &buf, ExportFormat(42)); err == nil {
+		t.Errorf("ExportUsers() = nil; want = error")
+	}
+
+	s.Status = 500
+	if err := ExportUsers(context.Background(), s.Client, &buf, ExportFormatJSON); err == nil {
+		t.Errorf("ExportUsers() = nil; want = error")
+	}
+}
+
+func TestCreateUserFromExport(t *testing.T) {
+	export := `{"users": [{
+		"localId": "testuser",
+		"email": "testuser@example.com",
+		"emailVerified": true,
+		"passwordHash": "` + testScryptHash + `",
+		"salt": "` + testScryptSalt + `",
+		"displayName": "Test User",
+		"phoneNumber": "+1234567890",
+		"createdAt": "1500000000000",
+		"lastSignedInAt": "1500000001500",
+		"customAttributes": "{\"admin\": true}",
+		"providerUserInfo": [
+			{"providerId": "password", "rawId": "testuser@example.com", "email": "testuser@example.com"},
+			{"providerId": "phone", "rawId": "+1234567890"},
+			{"providerId": "google.com", "rawId": "google-uid", "email": "testuser@gmail.com"}
+		]
+	}]}`
+	users, err := ParseUserExport(strings.NewReader(export), ExportFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("ParseUserExport() = %d users; want = 1", len(users))
+	}
+
+	user := users[0].UserToCreate(&testHashConfig)
+	request, err := user.importPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"localId":          "testuser",
+		"email":            "testuser@example.com",
+		"emailVerified":    true,
+		"displayName":      "Test User",
+		"phoneNumber":      "+1234567890",
+		"disabled":         false,
+		"customAttributes": `{"admin":true}`,
+		"createdAt":        "1500000000000",
+		"lastLoginAt":      "1500000001500",
+		"passwordHash":     toWebSafeBase64.Replace(testScryptHash),
+		"salt":             toWebSafeBase64.Replace(testScryptSalt),
+		"providerUserInfo": []map[string]interface{}{
+			{"providerId": "google.com", "rawId": "google-uid", "email": "testuser@gmail.com"},
+		},
+	}
+	if len(request.Users) != 1 || !reflect.DeepEqual(request.Users[0], want) {
+		t.Errorf("importPayload() = %v; want = %v", request.Users, want)
+	}
+	if request.HashAlgorithm != "SCRYPT" || request.Rounds != testHashConfig.Rounds {
+		t.Errorf("importPayload() = (%q, %d); want = (%q, %d)",
+			request.HashAlgorithm, request.Rounds, "SCRYPT", testHashConfig.Rounds)
+	}
+
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+	created, err := s.Client.CreateUser(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.UID != "testuser" {
+		t.Errorf("CreateUser() = %q; want = %q", created.UID, "testuser")
+	}
+	if len(s.Req) != 2 || s.Req[0].URL.Path != "/projects/mock-project-id/accounts:batchCreate" {
+		t.Errorf("CreateUser() request = %s; want = /projects/mock-project-id/accounts:batchCreate", s.Req[0].URL.Path)
+	}
+}
+
+func TestUserToCreateWithoutHashConfig(t *testing.T) {
+	u := &ExportedUserRecord{
+		UserRecord: &UserRecord{
+			UserInfo: &UserInfo{UID: "testuser"},
+		},
+		PasswordHash: toWebSafeBase64.Replace(testScryptHash),
+		PasswordSalt: toWebSafeBase64.Replace(testScryptSalt),
+	}
+	// Without import-only fields, the user is created with the signupNewUser endpoint.
+	user := u.UserToCreate(nil)
+	if user.requiresImport() {
+		t.Errorf("requiresImport() = true; want = false")
+	}
+	if _, ok := user.params["passwordHash"]; ok {
+		t.Errorf("UserToCreate(nil) = %v; want no password hash", user.params)
+	}
+}
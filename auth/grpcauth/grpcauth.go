@@ -0,0 +1,184 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpcauth contains gRPC server interceptors that authenticate calls with Firebase ID
+// tokens.
+//
+// The interceptors read the ID token from the bearer token in the "authorization" metadata of
+// incoming calls, and verify it with an auth.Client. The decoded token of an authenticated call
+// can be retrieved from the context of the call with auth.FromContext.
+package grpcauth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"firebase.google.com/go/auth"
+)
+
+// Options specifies how the interceptors authenticate calls.
+//
+// All fields are optional.
+type Options struct {
+	// PublicMethods lists the methods that can be called without authentication. Each entry is
+	// either a full method name (e.g. "/package.Service/Method"), or a service name followed by
+	// "/*" (e.g. "/package.Service/*") to match all the methods of a service.
+	PublicMethods []string
+
+	// CheckRevoked indicates whether tokens should be checked for revocation. This requires an
+	// RPC call for each authenticated call. See auth.Client.VerifyIDTokenAndCheckRevoked.
+	CheckRevoked bool
+}
+
+// UnaryServerInterceptor returns a unary server interceptor that authenticates calls with
+// Firebase ID tokens. opts may be nil.
+//
+// Calls that fail authentication are rejected with codes.Unauthenticated, and a message that
+// describes the reason. Calls whose ID token cannot be checked, because fetching the public keys
+// or looking up the user failed, are rejected with codes.Unavailable, or with codes.Internal if
+// the backend rejected the lookup.
+func UnaryServerInterceptor(c *auth.Client, opts *Options) grpc.UnaryServerInterceptor {
+	a := newAuthenticator(c, opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a stream server interceptor that authenticates calls with
+// Firebase ID tokens. opts may be nil.
+//
+// Calls are rejected with the same codes as UnaryServerInterceptor uses.
+func StreamServerInterceptor(c *auth.Client, opts *Options) grpc.StreamServerInterceptor {
+	a := newAuthenticator(c, opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authenticator struct {
+	client       *auth.Client
+	checkRevoked bool
+	methods      map[string]bool
+	services     []string
+}
+
+func newAuthenticator(c *auth.Client, opts *Options) *authenticator {
+	a := &authenticator{client: c, methods: make(map[string]bool)}
+	if opts == nil {
+		return a
+	}
+	a.checkRevoked = opts.CheckRevoked
+	for _, m := range opts.PublicMethods {
+		if strings.HasSuffix(m, "/*") {
+			a.services = append(a.services, strings.TrimSuffix(m, "*"))
+		} else {
+			a.methods[m] = true
+		}
+	}
+	return a
+}
+
+func (a *authenticator) isPublic(method string) bool {
+	if a.methods[method] {
+		return true
+	}
+	for _, s := range a.services {
+		if strings.HasPrefix(method, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if a.isPublic(method) {
+		return ctx, nil
+	}
+
+	idToken, err := bearerToken(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	var token *auth.Token
+	if a.checkRevoked {
+		token, err = a.client.VerifyIDTokenAndCheckRevoked(ctx, idToken)
+	} else {
+		token, err = a.client.VerifyIDTokenWithOptions(ctx, idToken, nil)
+	}
+	if err != nil {
+		return nil, status.Error(errorCode(ctx, err), err.Error())
+	}
+	return auth.NewContext(ctx, token), nil
+}
+
+// errorCode returns the status code for an error returned by the verification of an ID token.
+// Invalid and revoked tokens are rejected with codes.Unauthenticated. Failures of the calls made
+// to check a token are not the fault of the caller, and are reported with codes.Unavailable so
+// that the call can be retried, unless the backend rejected the call, which is not transient.
+func errorCode(ctx context.Context, err error) codes.Code {
+	be, ok := err.(*auth.BackendError)
+	if !ok {
+		return codes.Unauthenticated
+	}
+	switch ctx.Err() {
+	case context.Canceled:
+		return codes.Canceled
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	}
+	if e, ok := be.Err.(*googleapi.Error); ok && e.Code < http.StatusInternalServerError &&
+		e.Code != http.StatusTooManyRequests {
+		return codes.Internal
+	}
+	return codes.Unavailable
+}
+
+func bearerToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md["authorization"]) == 0 {
+		return "", errors.New("no ID token found in request metadata")
+	}
+	const prefix = "bearer "
+	h := md["authorization"][0]
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", errors.New("authorization metadata must be of the form 'Bearer <token>'")
+	}
+	return strings.TrimSpace(h[len(prefix):]), nil
+}
+
+// serverStream wraps a grpc.ServerStream to override its context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
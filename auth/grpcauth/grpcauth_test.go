@@ -0,0 +1,283 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"firebase.google.com/go/auth"
+	"firebase.google.com/go/internal"
+)
+
+const testProjectID = "mock-project-id"
+
+var client *auth.Client
+var testKey *rsa.PrivateKey
+var testIDToken string
+
+func TestMain(m *testing.M) {
+	var err error
+	testKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	client, err = auth.NewClient(context.Background(), &internal.AuthConfig{
+		Opts:      []option.ClientOption{option.WithCredentialsFile("../../testdata/service_account.json")},
+		ProjectID: testProjectID,
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	client.SetKeySource(auth.NewStaticKeySource(&auth.PublicKey{Kid: "key1", Key: &testKey.PublicKey}))
+	testIDToken = signIDToken(time.Now().Unix() + 3600)
+	os.Exit(m.Run())
+}
+
+func uidHandler(ctx context.Context, req interface{}) (interface{}, error) {
+	token, ok := auth.FromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	return token.UID, nil
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor(client, nil)
+	for _, header := range []string{"Bearer " + testIDToken, "bearer " + testIDToken} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", header))
+		info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+		resp, err := interceptor(ctx, nil, info, uidHandler)
+		if resp != "user1" || err != nil {
+			t.Errorf("interceptor(%q) = (%v, %v); want = (%q, nil)", header, resp, err, "user1")
+		}
+	}
+}
+
+func TestUnaryServerInterceptorUnauthenticated(t *testing.T) {
+	interceptor := UnaryServerInterceptor(client, nil)
+	cases := []struct {
+		name string
+		md   metadata.MD
+		want string
+	}{
+		{"NoMetadata", nil, "no ID token found in request metadata"},
+		{"NoAuthorization", metadata.Pairs("foo", "bar"), "no ID token found in request metadata"},
+		{"NotBearer", metadata.Pairs("authorization", "Basic dXNlcjpwYXNz"), "authorization metadata must be"},
+		{"InvalidToken", metadata.Pairs("authorization", "Bearer foo.bar.baz"), ""},
+		{"ExpiredToken", metadata.Pairs("authorization", "Bearer "+signIDToken(time.Now().Unix()-100)),
+			"ID token has expired"},
+	}
+	for _, tc := range cases {
+		ctx := context.Background()
+		if tc.md != nil {
+			ctx = metadata.NewIncomingContext(ctx, tc.md)
+		}
+		info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+		called := false
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			called = true
+			return nil, nil
+		}
+		resp, err := interceptor(ctx, nil, info, handler)
+		if resp != nil || status.Code(err) != codes.Unauthenticated {
+			t.Errorf("interceptor(%s) = (%v, %v); want = (nil, Unauthenticated)", tc.name, resp, err)
+		} else if !strings.HasPrefix(status.Convert(err).Message(), tc.want) {
+			t.Errorf("interceptor(%s) = %q; want prefix = %q", tc.name, status.Convert(err).Message(), tc.want)
+		}
+		if called {
+			t.Errorf("interceptor(%s) called handler; want not called", tc.name)
+		}
+	}
+}
+
+func TestUnaryServerInterceptorBackendError(t *testing.T) {
+	failingKeys, err := newClient(http.StatusOK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failingKeys.SetKeySource(auth.NewStaticKeySource())
+
+	cases := []struct {
+		name   string
+		status int
+		opts   *Options
+		want   codes.Code
+	}{
+		{"Unavailable", http.StatusServiceUnavailable, &Options{CheckRevoked: true}, codes.Unavailable},
+		{"TooManyRequests", http.StatusTooManyRequests, &Options{CheckRevoked: true}, codes.Unavailable},
+		{"Forbidden", http.StatusForbidden, &Options{CheckRevoked: true}, codes.Internal},
+		{"Revoked", http.StatusOK, &Options{CheckRevoked: true}, codes.Unauthenticated},
+	}
+	for _, tc := range cases {
+		c, err := newClient(tc.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetKeySource(auth.NewStaticKeySource(&auth.PublicKey{Kid: "key1", Key: &testKey.PublicKey}))
+		code := interceptorCode(context.Background(), UnaryServerInterceptor(c, tc.opts))
+		if code != tc.want {
+			t.Errorf("interceptor(%s) = %v; want = %v", tc.name, code, tc.want)
+		}
+	}
+
+	if code := interceptorCode(context.Background(), UnaryServerInterceptor(failingKeys, nil)); code != codes.Unavailable {
+		t.Errorf("interceptor(NoKeys) = %v; want = %v", code, codes.Unavailable)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if code := interceptorCode(ctx, UnaryServerInterceptor(failingKeys, nil)); code != codes.Canceled {
+		t.Errorf("interceptor(Canceled) = %v; want = %v", code, codes.Canceled)
+	}
+}
+
+func TestPublicMethods(t *testing.T) {
+	opts := &Options{PublicMethods: []string{"/test.Service/Public", "/test.PublicService/*"}}
+	interceptor := UnaryServerInterceptor(client, opts)
+	cases := []struct {
+		method string
+		public bool
+	}{
+		{"/test.Service/Public", true},
+		{"/test.PublicService/Method", true},
+		{"/test.Service/Method", false},
+		{"/test.Service/PublicMethod", false},
+		{"/test.PublicServiceV2/Method", false},
+	}
+	for _, tc := range cases {
+		info := &grpc.UnaryServerInfo{FullMethod: tc.method}
+		_, err := interceptor(context.Background(), nil, info, uidHandler)
+		if tc.public && err != nil {
+			t.Errorf("interceptor(%q) = %v; want = nil", tc.method, err)
+		} else if !tc.public && status.Code(err) != codes.Unauthenticated {
+			t.Errorf("interceptor(%q) = %v; want = Unauthenticated", tc.method, err)
+		}
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(client, nil)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+testIDToken))
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}
+
+	var uid string
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		if token, ok := auth.FromContext(ss.Context()); ok {
+			uid = token.UID
+		}
+		return nil
+	}
+	if err := interceptor(nil, &mockServerStream{ctx: ctx}, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	if uid != "user1" {
+		t.Errorf("UID = %q; want = %q", uid, "user1")
+	}
+
+	err := interceptor(nil, &mockServerStream{ctx: context.Background()}, info, handler)
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("interceptor() = %v; want = Unauthenticated", err)
+	}
+}
+
+// newClient returns a client whose user lookups receive the given HTTP status. Successful lookups
+// return a user whose tokens were revoked after testIDToken was issued.
+func newClient(status int) (*auth.Client, error) {
+	hc := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body := `{"error": {"code": 0, "message": "backend error"}}`
+		if status == http.StatusOK {
+			body = fmt.Sprintf(`{"users": [{"localId": "user1", "validSince": "%d"}]}`, time.Now().Unix())
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+	return auth.NewClient(context.Background(), &internal.AuthConfig{
+		Opts:      []option.ClientOption{option.WithHTTPClient(hc)},
+		ProjectID: testProjectID,
+	})
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// interceptorCode calls the interceptor with testIDToken, and returns the status code of the
+// error it returns.
+func interceptorCode(ctx context.Context, interceptor grpc.UnaryServerInterceptor) codes.Code {
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+testIDToken))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	_, err := interceptor(ctx, nil, info, uidHandler)
+	return status.Code(err)
+}
+
+type mockServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *mockServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func signIDToken(exp int64) string {
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	header := map[string]string{"alg": "RS256", "typ": "JWT", "kid": "key1"}
+	payload := map[string]interface{}{
+		"aud": testProjectID,
+		"iss": "https://securetoken.google.com/" + testProjectID,
+		"iat": time.Now().Unix() - 100,
+		"exp": exp,
+		"sub": "user1",
+	}
+	ss := encode(header) + "." + encode(payload)
+	h := sha256.Sum256([]byte(ss))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, testKey, crypto.SHA256, h[:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return ss + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
@@ -21,6 +21,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"firebase.google.com/go/internal"
+	"golang.org/x/net/context"
 )
 
 type jwtHeader struct {
@@ -34,13 +37,14 @@ type jwtPayload interface {
 }
 
 type customToken struct {
-	Iss    string                 `json:"iss"`
-	Aud    string                 `json:"aud"`
-	Exp    int64                  `json:"exp"`
-	Iat    int64                  `json:"iat"`
-	Sub    string                 `json:"sub,omitempty"`
-	UID    string                 `json:"uid,omitempty"`
-	Claims map[string]interface{} `json:"claims,omitempty"`
+	Iss      string                 `json:"iss"`
+	Aud      string                 `json:"aud"`
+	Exp      int64                  `json:"exp"`
+	Iat      int64                  `json:"iat"`
+	Sub      string                 `json:"sub,omitempty"`
+	UID      string                 `json:"uid,omitempty"`
+	TenantID string                 `json:"tenant_id,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
 }
 
 func (p *customToken) decode(s string) error {
@@ -83,7 +87,7 @@ func decode(s string, i interface{}) error {
 	return json.NewDecoder(bytes.NewBuffer(decoded)).Decode(i)
 }
 
-func encodeToken(s signer, h jwtHeader, p jwtPayload) (string, error) {
+func encodeToken(ctx context.Context, s internal.Signer, h jwtHeader, p jwtPayload) (string, error) {
 	header, err := encode(h)
 	if err != nil {
 		return "", err
@@ -94,14 +98,14 @@ func encodeToken(s signer, h jwtHeader, p jwtPayload) (string, error) {
 	}
 
 	ss := fmt.Sprintf("%s.%s", header, payload)
-	sig, err := s.Sign([]byte(ss))
+	sig, err := s.Sign(ctx, []byte(ss))
 	if err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("%s.%s", ss, base64.RawURLEncoding.EncodeToString(sig)), nil
 }
 
-func decodeToken(token string, ks keySource, h *jwtHeader, p jwtPayload) error {
+func decodeToken(ctx context.Context, token string, ks KeySource, h *jwtHeader, p jwtPayload) error {
 	s := strings.Split(token, ".")
 	if len(s) != 3 {
 		return errors.New("incorrect number of segments")
@@ -114,22 +118,22 @@ func decodeToken(token string, ks keySource, h *jwtHeader, p jwtPayload) error {
 		return err
 	}
 
-	keys, err := ks.Keys()
+	return verifyTokenSignature(ctx, s, h, ks)
+}
+
+// verifyTokenSignature verifies the signature of a JWT, split into its three parts, with the keys
+// of ks that match its 'kid' header, or with all the keys if the header has no 'kid'.
+func verifyTokenSignature(ctx context.Context, parts []string, h *jwtHeader, ks KeySource) error {
+	keys, err := keysWithContext(ctx, ks)
 	if err != nil {
-		return err
+		return &BackendError{Err: err}
 	}
-	verified := false
 	for _, k := range keys {
 		if h.KeyID == "" || h.KeyID == k.Kid {
-			if verifySignature(s, k) == nil {
-				verified = true
-				break
+			if verifySignature(parts, h.Algorithm, k) == nil {
+				return nil
 			}
 		}
 	}
-
-	if !verified {
-		return errors.New("failed to verify token signature")
-	}
-	return nil
+	return errors.New("failed to verify token signature")
 }
@@ -5,12 +5,14 @@ import (
 	"errors"
 	"strings"
 	"testing"
+
+	"golang.org/x/net/context"
 )
 
 func TestEncodeToken(t *testing.T) {
 	h := defaultHeader()
 	p := mockIDTokenPayload{"key": "value"}
-	s, err := encodeToken(&mockSigner{}, h, p)
+	s, err := encodeToken(context.Background(), &mockSigner{}, h, p)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -46,7 +48,7 @@ func TestEncodeSignError(t *testing.T) {
 	signer := &mockSigner{
 		err: errors.New("sign error"),
 	}
-	if s, err := encodeToken(signer, h, p); s != "" || err == nil {
+	if s, err := encodeToken(context.Background(), signer, h, p); s != "" || err == nil {
 		t.Errorf("encodeToken() = (%v, %v); want = ('', error)", s, err)
 	}
 }
@@ -54,7 +56,7 @@ func TestEncodeSignError(t *testing.T) {
 func TestEncodeInvalidPayload(t *testing.T) {
 	h := defaultHeader()
 	p := mockIDTokenPayload{"key": func() {}}
-	if s, err := encodeToken(&mockSigner{}, h, p); s != "" || err == nil {
+	if s, err := encodeToken(context.Background(), &mockSigner{}, h, p); s != "" || err == nil {
 		t.Errorf("encodeToken() = (%v, %v); want = ('', error)", s, err)
 	}
 }
@@ -67,7 +69,7 @@ func (s *mockSigner) Email() (string, error) {
 	return "", nil
 }
 
-func (s *mockSigner) Sign(b []byte) ([]byte, error) {
+func (s *mockSigner) Sign(ctx context.Context, b []byte) ([]byte, error) {
 	if s.err != nil {
 		return nil, s.err
 	}
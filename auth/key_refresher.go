@@ -0,0 +1,164 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultRefreshBefore = 5 * time.Minute
+	defaultMinBackoff    = time.Second
+	defaultMaxBackoff    = 5 * time.Minute
+)
+
+// KeySourceStats contains the cache statistics of the public key source used to verify ID
+// tokens.
+//
+// Hits counts lookups served from unexpired cached keys, and StaleHits counts lookups served
+// from expired keys while a refresh was in flight. Misses counts lookups that had to wait for
+// the keys to be fetched. Refreshes and RefreshErrors count successful and failed fetches, and
+// LastRefresh is the time of the last successful fetch.
+type KeySourceStats struct {
+	Hits          int64
+	StaleHits     int64
+	Misses        int64
+	Refreshes     int64
+	RefreshErrors int64
+	LastRefresh   time.Time
+}
+
+// KeyRefresherOptions configures the background refresh of public keys.
+//
+// All fields are optional. A zero value indicates that the corresponding default is used.
+type KeyRefresherOptions struct {
+	// RefreshBefore is how long before the cached keys expire they are refreshed. Defaults to
+	// 5 minutes.
+	RefreshBefore time.Duration
+
+	// MinBackoff and MaxBackoff bound the exponential backoff applied between consecutive failed
+	// refresh attempts. They default to 1 second and 5 minutes respectively.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// StartKeyRefresher starts a goroutine that refreshes the public keys used to verify ID tokens
+// before they expire, so that VerifyIDToken never has to wait for the keys to be fetched.
+//
+// The goroutine runs until ctx is cancelled. Failed refreshes are retried with exponential
+// backoff, and the previously fetched keys continue to be served in the meantime.
+// StartKeyRefresher returns an error if the Client has been configured with a KeySource that
+// does not fetch keys over HTTP.
+func (c *Client) StartKeyRefresher(ctx context.Context, opts *KeyRefresherOptions) error {
+	_, err := c.startKeyRefresher(ctx, opts, newRefreshTimer)
+	return err
+}
+
+// refreshTimer returns a channel that receives a value once d has elapsed, and a function that
+// stops the timer. It is replaced in tests to control when refreshes happen.
+type refreshTimer func(d time.Duration) (<-chan time.Time, func() bool)
+
+func newRefreshTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// startKeyRefresher starts the refresher goroutine, and returns a channel that is closed when
+// the goroutine exits.
+func (c *Client) startKeyRefresher(
+	ctx context.Context, opts *KeyRefresherOptions, timer refreshTimer) (<-chan struct{}, error) {
+	ks, ok := c.ks.(*httpKeySource)
+	if !ok {
+		return nil, errors.New("key refresher is only supported for keys fetched over http")
+	}
+
+	var o KeyRefresherOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.RefreshBefore <= 0 {
+		o.RefreshBefore = defaultRefreshBefore
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultMinBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = defaultMaxBackoff
+		if o.MaxBackoff < o.MinBackoff {
+			o.MaxBackoff = o.MinBackoff
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ks.runRefresher(ctx, &o, timer)
+	}()
+	return done, nil
+}
+
+// KeySourceStats returns the cache statistics of the public key source used to verify ID
+// tokens. If the Client has been configured with a KeySource that does not fetch keys over
+// HTTP, the returned statistics are all zero.
+func (c *Client) KeySourceStats() KeySourceStats {
+	if ks, ok := c.ks.(*httpKeySource); ok {
+		return ks.Stats()
+	}
+	return KeySourceStats{}
+}
+
+func (k *httpKeySource) runRefresher(ctx context.Context, o *KeyRefresherOptions, timer refreshTimer) {
+	backoff := time.Duration(0)
+	for {
+		var wait time.Duration
+		if backoff > 0 {
+			wait = backoff
+		} else {
+			k.Mutex.Lock()
+			if len(k.CachedKeys) > 0 {
+				// Never refresh more often than MinBackoff, even if the keys are short-lived.
+				wait = k.ExpiryTime.Add(-o.RefreshBefore).Sub(k.Clock.Now())
+				if wait < o.MinBackoff {
+					wait = o.MinBackoff
+				}
+			}
+			k.Mutex.Unlock()
+		}
+
+		if wait > 0 {
+			c, stop := timer(wait)
+			select {
+			case <-ctx.Done():
+				stop()
+				return
+			case <-c:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+
+		if err := k.refreshKeys(ctx, true); err != nil {
+			if backoff == 0 {
+				backoff = o.MinBackoff
+			} else if backoff *= 2; backoff > o.MaxBackoff {
+				backoff = o.MaxBackoff
+			}
+		} else {
+			backoff = 0
+		}
+	}
+}
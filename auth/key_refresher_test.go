@@ -0,0 +1,271 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// certServer serves the test public certificates. Requests fail while failing is set, and block
+// while block is non-nil.
+type certServer struct {
+	srv     *httptest.Server
+	mu      sync.Mutex
+	maxAge  string
+	failing bool
+	block   chan struct{}
+	calls   int
+}
+
+func newCertServer(t *testing.T, maxAge string) *certServer {
+	certs, err := ioutil.ReadFile("../testdata/public_certs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &certServer{maxAge: maxAge}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls++
+		failing, block := s.failing, s.block
+		s.mu.Unlock()
+		if block != nil {
+			<-block
+		}
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age="+s.maxAge)
+		w.Write(certs)
+	}))
+	return s
+}
+
+func (s *certServer) set(failing bool, block chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+	s.block = block
+}
+
+func (s *certServer) numCalls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestKeySourceStats(t *testing.T) {
+	s := newCertServer(t, "100")
+	defer s.srv.Close()
+
+	ks := newHTTPKeySource(s.srv.URL, http.DefaultClient)
+	for i := 0; i < 3; i++ {
+		if _, err := ks.Keys(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := ks.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Refreshes != 1 || stats.RefreshErrors != 0 {
+		t.Errorf("Stats() = %+v; want = {Hits: 2, Misses: 1, Refreshes: 1}", stats)
+	}
+	if stats.LastRefresh.IsZero() {
+		t.Errorf("LastRefresh = zero; want = non-zero")
+	}
+}
+
+func TestKeySourceServesStaleKeysDuringRefresh(t *testing.T) {
+	s := newCertServer(t, "100")
+	defer s.srv.Close()
+
+	ks := newHTTPKeySource(s.srv.URL, http.DefaultClient)
+	mc := &mockClock{now: time.Unix(0, 0)}
+	ks.Clock = mc
+	if _, err := ks.Keys(); err != nil {
+		t.Fatal(err)
+	}
+
+	block := make(chan struct{})
+	s.set(false, block)
+	mc.now = time.Unix(101, 0)
+	done := make(chan error)
+	go func() {
+		_, err := ks.Keys()
+		done <- err
+	}()
+	for s.numCalls() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	keys, err := ks.Keys()
+	if len(keys) != 3 || err != nil {
+		t.Errorf("Keys() = (%v, %v); want = (3 keys, nil)", keys, err)
+	}
+	close(block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	stats := ks.Stats()
+	if stats.StaleHits != 1 || stats.Misses != 2 || stats.Refreshes != 2 {
+		t.Errorf("Stats() = %+v; want = {StaleHits: 1, Misses: 2, Refreshes: 2}", stats)
+	}
+}
+
+func TestKeySourceRetainsKeysOnRefreshError(t *testing.T) {
+	s := newCertServer(t, "100")
+	defer s.srv.Close()
+
+	ks := newHTTPKeySource(s.srv.URL, http.DefaultClient)
+	mc := &mockClock{now: time.Unix(0, 0)}
+	ks.Clock = mc
+	if _, err := ks.Keys(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.set(true, nil)
+	mc.now = time.Unix(101, 0)
+	keys, err := ks.Keys()
+	if len(keys) != 3 || err != nil {
+		t.Errorf("Keys() = (%v, %v); want = (3 keys, nil)", keys, err)
+	}
+	if stats := ks.Stats(); stats.RefreshErrors != 1 {
+		t.Errorf("RefreshErrors = %d; want = 1", stats.RefreshErrors)
+	}
+}
+
+// fakeTimer is a refreshTimer that reports every requested wait on waits, and expires only when
+// the test sends on fire.
+type fakeTimer struct {
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func newFakeTimer() *fakeTimer {
+	return &fakeTimer{waits: make(chan time.Duration), fire: make(chan time.Time)}
+}
+
+func (f *fakeTimer) timer(d time.Duration) (<-chan time.Time, func() bool) {
+	f.waits <- d
+	return f.fire, func() bool { return true }
+}
+
+// next waits for the refresher to start a timer, and checks the requested duration.
+func (f *fakeTimer) next(t *testing.T, want time.Duration) {
+	select {
+	case got := <-f.waits:
+		if got != want {
+			t.Fatalf("refresh timer = %v; want = %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("refresh timer not started; want = %v", want)
+	}
+}
+
+func TestKeyRefresher(t *testing.T) {
+	s := newCertServer(t, "100")
+	defer s.srv.Close()
+
+	ks := newHTTPKeySource(s.srv.URL, http.DefaultClient)
+	ks.Clock = &mockClock{now: time.Unix(0, 0)}
+	c := &Client{ks: ks}
+	ft := newFakeTimer()
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := &KeyRefresherOptions{
+		RefreshBefore: 10 * time.Second,
+		MinBackoff:    time.Second,
+	}
+	done, err := c.startKeyRefresher(ctx, opts, ft.timer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys are fetched right away, and then refreshed 10 seconds before they expire.
+	ft.next(t, 90*time.Second)
+	if stats := c.KeySourceStats(); stats.Refreshes != 1 {
+		t.Errorf("Refreshes = %d; want = 1", stats.Refreshes)
+	}
+	ft.fire <- time.Time{}
+	ft.next(t, 90*time.Second)
+	if stats := c.KeySourceStats(); stats.Refreshes != 2 {
+		t.Errorf("Refreshes = %d; want = 2", stats.Refreshes)
+	}
+
+	cancel()
+	<-done
+	if _, err := c.ks.Keys(); err != nil {
+		t.Fatal(err)
+	}
+	want := KeySourceStats{Hits: 1, Refreshes: 2, LastRefresh: time.Unix(0, 0)}
+	if stats := c.KeySourceStats(); stats != want {
+		t.Errorf("Stats() = %+v; want = %+v", stats, want)
+	}
+	if n := s.numCalls(); n != 2 {
+		t.Errorf("Requests = %d; want = 2", n)
+	}
+}
+
+func TestKeyRefresherBackoff(t *testing.T) {
+	s := newCertServer(t, "100")
+	defer s.srv.Close()
+	s.set(true, nil)
+
+	ks := newHTTPKeySource(s.srv.URL, http.DefaultClient)
+	ks.Clock = &mockClock{now: time.Unix(0, 0)}
+	c := &Client{ks: ks}
+	ft := newFakeTimer()
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := &KeyRefresherOptions{
+		MinBackoff: time.Second,
+		MaxBackoff: 3 * time.Second,
+	}
+	done, err := c.startKeyRefresher(ctx, opts, ft.timer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first attempt is made right away. The backoff doubles after each failure, up to
+	// MaxBackoff.
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		ft.next(t, want)
+		ft.fire <- time.Time{}
+	}
+	ft.next(t, 3*time.Second)
+	s.set(false, nil)
+	ft.fire <- time.Time{}
+
+	// The keys expire sooner than RefreshBefore, so the next refresh is MinBackoff away.
+	ft.next(t, time.Second)
+	cancel()
+	<-done
+	if stats := c.KeySourceStats(); stats.RefreshErrors != 4 || stats.Refreshes != 1 {
+		t.Errorf("Stats() = %+v; want = {RefreshErrors: 4, Refreshes: 1}", stats)
+	}
+}
+
+func TestKeyRefresherUnsupportedKeySource(t *testing.T) {
+	c := &Client{ks: NewStaticKeySource()}
+	if err := c.StartKeyRefresher(context.Background(), nil); err == nil {
+		t.Errorf("StartKeyRefresher() = nil; want = error")
+	}
+	if stats := c.KeySourceStats(); stats != (KeySourceStats{}) {
+		t.Errorf("KeySourceStats() = %+v; want = zero", stats)
+	}
+}
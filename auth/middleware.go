@@ -0,0 +1,131 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+type tokenContextKey struct{}
+
+// NewContext returns a copy of ctx that carries the given ID token.
+func NewContext(ctx context.Context, token *Token) context.Context {
+	return context.WithValue(ctx, tokenContextKey{}, token)
+}
+
+// FromContext returns the ID token carried by ctx, if any.
+//
+// Handlers wrapped by Middleware can use this function to access the verified ID token of the
+// current request.
+func FromContext(ctx context.Context) (*Token, bool) {
+	token, ok := ctx.Value(tokenContextKey{}).(*Token)
+	return token, ok && token != nil
+}
+
+// MiddlewareOptions specifies how Middleware authenticates requests.
+//
+// All fields are optional.
+type MiddlewareOptions struct {
+	// IDTokenCookieName is the name of a cookie from which the ID token is read, when the request
+	// does not carry an Authorization header. The cookie must hold a Firebase ID token, as set by
+	// the client after sign-in. Session cookies are not supported: they are signed with different
+	// keys and carry a different issuer, so they are rejected like any other invalid ID token.
+	IDTokenCookieName string
+
+	// CheckRevoked indicates whether tokens should be checked for revocation. This requires an
+	// RPC call for each request. See VerifyIDTokenAndCheckRevoked.
+	CheckRevoked bool
+
+	// ErrorHandler is invoked to write the response for requests that fail authentication. By
+	// default, a 401 Unauthorized response with a JSON body describing the error is written.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Middleware returns an HTTP middleware that authenticates requests with Firebase ID tokens.
+//
+// The ID token is read from the bearer token of the Authorization header, or from the ID token
+// cookie specified in opts. If the token is valid, the wrapped handler is called with a request whose
+// context carries the decoded token, which can be retrieved with FromContext. Otherwise the
+// request is rejected, and the wrapped handler is not called. opts may be nil.
+func Middleware(c *Client, opts *MiddlewareOptions) func(http.Handler) http.Handler {
+	var o MiddlewareOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.ErrorHandler == nil {
+		o.ErrorHandler = writeUnauthorized
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idToken, err := extractToken(r, o.IDTokenCookieName)
+			if err != nil {
+				o.ErrorHandler(w, r, err)
+				return
+			}
+
+			var token *Token
+			if o.CheckRevoked {
+				token, err = c.VerifyIDTokenAndCheckRevoked(r.Context(), idToken)
+			} else {
+				token, err = c.VerifyIDTokenWithOptions(r.Context(), idToken, nil)
+			}
+			if err != nil {
+				o.ErrorHandler(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), token)))
+		})
+	}
+}
+
+func extractToken(r *http.Request, cookieName string) (string, error) {
+	if h := r.Header.Get("Authorization"); h != "" {
+		return parseBearerToken(h)
+	}
+	if cookieName != "" {
+		if cookie, err := r.Cookie(cookieName); err == nil && cookie.Value != "" {
+			return cookie.Value, nil
+		}
+	}
+	return "", errors.New("no ID token found in request")
+}
+
+func parseBearerToken(h string) (string, error) {
+	const prefix = "bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", errors.New("authorization header must be of the form 'Bearer <token>'")
+	}
+	return strings.TrimSpace(h[len(prefix):]), nil
+}
+
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	b, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    http.StatusUnauthorized,
+			"status":  "UNAUTHENTICATED",
+			"message": err.Error(),
+		},
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	w.WriteHeader(http.StatusUnauthorized)
+	w.Write(b)
+}
@@ -0,0 +1,189 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// uidHandler writes the UID of the token carried by the request context.
+var uidHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	token, ok := FromContext(r.Context())
+	if !ok {
+		http.Error(w, "no token in context", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(w, token.UID)
+})
+
+func TestMiddleware(t *testing.T) {
+	h := Middleware(client, nil)(uidHandler)
+	for _, header := range []string{"Bearer " + testIDToken, "bearer " + testIDToken} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK || w.Body.String() != "1234567890" {
+			t.Errorf("ServeHTTP(%q) = (%d, %q); want = (200, %q)", header, w.Code, w.Body.String(), "1234567890")
+		}
+	}
+}
+
+func TestMiddlewareCookie(t *testing.T) {
+	h := Middleware(client, &MiddlewareOptions{IDTokenCookieName: "token"})(uidHandler)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "token", Value: testIDToken})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || w.Body.String() != "1234567890" {
+		t.Errorf("ServeHTTP() = (%d, %q); want = (200, %q)", w.Code, w.Body.String(), "1234567890")
+	}
+}
+
+func TestMiddlewareUnauthorized(t *testing.T) {
+	h := Middleware(client, &MiddlewareOptions{IDTokenCookieName: "token"})(uidHandler)
+	cases := []struct {
+		name   string
+		header string
+		cookie string
+	}{
+		{"NoToken", "", ""},
+		{"NotBearer", "Basic dXNlcjpwYXNz", ""},
+		{"EmptyBearer", "Bearer ", ""},
+		{"InvalidToken", "Bearer foo.bar.baz", ""},
+		{"ExpiredToken", "Bearer " + getIDToken(mockIDTokenPayload{
+			"iat": time.Now().Unix() - 1000,
+			"exp": time.Now().Unix() - 100,
+		}), ""},
+		{"InvalidCookie", "", "foo"},
+		{"SessionCookie", "", getIDToken(mockIDTokenPayload{
+			"iss": "https://session.firebase.google.com/" + client.projectID,
+		})},
+		{"HeaderTakesPrecedence", "Bearer foo", testIDToken},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			r.Header.Set("Authorization", tc.header)
+		}
+		if tc.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "token", Value: tc.cookie})
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("ServeHTTP(%s) = %d; want = 401", tc.name, w.Code)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+			t.Errorf("ServeHTTP(%s) Content-Type = %q; want = JSON", tc.name, ct)
+		}
+		var resp struct {
+			Error struct {
+				Code    int    `json:"code"`
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Errorf("ServeHTTP(%s) = %v", tc.name, err)
+		} else if resp.Error.Code != 401 || resp.Error.Status != "UNAUTHENTICATED" || resp.Error.Message == "" {
+			t.Errorf("ServeHTTP(%s) = %+v; want = UNAUTHENTICATED error", tc.name, resp)
+		}
+	}
+}
+
+func TestMiddlewareErrorHandler(t *testing.T) {
+	var got error
+	opts := &MiddlewareOptions{
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			got = err
+			w.WriteHeader(http.StatusForbidden)
+		},
+	}
+	h := Middleware(client, opts)(uidHandler)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("ServeHTTP() = %d; want = 403", w.Code)
+	}
+	if got == nil {
+		t.Errorf("ErrorHandler not called")
+	}
+}
+
+func TestMiddlewareCheckRevoked(t *testing.T) {
+	iat := time.Now().Unix() - 100
+	cases := []struct {
+		validSince int64
+		disabled   bool
+		want       int
+	}{
+		{iat - 10, false, http.StatusOK},
+		{iat + 10, false, http.StatusUnauthorized},
+		{iat - 10, true, http.StatusUnauthorized},
+	}
+	token := getIDToken(mockIDTokenPayload{"iat": iat})
+	for _, tc := range cases {
+		s := echoServer(map[string]interface{}{
+			"users": []interface{}{
+				map[string]interface{}{
+					"localId":    "1234567890",
+					"disabled":   tc.disabled,
+					"validSince": strconv.FormatInt(tc.validSince, 10),
+				},
+			},
+		}, t)
+		s.Client.projectID = client.projectID
+		s.Client.ks = client.ks
+
+		h := Middleware(s.Client, &MiddlewareOptions{CheckRevoked: true})(uidHandler)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("ServeHTTP(validSince: %d, disabled: %v) = %d; want = %d",
+				tc.validSince, tc.disabled, w.Code, tc.want)
+		}
+		if len(s.Req) != 1 {
+			t.Errorf("Requests = %d; want = 1", len(s.Req))
+		}
+		s.Close()
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if token, ok := FromContext(context.Background()); token != nil || ok {
+		t.Errorf("FromContext() = (%v, %v); want = (nil, false)", token, ok)
+	}
+	want := &Token{UID: "uid"}
+	if token, ok := FromContext(NewContext(context.Background(), want)); token != want || !ok {
+		t.Errorf("FromContext() = (%v, %v); want = (%v, true)", token, ok, want)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	maxScryptRounds     = 8
+	maxScryptMemoryCost = 14
+	scryptKeyLen        = 32
+)
+
+// HashConfig holds the parameters of the modified scrypt algorithm Firebase uses to hash user
+// passwords.
+//
+// The parameters of a project are listed in the "Password hash parameters" dialog of the
+// Authentication section of the Firebase console. SignerKey and SaltSeparator are base64 encoded,
+// as shown in the console.
+type HashConfig struct {
+	SignerKey     string
+	SaltSeparator string
+	Rounds        int
+	MemoryCost    int
+}
+
+// VerifyFirebaseScrypt reports whether the password matches a password hash and salt computed
+// with Firebase's modified scrypt algorithm.
+//
+// The hash and salt are base64 encoded, as returned in ExportedUserRecord.PasswordHash and
+// ExportedUserRecord.PasswordSalt, or written by ExportUsers. Verification is done locally,
+// without making any network calls. An error is returned if the hash, salt or config is
+// malformed; a password that simply does not match returns (false, nil).
+func VerifyFirebaseScrypt(password, hash, salt string, config HashConfig) (bool, error) {
+	signerKey, saltSep, err := config.decode()
+	if err != nil {
+		return false, err
+	}
+	h, err := decodePasswordBase64(hash)
+	if err != nil || len(h) == 0 {
+		return false, errors.New("password hash must be a non-empty base64 string")
+	}
+	s, err := decodePasswordBase64(salt)
+	if err != nil {
+		return false, errors.New("password salt must be a base64 string")
+	}
+
+	want, err := firebaseScrypt([]byte(password), s, saltSep, signerKey, config.Rounds, config.MemoryCost)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(h, want) == 1, nil
+}
+
+// decode validates the config, and returns its decoded signer key and salt separator.
+func (config HashConfig) decode() ([]byte, []byte, error) {
+	if config.Rounds < 1 || config.Rounds > maxScryptRounds {
+		return nil, nil, fmt.Errorf("rounds must be between 1 and %d", maxScryptRounds)
+	}
+	if config.MemoryCost < 1 || config.MemoryCost > maxScryptMemoryCost {
+		return nil, nil, fmt.Errorf("memory cost must be between 1 and %d", maxScryptMemoryCost)
+	}
+	signerKey, err := base64.StdEncoding.DecodeString(config.SignerKey)
+	if err != nil || len(signerKey) == 0 {
+		return nil, nil, errors.New("signer key must be a non-empty base64 string")
+	}
+	saltSep, err := base64.StdEncoding.DecodeString(config.SaltSeparator)
+	if err != nil {
+		return nil, nil, errors.New("salt separator must be a base64 string")
+	}
+	return signerKey, saltSep, nil
+}
+
+// firebaseScrypt derives a key from the password with scrypt, and uses it to encrypt the signer
+// key with AES-256 in CTR mode, using an all-zero IV.
+func firebaseScrypt(password, salt, saltSep, signerKey []byte, rounds, memCost int) ([]byte, error) {
+	s := make([]byte, 0, len(salt)+len(saltSep))
+	s = append(append(s, salt...), saltSep...)
+	key, err := scrypt.Key(password, s, 1<<uint(memCost), rounds, 1, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, len(signerKey))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(result, signerKey)
+	return result, nil
+}
+
+// decodePasswordBase64 decodes a password hash or salt, in either the standard or the web-safe
+// base64 encoding, with or without padding.
+func decodePasswordBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(toStdBase64.Replace(s), "="))
+}
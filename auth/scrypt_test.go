@@ -0,0 +1,79 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import "testing"
+
+// Test vector published with the reference implementation at github.com/firebase/scrypt.
+var testHashConfig = HashConfig{
+	SignerKey:     "jxspr8Ki0RYycVU8zykbdLGjFQ3McFUH0uiiTvC8pVMXAn210wjLNmdZJzxUECKbm0QsEmYUSDzZvpjeJ9WmXA==",
+	SaltSeparator: "Bw==",
+	Rounds:        8,
+	MemoryCost:    14,
+}
+
+const (
+	testScryptHash = "lSrfV15cpx95/sZS2W9c9Kp6i/LVgQNDNC/qzrCnh1SAyZvqmZqAjTdn3aoItz+VHjoZilo78198JAdRuid5lQ=="
+	testScryptSalt = "42xEC+ixf3L2lw=="
+)
+
+func TestVerifyFirebaseScrypt(t *testing.T) {
+	cases := []struct {
+		password, hash, salt string
+		want                 bool
+	}{
+		{"user1password", testScryptHash, testScryptSalt, true},
+		{"user1password", toWebSafeBase64.Replace(testScryptHash), toWebSafeBase64.Replace(testScryptSalt), true},
+		{"user1password", testScryptHash, "42xEC+ixf3L2lw", true},
+		{"user2password", testScryptHash, testScryptSalt, false},
+		{"user1password", testScryptHash, "AAAA", false},
+		{"", testScryptHash, testScryptSalt, false},
+	}
+	for _, tc := range cases {
+		got, err := VerifyFirebaseScrypt(tc.password, tc.hash, tc.salt, testHashConfig)
+		if got != tc.want || err != nil {
+			t.Errorf("VerifyFirebaseScrypt(%q, %q) = (%v, %v); want = (%v, nil)",
+				tc.password, tc.salt, got, err, tc.want)
+		}
+	}
+}
+
+func TestVerifyFirebaseScryptError(t *testing.T) {
+	configs := []HashConfig{
+		{SignerKey: testHashConfig.SignerKey, SaltSeparator: "Bw==", Rounds: 0, MemoryCost: 14},
+		{SignerKey: testHashConfig.SignerKey, SaltSeparator: "Bw==", Rounds: 9, MemoryCost: 14},
+		{SignerKey: testHashConfig.SignerKey, SaltSeparator: "Bw==", Rounds: 8, MemoryCost: 0},
+		{SignerKey: testHashConfig.SignerKey, SaltSeparator: "Bw==", Rounds: 8, MemoryCost: 15},
+		{SignerKey: "", SaltSeparator: "Bw==", Rounds: 8, MemoryCost: 14},
+		{SignerKey: "not base64!", SaltSeparator: "Bw==", Rounds: 8, MemoryCost: 14},
+		{SignerKey: testHashConfig.SignerKey, SaltSeparator: "not base64!", Rounds: 8, MemoryCost: 14},
+	}
+	for _, conf := range configs {
+		if ok, err := VerifyFirebaseScrypt("user1password", testScryptHash, testScryptSalt, conf); ok || err == nil {
+			t.Errorf("VerifyFirebaseScrypt(%v) = (%v, %v); want = (false, error)", conf, ok, err)
+		}
+	}
+
+	inputs := []struct{ hash, salt string }{
+		{"", testScryptSalt},
+		{"not base64!", testScryptSalt},
+		{testScryptHash, "not base64!"},
+	}
+	for _, in := range inputs {
+		if ok, err := VerifyFirebaseScrypt("user1password", in.hash, in.salt, testHashConfig); ok || err == nil {
+			t.Errorf("VerifyFirebaseScrypt(%q, %q) = (%v, %v); want = (false, error)", in.hash, in.salt, ok, err)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+
+	"firebase.google.com/go/internal"
+)
+
+// MultiFactorInfo describes a phone second factor enrolled by a user.
+type MultiFactorInfo struct {
+	// UID is the enrollment ID of the factor. It is assigned by the backend if left empty.
+	UID         string
+	DisplayName string
+	PhoneNumber string
+	EnrolledAt  time.Time
+}
+
+type passwordHash struct {
+	hash   string
+	salt   string
+	config HashConfig
+}
+
+// Parameters of UserToCreate that are not supported by the signupNewUser endpoint.
+var importParams = []string{
+	"createdAt", "customClaims", "lastLoginAt", "mfaInfo", "passwordHash", "providerUserInfo",
+}
+
+type batchCreateRequest struct {
+	Users         []map[string]interface{} `json:"users"`
+	SanityCheck   bool                     `json:"sanityCheck"`
+	HashAlgorithm string                   `json:"hashAlgorithm,omitempty"`
+	SignerKey     string                   `json:"signerKey,omitempty"`
+	SaltSeparator string                   `json:"saltSeparator,omitempty"`
+	Rounds        int                      `json:"rounds,omitempty"`
+	MemoryCost    int                      `json:"memoryCost,omitempty"`
+}
+
+// batchCreateErrorCodes maps the conflicts reported by the batchCreate endpoint, by the field
+// named in the error message, to the error codes the signupNewUser endpoint returns for them.
+var batchCreateErrorCodes = []struct {
+	field, code string
+}{
+	{"localid", "DUPLICATE_LOCAL_ID"},
+	{"raw id", "DUPLICATE_LOCAL_ID"},
+	{"email", "EMAIL_EXISTS"},
+	{"phone", "PHONE_NUMBER_EXISTS"},
+}
+
+type batchCreateResponse struct {
+	Error []struct {
+		Index   int    `json:"index"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (u *UserToCreate) requiresImport() bool {
+	for _, k := range importParams {
+		if _, ok := u.params[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) importUser(ctx context.Context, user *UserToCreate) (string, error) {
+	request, err := user.importPayload()
+	if err != nil {
+		return "", err
+	}
+	if c.projectID == "" {
+		return "", errors.New("project id not available")
+	}
+
+	url := fmt.Sprintf("%s/projects/%s/accounts:batchCreate", c.idToolkitV1Endpoint, c.projectID)
+	resp, err := c.hc.Do(ctx, &internal.Request{
+		Method: http.MethodPost,
+		URL:    url,
+		Body:   internal.NewJSONEntity(request),
+		Opts:   []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	})
+	if err != nil {
+		return "", err
+	}
+	var result batchCreateResponse
+	if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+		return "", err
+	}
+	if len(result.Error) > 0 {
+		return "", batchCreateError(result.Error[0].Message, resp.Body)
+	}
+	return request.Users[0]["localId"].(string), nil
+}
+
+// batchCreateError converts an error reported by the batchCreate endpoint into the error the
+// signupNewUser endpoint returns for the same conflict, so that callers of CreateUser can handle
+// conflicts the same way regardless of the endpoint used. Other errors are returned as they are.
+func batchCreateError(msg string, body []byte) error {
+	lower := strings.ToLower(msg)
+	if strings.Contains(lower, "exist") {
+		for _, e := range batchCreateErrorCodes {
+			if strings.Contains(lower, e.field) {
+				return &googleapi.Error{Code: http.StatusBadRequest, Message: e.code, Body: string(body)}
+			}
+		}
+	}
+	return fmt.Errorf("failed to create user: %s", msg)
+}
+
+func (u *UserToCreate) importPayload() (*batchCreateRequest, error) {
+	params := map[string]interface{}{}
+	for k, v := range u.params {
+		params[k] = v
+	}
+	if _, ok := params["localId"]; !ok {
+		return nil, errors.New("uid must be specified to create a user with custom claims, provider data, " +
+			"timestamps, a password hash or second factors")
+	}
+	if _, ok := params["password"]; ok {
+		return nil, errors.New("password must not be specified along with custom claims, provider data, " +
+			"timestamps, a password hash or second factors; use PasswordHash instead")
+	}
+	if err := processClaims(params); err != nil {
+		return nil, err
+	}
+
+	user := map[string]interface{}{}
+	for key, validate := range commonValidators {
+		if v, ok := params[key]; ok {
+			if err := validate(v); err != nil {
+				return nil, err
+			}
+			user[key] = v
+		}
+	}
+	for _, key := range []string{"customAttributes", "disabled", "emailVerified"} {
+		if v, ok := params[key]; ok {
+			user[key] = v
+		}
+	}
+	for _, key := range []string{"createdAt", "lastLoginAt"} {
+		if v, ok := params[key]; ok {
+			t := v.(time.Time)
+			if t.IsZero() {
+				return nil, fmt.Errorf("%s must not be zero", key)
+			}
+			user[key] = strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+		}
+	}
+
+	if v, ok := params["providerUserInfo"]; ok {
+		providers, err := providerUserInfoPayload(v.([]*UserInfo))
+		if err != nil {
+			return nil, err
+		}
+		user["providerUserInfo"] = providers
+	}
+	if v, ok := params["mfaInfo"]; ok {
+		factors, err := mfaInfoPayload(v.([]*MultiFactorInfo))
+		if err != nil {
+			return nil, err
+		}
+		user["mfaInfo"] = factors
+	}
+
+	// Without the sanity check, the endpoint overwrites users that have the same UID, and allows
+	// duplicate email addresses and phone numbers.
+	request := &batchCreateRequest{Users: []map[string]interface{}{user}, SanityCheck: true}
+	if v, ok := params["passwordHash"]; ok {
+		ph := v.(*passwordHash)
+		signerKey, saltSep, err := ph.config.decode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := decodePasswordBase64(ph.hash)
+		if err != nil || len(hash) == 0 {
+			return nil, errors.New("password hash must be a non-empty base64 string")
+		}
+		salt, err := decodePasswordBase64(ph.salt)
+		if err != nil {
+			return nil, errors.New("password salt must be a base64 string")
+		}
+		user["passwordHash"] = base64.URLEncoding.EncodeToString(hash)
+		user["salt"] = base64.URLEncoding.EncodeToString(salt)
+		request.HashAlgorithm = "SCRYPT"
+		request.SignerKey = base64.URLEncoding.EncodeToString(signerKey)
+		request.SaltSeparator = base64.URLEncoding.EncodeToString(saltSep)
+		request.Rounds = ph.config.Rounds
+		request.MemoryCost = ph.config.MemoryCost
+	}
+	return request, nil
+}
+
+func providerUserInfoPayload(providers []*UserInfo) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	for _, p := range providers {
+		if p == nil || p.ProviderID == "" || p.UID == "" {
+			return nil, errors.New("provider data must specify a provider id and a uid")
+		}
+		info := map[string]interface{}{
+			"providerId": p.ProviderID,
+			"rawId":      p.UID,
+		}
+		fields := []struct {
+			key, val string
+			validate func(interface{}) error
+		}{
+			{"displayName", p.DisplayName, validateDisplayName},
+			{"email", p.Email, validateEmail},
+			{"phoneNumber", p.PhoneNumber, validatePhone},
+			{"photoUrl", p.PhotoURL, validatePhotoURL},
+		}
+		for _, f := range fields {
+			if f.val == "" {
+				continue
+			}
+			if err := f.validate(f.val); err != nil {
+				return nil, err
+			}
+			info[f.key] = f.val
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+func mfaInfoPayload(factors []*MultiFactorInfo) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	for _, f := range factors {
+		if f == nil {
+			return nil, errors.New("second factor must not be nil")
+		}
+		if err := validatePhone(f.PhoneNumber); err != nil {
+			return nil, err
+		}
+		info := map[string]interface{}{"phoneInfo": f.PhoneNumber}
+		if f.UID != "" {
+			info["mfaEnrollmentId"] = f.UID
+		}
+		if f.DisplayName != "" {
+			info["displayName"] = f.DisplayName
+		}
+		if !f.EnrolledAt.IsZero() {
+			info["enrolledAt"] = f.EnrolledAt.UTC().Format(time.RFC3339Nano)
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+func TestCreateUserWithImport(t *testing.T) {
+	s := echoServer(testGetUserResponse, t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+
+	user, err := s.Client.CreateUser(context.Background(), (&UserToCreate{}).
+		UID("testuser").
+		CustomClaims(map[string]interface{}{"admin": true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(user, testUser) {
+		t.Errorf("CreateUser() = %#v; want = %#v", user, testUser)
+	}
+	if len(s.Req) != 2 || s.Req[0].URL.Path != "/projects/mock-project-id/accounts:batchCreate" {
+		t.Errorf("CreateUser() request = %s; want = /projects/mock-project-id/accounts:batchCreate", s.Req[0].URL.Path)
+	}
+}
+
+func TestCreateUserWithImportSanityCheck(t *testing.T) {
+	s := echoServer([]byte(`{}`), t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+
+	if _, err := s.Client.createUser(context.Background(), (&UserToCreate{}).UID("testuser").CreatedAt(time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["sanityCheck"] != true {
+		t.Errorf("createUser() sanityCheck = %v; want = true", got["sanityCheck"])
+	}
+}
+
+func TestCreateUserWithImportError(t *testing.T) {
+	s := echoServer([]byte(`{"error": [{"index": 0, "message": "localId belongs to an existing account"}]}`), t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+
+	user, err := s.Client.CreateUser(context.Background(), (&UserToCreate{}).UID("testuser").CreatedAt(time.Now()))
+	if gerr, ok := err.(*googleapi.Error); user != nil || !ok || gerr.Message != "DUPLICATE_LOCAL_ID" {
+		t.Errorf("CreateUser() = (%v, %v); want = (nil, DUPLICATE_LOCAL_ID)", user, err)
+	}
+	if gerr, ok := err.(*googleapi.Error); ok && !strings.Contains(gerr.Body, "existing account") {
+		t.Errorf("CreateUser() error body = %q; want = original message", gerr.Body)
+	}
+
+	s.Client.projectID = ""
+	user, err = s.Client.CreateUser(context.Background(), (&UserToCreate{}).UID("testuser").CreatedAt(time.Now()))
+	if user != nil || err == nil {
+		t.Errorf("CreateUser() = (%v, %v); want = (nil, error)", user, err)
+	}
+	if len(s.Req) != 1 {
+		t.Errorf("CreateUser() sent %d requests; want = 1", len(s.Req))
+	}
+}
+
+func TestBatchCreateError(t *testing.T) {
+	cases := []struct {
+		msg  string
+		want string
+	}{
+		{"localId belongs to an existing account", "googleapi: Error 400: DUPLICATE_LOCAL_ID"},
+		{"raw id exists in other account in database", "googleapi: Error 400: DUPLICATE_LOCAL_ID"},
+		{"email exists in other account in database", "googleapi: Error 400: EMAIL_EXISTS"},
+		{"phone number exists in other account in database", "googleapi: Error 400: PHONE_NUMBER_EXISTS"},
+		{"Invalid email", "failed to create user: Invalid email"},
+	}
+	for _, tc := range cases {
+		if err := batchCreateError(tc.msg, nil); err.Error() != tc.want {
+			t.Errorf("batchCreateError(%q) = %v; want = %v", tc.msg, err, tc.want)
+		}
+	}
+}
+
+func TestImportPayload(t *testing.T) {
+	user := (&UserToCreate{}).
+		UID("user1").
+		Email("user@example.com").
+		EmailVerified(true).
+		DisplayName("Test User").
+		Disabled(false).
+		CustomClaims(map[string]interface{}{"admin": true}).
+		CreatedAt(time.Unix(1500000000, 0)).
+		LastLoginAt(time.Unix(1500000001, 500000000)).
+		PasswordHash(toWebSafeBase64.Replace(testScryptHash), testScryptSalt, testHashConfig).
+		ProviderData(&UserInfo{
+			ProviderID: "google.com",
+			UID:        "google-uid",
+			Email:      "user@gmail.com",
+		}).
+		MultiFactor(&MultiFactorInfo{
+			UID:         "enrollment1",
+			PhoneNumber: "+1234567890",
+			EnrolledAt:  time.Unix(1500000002, 0),
+		})
+
+	request, err := user.importPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{
+				"localId":          "user1",
+				"email":            "user@example.com",
+				"emailVerified":    true,
+				"displayName":      "Test User",
+				"disabled":         false,
+				"customAttributes": `{"admin":true}`,
+				"createdAt":        "1500000000000",
+				"lastLoginAt":      "1500000001500",
+				"passwordHash":     toWebSafeBase64.Replace(testScryptHash),
+				"salt":             toWebSafeBase64.Replace(testScryptSalt),
+				"providerUserInfo": []interface{}{
+					map[string]interface{}{
+						"providerId": "google.com",
+						"rawId":      "google-uid",
+						"email":      "user@gmail.com",
+					},
+				},
+				"mfaInfo": []interface{}{
+					map[string]interface{}{
+						"mfaEnrollmentId": "enrollment1",
+						"phoneInfo":       "+1234567890",
+						"enrolledAt":      "2017-07-14T02:40:02Z",
+					},
+				},
+			},
+		},
+		"sanityCheck":   true,
+		"hashAlgorithm": "SCRYPT",
+		"signerKey":     toWebSafeBase64.Replace(testHashConfig.SignerKey),
+		"saltSeparator": "Bw==",
+		"rounds":        8.0,
+		"memoryCost":    14.0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("importPayload() = %v; want = %v", got, want)
+	}
+}
+
+func TestInvalidImportPayload(t *testing.T) {
+	badConfig := testHashConfig
+	badConfig.Rounds = 0
+	cases := []*UserToCreate{
+		(&UserToCreate{}).CreatedAt(time.Now()),
+		(&UserToCreate{}).UID("user1").Password("password").CreatedAt(time.Now()),
+		(&UserToCreate{}).UID("user1").Email("not-an-email").CreatedAt(time.Now()),
+		(&UserToCreate{}).UID("user1").CreatedAt(time.Time{}),
+		(&UserToCreate{}).UID("user1").LastLoginAt(time.Time{}),
+		(&UserToCreate{}).UID("user1").CustomClaims(map[string]interface{}{"sub": "other"}),
+		(&UserToCreate{}).UID("user1").ProviderData(nil),
+		(&UserToCreate{}).UID("user1").ProviderData(&UserInfo{ProviderID: "google.com"}),
+		(&UserToCreate{}).UID("user1").ProviderData(&UserInfo{ProviderID: "google.com", UID: "g", Email: "bad"}),
+		(&UserToCreate{}).UID("user1").MultiFactor(nil),
+		(&UserToCreate{}).UID("user1").MultiFactor(&MultiFactorInfo{PhoneNumber: "1234"}),
+		(&UserToCreate{}).UID("user1").PasswordHash(testScryptHash, testScryptSalt, badConfig),
+		(&UserToCreate{}).UID("user1").PasswordHash("", testScryptSalt, testHashConfig),
+		(&UserToCreate{}).UID("user1").PasswordHash(testScryptHash, "not base64!", testHashConfig),
+	}
+	for i, user := range cases {
+		if !user.requiresImport() {
+			t.Errorf("requiresImport(%d) = false; want = true", i)
+		}
+		if request, err := user.importPayload(); request != nil || err == nil {
+			t.Errorf("importPayload(%d) = (%v, %v); want = (nil, error)", i, request, err)
+		}
+	}
+
+	if (&UserToCreate{}).UID("user1").Password("password").requiresImport() {
+		t.Errorf("requiresImport() = true; want = false")
+	}
+}
+
+func TestCreateUserWithImportHTTPError(t *testing.T) {
+	s := echoServer([]byte(`{"error": {"message": "INVALID_HASH_ALGORITHM"}}`), t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+	s.Status = http.StatusBadRequest
+
+	user, err := s.Client.CreateUser(context.Background(), (&UserToCreate{}).UID("user1").CreatedAt(time.Now()))
+	if user != nil || err == nil || !strings.Contains(err.Error(), "INVALID_HASH_ALGORITHM") {
+		t.Errorf("CreateUser() = (%v, %v); want = (nil, INVALID_HASH_ALGORITHM)", user, err)
+	}
+}
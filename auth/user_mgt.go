@@ -21,10 +21,15 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/identitytoolkit/v3"
 	"google.golang.org/api/iterator"
+
+	"firebase.google.com/go/internal"
 )
 
 const maxReturnedResults = 1000
@@ -53,38 +58,93 @@ func (c *Client) setHeader(ic identitytoolkitCall) {
 
 // UserInfo is a collection of standard profile information for a user.
 type UserInfo struct {
-	DisplayName string
-	Email       string
-	PhoneNumber string
-	PhotoURL    string
+	DisplayName string `json:"displayName,omitempty"`
+	Email       string `json:"email,omitempty"`
+	PhoneNumber string `json:"phoneNumber,omitempty"`
+	PhotoURL    string `json:"photoUrl,omitempty"`
 	// In the ProviderUserInfo[] ProviderID can be a short domain name (e.g. google.com),
 	// or the identity of an OpenID identity provider.
 	// In UserRecord.UserInfo it will return the constant string "firebase".
-	ProviderID string
-	UID        string
+	ProviderID string `json:"providerId,omitempty"`
+	UID        string `json:"uid,omitempty"`
 }
 
 // UserMetadata contains additional metadata associated with a user account.
+//
+// Timestamps are in milliseconds since the epoch. LastRefreshTimestamp is the last time the user
+// obtained an ID token.
 type UserMetadata struct {
-	CreationTimestamp  int64
-	LastLogInTimestamp int64
+	CreationTimestamp    int64 `json:"creationTimestamp,omitempty"`
+	LastLogInTimestamp   int64 `json:"lastLogInTimestamp,omitempty"`
+	LastRefreshTimestamp int64 `json:"lastRefreshTimestamp,omitempty"`
 }
 
 // UserRecord contains metadata associated with a Firebase user account.
+//
+// UserRecord can be encoded to and decoded from JSON with the encoding/json package, which makes
+// it suitable for caching. The fields of the embedded UserInfo appear at the top level of the
+// JSON object, with the UID under the "uid" key.
 type UserRecord struct {
 	*UserInfo
-	CustomClaims     map[string]interface{}
-	Disabled         bool
-	EmailVerified    bool
-	ProviderUserInfo []*UserInfo
-	UserMetadata     *UserMetadata
+	CustomClaims     map[string]interface{} `json:"customClaims,omitempty"`
+	Disabled         bool                   `json:"disabled"`
+	EmailVerified    bool                   `json:"emailVerified"`
+	ProviderUserInfo []*UserInfo            `json:"providerUserInfo,omitempty"`
+	UserMetadata     *UserMetadata          `json:"userMetadata,omitempty"`
+
+	// TenantID is the ID of the tenant the user belongs to, or empty if the user does not belong
+	// to a tenant.
+	TenantID string `json:"tenantId,omitempty"`
+
+	// TokensValidAfterMillis is the time, in milliseconds since the epoch, before which the ID
+	// tokens and refresh tokens of the user are considered revoked.
+	TokensValidAfterMillis int64 `json:"tokensValidAfterMillis,omitempty"`
 }
 
 // ExportedUserRecord is the returned user value used when listing all the users.
 type ExportedUserRecord struct {
 	*UserRecord
-	PasswordHash string
-	PasswordSalt string
+	PasswordHash string `json:"passwordHash,omitempty"`
+	PasswordSalt string `json:"passwordSalt,omitempty"`
+}
+
+// Equal reports whether two user records hold the same data. Custom claims are compared by their
+// JSON encoding, so that a record decoded from JSON equals the record it was encoded from. A nil
+// slice or map equals an empty one, and nil metadata equals zero metadata.
+func (u *UserRecord) Equal(other *UserRecord) bool {
+	if u == nil || other == nil {
+		return u == other
+	}
+	if !userInfoEqual(u.UserInfo, other.UserInfo) ||
+		u.Disabled != other.Disabled ||
+		u.EmailVerified != other.EmailVerified ||
+		u.TenantID != other.TenantID ||
+		u.TokensValidAfterMillis != other.TokensValidAfterMillis ||
+		!claimsEqual(u.CustomClaims, other.CustomClaims) ||
+		len(u.ProviderUserInfo) != len(other.ProviderUserInfo) {
+		return false
+	}
+	for i, p := range u.ProviderUserInfo {
+		if !userInfoEqual(p, other.ProviderUserInfo[i]) {
+			return false
+		}
+	}
+
+	var m1, m2 UserMetadata
+	if u.UserMetadata != nil {
+		m1 = *u.UserMetadata
+	}
+	if other.UserMetadata != nil {
+		m2 = *other.UserMetadata
+	}
+	return m1 == m2
+}
+
+func userInfoEqual(a, b *UserInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
 // UserIterator is an iterator over Users.
@@ -96,6 +156,80 @@ type UserIterator struct {
 	nextFunc func() error
 	pageInfo *iterator.PageInfo
 	users    []*ExportedUserRecord
+	filter   *UserFilter
+}
+
+// UserFilter specifies the users returned by UsersWhere. A user must satisfy all the conditions
+// set in the filter to be returned. Conditions left at their zero value are ignored.
+type UserFilter struct {
+	// Disabled and EmailVerified, when set, must equal the corresponding fields of the user.
+	Disabled      *bool
+	EmailVerified *bool
+
+	// ProviderID, when set, must be the ID of one of the providers linked to the user.
+	ProviderID string
+
+	// The user must have been created, and must have last signed in, at or after the After times
+	// and before the Before times. Users who have never signed in do not match a last sign-in
+	// range.
+	CreatedAfter    time.Time
+	CreatedBefore   time.Time
+	LastLogInAfter  time.Time
+	LastLogInBefore time.Time
+
+	// CustomClaim, when set, must be the name of one of the custom claims of the user.
+	CustomClaim string
+}
+
+// Match reports whether the user satisfies all the conditions of the filter.
+func (f *UserFilter) Match(u *UserRecord) bool {
+	if f.Disabled != nil && *f.Disabled != u.Disabled {
+		return false
+	}
+	if f.EmailVerified != nil && *f.EmailVerified != u.EmailVerified {
+		return false
+	}
+	if f.ProviderID != "" {
+		found := false
+		for _, p := range u.ProviderUserInfo {
+			if p.ProviderID == f.ProviderID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.CustomClaim != "" {
+		if _, ok := u.CustomClaims[f.CustomClaim]; !ok {
+			return false
+		}
+	}
+
+	var created, lastLogIn int64
+	if u.UserMetadata != nil {
+		created = u.UserMetadata.CreationTimestamp
+		lastLogIn = u.UserMetadata.LastLogInTimestamp
+	}
+	if !inTimeRange(created, f.CreatedAfter, f.CreatedBefore) {
+		return false
+	}
+	return inTimeRange(lastLogIn, f.LastLogInAfter, f.LastLogInBefore)
+}
+
+// inTimeRange reports whether the timestamp, in milliseconds, is at or after the start time and
+// before the end time. A zero start or end time leaves the range open on that side, but a zero
+// timestamp never matches a range that is not fully open.
+func inTimeRange(millis int64, start, end time.Time) bool {
+	if start.IsZero() && end.IsZero() {
+		return true
+	}
+	if millis == 0 {
+		return false
+	}
+	t := time.Unix(0, millis*int64(time.Millisecond))
+	return (start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end))
 }
 
 // UserToCreate is the parameter struct for the CreateUser function.
@@ -110,6 +244,15 @@ func (u *UserToCreate) set(key string, value interface{}) {
 	u.params[key] = value
 }
 
+// CreatedAt setter.
+func (u *UserToCreate) CreatedAt(t time.Time) *UserToCreate { u.set("createdAt", t); return u }
+
+// CustomClaims setter.
+func (u *UserToCreate) CustomClaims(cc map[string]interface{}) *UserToCreate {
+	u.set("customClaims", cc)
+	return u
+}
+
 // Disabled setter.
 func (u *UserToCreate) Disabled(d bool) *UserToCreate { u.set("disabled", d); return u }
 
@@ -122,15 +265,39 @@ func (u *UserToCreate) Email(e string) *UserToCreate { u.set("email", e); return
 // EmailVerified setter.
 func (u *UserToCreate) EmailVerified(ev bool) *UserToCreate { u.set("emailVerified", ev); return u }
 
+// LastLoginAt setter.
+func (u *UserToCreate) LastLoginAt(t time.Time) *UserToCreate { u.set("lastLoginAt", t); return u }
+
+// MultiFactor setter.
+func (u *UserToCreate) MultiFactor(factors ...*MultiFactorInfo) *UserToCreate {
+	u.set("mfaInfo", factors)
+	return u
+}
+
 // Password setter.
 func (u *UserToCreate) Password(pw string) *UserToCreate { u.set("password", pw); return u }
 
+// PasswordHash sets the password of the user from a hash computed with Firebase's modified
+// scrypt algorithm, such as ExportedUserRecord.PasswordHash and PasswordSalt, along with the
+// parameters the hash was computed with. It cannot be combined with Password.
+func (u *UserToCreate) PasswordHash(hash, salt string, config HashConfig) *UserToCreate {
+	u.set("passwordHash", &passwordHash{hash: hash, salt: salt, config: config})
+	return u
+}
+
 // PhoneNumber setter.
 func (u *UserToCreate) PhoneNumber(phone string) *UserToCreate { u.set("phoneNumber", phone); return u }
 
 // PhotoURL setter.
 func (u *UserToCreate) PhotoURL(url string) *UserToCreate { u.set("photoUrl", url); return u }
 
+// ProviderData setter. Each UserInfo links the user to an account with an identity provider,
+// identified by its ProviderID and UID.
+func (u *UserToCreate) ProviderData(providers ...*UserInfo) *UserToCreate {
+	u.set("providerUserInfo", providers)
+	return u
+}
+
 // UID setter.
 func (u *UserToCreate) UID(uid string) *UserToCreate { u.set("localId", uid); return u }
 
@@ -174,6 +341,12 @@ func (u *UserToUpdate) PhoneNumber(phone string) *UserToUpdate { u.set("phoneNum
 func (u *UserToUpdate) PhotoURL(url string) *UserToUpdate { u.set("photoUrl", url); return u }
 
 // CreateUser creates a new user with the specified properties.
+//
+// If the custom claims, provider data, creation or last sign-in time, password hash or second
+// factors of the user are specified, the user is created with the accounts:batchCreate endpoint
+// of the Identity Toolkit v1 API, which requires the UID of the user and the project ID to be
+// set. Either way, a conflict with an existing user is returned as a *googleapi.Error whose
+// Message is DUPLICATE_LOCAL_ID, EMAIL_EXISTS or PHONE_NUMBER_EXISTS.
 func (c *Client) CreateUser(ctx context.Context, user *UserToCreate) (*UserRecord, error) {
 	uid, err := c.createUser(ctx, user)
 	if err != nil {
@@ -258,24 +431,103 @@ func (c *Client) Users(ctx context.Context, nextPageToken string) *UserIterator
 	return it
 }
 
+// UsersWhere returns an iterator over the Users that match the given filter.
+//
+// The backend does not support filtering user accounts, so all the accounts of the project are
+// still downloaded, and the filter is applied as each page is received. Pages returned through
+// PageInfo may therefore contain fewer users than requested, or none at all.
+func (c *Client) UsersWhere(ctx context.Context, filter *UserFilter) *UserIterator {
+	it := c.Users(ctx, "")
+	it.filter = filter
+	return it
+}
+
+// ForEachUser calls fn for every user of the project, running up to parallelism calls
+// concurrently.
+//
+// Pages of users are downloaded sequentially and in order, while earlier users are still being
+// processed, so that a slow callback does not hold back the download of the next page. Calls to
+// fn for different users may complete in any order. If fn returns an error, or the download of
+// a page fails, the context passed to the pending calls is cancelled, no further calls are made,
+// and ForEachUser returns the first error encountered.
+func (c *Client) ForEachUser(ctx context.Context, parallelism int, fn func(context.Context, *ExportedUserRecord) error) error {
+	if parallelism < 1 {
+		return fmt.Errorf("parallelism must be at least 1; got %d", parallelism)
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		once     sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	// The buffer holds a full page, so that the next page can be fetched while it is processed.
+	users := make(chan *ExportedUserRecord, maxReturnedResults)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range users {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := fn(ctx, u); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	it := c.Users(ctx, "")
+	for ctx.Err() == nil {
+		u, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			fail(err)
+			break
+		}
+		select {
+		case users <- u:
+		case <-ctx.Done():
+		}
+	}
+	close(users)
+	wg.Wait()
+
+	if firstErr == nil {
+		return parent.Err()
+	}
+	return firstErr
+}
+
 func (it *UserIterator) fetch(pageSize int, pageToken string) (string, error) {
 	request := &identitytoolkit.IdentitytoolkitRelyingpartyDownloadAccountRequest{
 		MaxResults:    int64(pageSize),
 		NextPageToken: pageToken,
 	}
-	call := it.client.is.Relyingparty.DownloadAccount(request)
-	it.client.setHeader(call)
-	resp, err := call.Context(it.ctx).Do()
-	if err != nil {
+	var resp downloadAccountResponse
+	if err := it.client.relyingpartyCall(it.ctx, "downloadAccount", request, &resp); err != nil {
 		return "", err
 	}
 
 	for _, u := range resp.Users {
-		eu, err := makeExportedUser(u)
+		eu, err := parseUserResponse(u)
 		if err != nil {
 			return "", err
 		}
-		it.users = append(it.users, eu)
+		if it.filter == nil || it.filter.Match(eu.UserRecord) {
+			it.users = append(it.users, eu)
+		}
 	}
 	it.pageInfo.Token = resp.NextPageToken
 	return resp.NextPageToken, nil
@@ -535,6 +787,9 @@ func (c *Client) createUser(ctx context.Context, user *UserToCreate) (string, er
 	if user == nil {
 		user = &UserToCreate{}
 	}
+	if user.requiresImport() {
+		return c.importUser(ctx, user)
+	}
 
 	request := &identitytoolkit.IdentitytoolkitRelyingpartySignupNewUserRequest{}
 
@@ -576,23 +831,58 @@ func (c *Client) updateUser(ctx context.Context, uid string, user *UserToUpdate)
 }
 
 func (c *Client) getUser(ctx context.Context, request *identitytoolkit.IdentitytoolkitRelyingpartyGetAccountInfoRequest) (*UserRecord, error) {
-	call := c.is.Relyingparty.GetAccountInfo(request)
-	c.setHeader(call)
-	resp, err := call.Context(ctx).Do()
-	if err != nil {
+	var resp getAccountInfoResponse
+	if err := c.relyingpartyCall(ctx, "getAccountInfo", request, &resp); err != nil {
 		return nil, err
 	}
 	if len(resp.Users) == 0 {
 		return nil, fmt.Errorf("cannot find user from params: %v", request)
 	}
 
-	eu, err := makeExportedUser(resp.Users[0])
+	eu, err := parseUserResponse(resp.Users[0])
 	if err != nil {
 		return nil, err
 	}
 	return eu.UserRecord, nil
 }
 
+// getAccountInfoResponse and downloadAccountResponse hold the users returned by the
+// getAccountInfo and downloadAccount endpoints as raw JSON. The generated client drops the
+// fields it does not know about, such as the tenant ID and the last refresh time of the user, so
+// the users are parsed with parseUserResponse instead.
+type getAccountInfoResponse struct {
+	Users []json.RawMessage `json:"users"`
+}
+
+type downloadAccountResponse struct {
+	Users         []json.RawMessage `json:"users"`
+	NextPageToken string            `json:"nextPageToken"`
+}
+
+// relyingpartyCall sends request to the given method of the Identity Toolkit v3 relyingparty
+// API, and unmarshals the response into result. Like the generated client, it reports error
+// responses as a *googleapi.Error.
+func (c *Client) relyingpartyCall(ctx context.Context, method string, request, result interface{}) error {
+	resp, err := c.hc.Do(ctx, &internal.Request{
+		Method: http.MethodPost,
+		URL:    c.is.BasePath + method,
+		Body:   internal.NewJSONEntity(request),
+		Opts:   []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Status != http.StatusOK {
+		return &googleapi.Error{
+			Code:    resp.Status,
+			Message: parseErrorResponse(resp.Body),
+			Body:    string(resp.Body),
+			Header:  resp.Header,
+		}
+	}
+	return json.Unmarshal(resp.Body, result)
+}
+
 func makeExportedUser(r *identitytoolkit.UserInfo) (*ExportedUserRecord, error) {
 	var cc map[string]interface{}
 	if r.CustomAttributes != "" {
@@ -636,9 +926,40 @@ func makeExportedUser(r *identitytoolkit.UserInfo) (*ExportedUserRecord, error)
 				LastLogInTimestamp: r.LastLoginAt,
 				CreationTimestamp:  r.CreatedAt,
 			},
+			TokensValidAfterMillis: r.ValidSince * 1000,
 		},
 		PasswordHash: r.PasswordHash,
 		PasswordSalt: r.Salt,
 	}
 	return resp, nil
 }
+
+// parseUserResponse parses a user account returned by the Identity Toolkit API, including the
+// tenant ID and last refresh time of the user, which the generated client does not expose.
+func parseUserResponse(b []byte) (*ExportedUserRecord, error) {
+	var r identitytoolkit.UserInfo
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	var extra struct {
+		LastRefreshAt string `json:"lastRefreshAt"`
+		TenantID      string `json:"tenantId"`
+	}
+	if err := json.Unmarshal(b, &extra); err != nil {
+		return nil, err
+	}
+
+	eu, err := makeExportedUser(&r)
+	if err != nil {
+		return nil, err
+	}
+	eu.TenantID = extra.TenantID
+	if extra.LastRefreshAt != "" {
+		t, err := time.Parse(time.RFC3339, extra.LastRefreshAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid last refresh time: %q", extra.LastRefreshAt)
+		}
+		eu.UserMetadata.LastRefreshTimestamp = t.UnixNano() / int64(time.Millisecond)
+	}
+	return eu, nil
+}
@@ -17,13 +17,19 @@ package auth
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"firebase.google.com/go/internal"
 
@@ -63,7 +69,8 @@ var testUser = &UserRecord{
 		CreationTimestamp:  1234567890,
 		LastLogInTimestamp: 1233211232,
 	},
-	CustomClaims: map[string]interface{}{"admin": true, "package": "gold"},
+	CustomClaims:           map[string]interface{}{"admin": true, "package": "gold"},
+	TokensValidAfterMillis: 1494364393000,
 }
 
 func TestGetUser(t *testing.T) {
@@ -160,6 +167,49 @@ func TestGetNonExistingUser(t *testing.T) {
 	}
 }
 
+func TestGetUserTenantAndLastRefresh(t *testing.T) {
+	resp := `{
+		"users": [{
+			"localId": "testuser",
+			"lastRefreshAt": "2017-07-14T02:40:00.500Z",
+			"tenantId": "tenant1"
+		}],
+		"nextPageToken": ""
+	}`
+	s := echoServer([]byte(resp), t)
+	defer s.Close()
+
+	check := func(name string, u *UserRecord) {
+		if u.TenantID != "tenant1" {
+			t.Errorf("%s() TenantID = %q; want = %q", name, u.TenantID, "tenant1")
+		}
+		if u.UserMetadata.LastRefreshTimestamp != 1500000000500 {
+			t.Errorf("%s() LastRefreshTimestamp = %d; want = %d",
+				name, u.UserMetadata.LastRefreshTimestamp, 1500000000500)
+		}
+	}
+
+	ctx := context.Background()
+	lookups := map[string]func() (*UserRecord, error){
+		"GetUser":              func() (*UserRecord, error) { return s.Client.GetUser(ctx, "testuser") },
+		"GetUserByEmail":       func() (*UserRecord, error) { return s.Client.GetUserByEmail(ctx, "test@email.com") },
+		"GetUserByPhoneNumber": func() (*UserRecord, error) { return s.Client.GetUserByPhoneNumber(ctx, "+1234567890") },
+	}
+	for name, lookup := range lookups {
+		u, err := lookup()
+		if err != nil {
+			t.Fatalf("%s() = %v", name, err)
+		}
+		check(name, u)
+	}
+
+	u, err := s.Client.Users(ctx, "").Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("Users", u.UserRecord)
+}
+
 func TestListUsers(t *testing.T) {
 	s := echoServer(testListUsersResponse, t)
 	defer s.Close()
@@ -214,6 +264,128 @@ func TestListUsers(t *testing.T) {
 		"pageToken", map[string]interface{}{"maxResults": 1000, "nextPageToken": "pageToken"})
 }
 
+func TestUsersWhere(t *testing.T) {
+	resp := map[string]interface{}{
+		"users": []map[string]interface{}{
+			{"localId": "user1", "disabled": true, "createdAt": "1000", "lastLoginAt": "5000"},
+			{
+				"localId":          "user2",
+				"emailVerified":    true,
+				"createdAt":        "2000",
+				"providerUserInfo": []map[string]interface{}{{"providerId": "google.com", "rawId": "g1"}},
+				"customAttributes": `{"admin": true}`,
+			},
+			{"localId": "user3", "createdAt": "3000", "lastLoginAt": "4000"},
+		},
+	}
+	s := echoServer(resp, t)
+	defer s.Close()
+
+	yes, no := true, false
+	cases := []struct {
+		filter *UserFilter
+		want   []string
+	}{
+		{&UserFilter{}, []string{"user1", "user2", "user3"}},
+		{&UserFilter{Disabled: &yes}, []string{"user1"}},
+		{&UserFilter{Disabled: &no}, []string{"user2", "user3"}},
+		{&UserFilter{EmailVerified: &yes}, []string{"user2"}},
+		{&UserFilter{ProviderID: "google.com"}, []string{"user2"}},
+		{&UserFilter{ProviderID: "facebook.com"}, nil},
+		{&UserFilter{CustomClaim: "admin"}, []string{"user2"}},
+		{&UserFilter{CreatedAfter: time.Unix(2, 0)}, []string{"user2", "user3"}},
+		{&UserFilter{CreatedBefore: time.Unix(2, 0)}, []string{"user1"}},
+		{&UserFilter{LastLogInAfter: time.Unix(4, 500000000)}, []string{"user1"}},
+		{&UserFilter{LastLogInBefore: time.Unix(10, 0)}, []string{"user1", "user3"}},
+		{&UserFilter{Disabled: &no, CreatedAfter: time.Unix(1, 0), LastLogInBefore: time.Unix(10, 0)}, []string{"user3"}},
+	}
+	for _, tc := range cases {
+		var got []string
+		it := s.Client.UsersWhere(context.Background(), tc.filter)
+		for {
+			u, err := it.Next()
+			if err == iterator.Done {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, u.UID)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("UsersWhere(%+v) = %v; want = %v", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestForEachUser(t *testing.T) {
+	var users []map[string]interface{}
+	for i := 0; i < 50; i++ {
+		users = append(users, map[string]interface{}{"localId": fmt.Sprintf("user%d", i)})
+	}
+	s := echoServer(map[string]interface{}{"users": users}, t)
+	defer s.Close()
+
+	var (
+		mu                sync.Mutex
+		seen              = map[string]bool{}
+		active, maxActive int
+	)
+	err := s.Client.ForEachUser(context.Background(), 4, func(ctx context.Context, u *ExportedUserRecord) error {
+		mu.Lock()
+		seen[u.UID] = true
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(users) {
+		t.Errorf("ForEachUser() visited %d users; want = %d", len(seen), len(users))
+	}
+	if maxActive > 4 {
+		t.Errorf("ForEachUser() concurrency = %d; want <= 4", maxActive)
+	}
+}
+
+func TestForEachUserError(t *testing.T) {
+	s := echoServer(testListUsersResponse, t)
+	defer s.Close()
+
+	fn := func(ctx context.Context, u *ExportedUserRecord) error { return nil }
+	if err := s.Client.ForEachUser(context.Background(), 0, fn); err == nil {
+		t.Errorf("ForEachUser(0) = nil; want = error")
+	}
+
+	want := errors.New("callback error")
+	var calls int32
+	err := s.Client.ForEachUser(context.Background(), 1, func(ctx context.Context, u *ExportedUserRecord) error {
+		atomic.AddInt32(&calls, 1)
+		return want
+	})
+	if err != want || calls != 1 {
+		t.Errorf("ForEachUser() = (%v, %d calls); want = (%v, 1 call)", err, calls, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Client.ForEachUser(ctx, 2, fn); err == nil {
+		t.Errorf("ForEachUser(cancelled) = nil; want = error")
+	}
+
+	s.Status = 500
+	if err := s.Client.ForEachUser(context.Background(), 2, fn); err == nil {
+		t.Errorf("ForEachUser() = nil; want = error")
+	}
+}
+
 func TestInvalidCreateUser(t *testing.T) {
 	cases := []struct {
 		params *UserToCreate
@@ -351,6 +523,72 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestCreateUserRecordingRedactsPassword(t *testing.T) {
+	s := echoServer([]byte(`{"localId": "testuser"}`), t)
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording.json")
+
+	newClient := func(rt http.RoundTripper) *Client {
+		hc := &http.Client{
+			Transport: &oauth2.Transport{Source: &mockTokenSource{"test.token"}, Base: rt},
+		}
+		client, err := NewClient(context.Background(), &internal.AuthConfig{
+			Opts:      []option.ClientOption{option.WithHTTPClient(hc)},
+			ProjectID: "mock-project-id",
+			Version:   "test.version",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.is.BasePath = s.Srv.URL + "/"
+		client.idToolkitV1Endpoint = s.Srv.URL
+		return client
+	}
+	users := []*UserToCreate{
+		(&UserToCreate{}).UID("testuser").Password("secret-password"),
+		(&UserToCreate{}).UID("testuser").PasswordHash(testScryptHash, testScryptSalt, testHashConfig),
+	}
+
+	client := newClient(&internal.RecordingTransport{Path: path})
+	for _, u := range users {
+		if _, err := client.createUser(context.Background(), u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := []string{
+		"secret-password",
+		toWebSafeBase64.Replace(testScryptHash),
+		toWebSafeBase64.Replace(testScryptSalt),
+		toWebSafeBase64.Replace(testHashConfig.SignerKey),
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("Recording contains %q; want redacted", secret)
+		}
+	}
+
+	// Requests are redacted the same way before they are matched, so the recording still replays.
+	rt, err := internal.NewReplayingTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = newClient(rt)
+	for _, u := range users {
+		if uid, err := client.createUser(context.Background(), u); uid != "testuser" || err != nil {
+			t.Errorf("createUser() = (%q, %v); want = (%q, nil)", uid, err, "testuser")
+		}
+	}
+}
+
 func TestInvalidUpdateUser(t *testing.T) {
 	cases := []struct {
 		params *UserToUpdate
@@ -647,6 +885,89 @@ func TestMakeExportedUser(t *testing.T) {
 	}
 }
 
+func TestUserRecordJSON(t *testing.T) {
+	user := &ExportedUserRecord{
+		UserRecord:   testUser,
+		PasswordHash: "passwordhash",
+		PasswordSalt: "salt",
+	}
+	b, err := json.Marshal(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got ExportedUserRecord
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, user) {
+		t.Errorf("Unmarshal(Marshal(%#v)) = %#v", user, &got)
+	}
+	if !got.Equal(testUser) {
+		t.Errorf("Equal() = false; want = true")
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]interface{}{
+		"uid":                    "testuser",
+		"providerId":             "firebase",
+		"tokensValidAfterMillis": 1494364393000.0,
+		"passwordHash":           "passwordhash",
+	} {
+		if m[k] != v {
+			t.Errorf("Marshal() %s = %v; want = %v", k, m[k], v)
+		}
+	}
+}
+
+func TestUserRecordEqual(t *testing.T) {
+	copyUser := func() *UserRecord {
+		b, err := json.Marshal(testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var u UserRecord
+		if err := json.Unmarshal(b, &u); err != nil {
+			t.Fatal(err)
+		}
+		return &u
+	}
+
+	if !testUser.Equal(copyUser()) {
+		t.Errorf("Equal(copy) = false; want = true")
+	}
+	var nilUser *UserRecord
+	if !nilUser.Equal(nil) || nilUser.Equal(testUser) || testUser.Equal(nil) {
+		t.Errorf("Equal(nil) = unexpected result")
+	}
+	a, b := &UserRecord{CustomClaims: map[string]interface{}{}}, &UserRecord{UserMetadata: &UserMetadata{}}
+	if !a.Equal(b) {
+		t.Errorf("Equal(empty) = false; want = true")
+	}
+
+	changes := []func(u *UserRecord){
+		func(u *UserRecord) { u.UserInfo.Email = "other@example.com" },
+		func(u *UserRecord) { u.UserInfo = nil },
+		func(u *UserRecord) { u.Disabled = true },
+		func(u *UserRecord) { u.EmailVerified = false },
+		func(u *UserRecord) { u.TenantID = "tenant" },
+		func(u *UserRecord) { u.TokensValidAfterMillis++ },
+		func(u *UserRecord) { u.CustomClaims["admin"] = false },
+		func(u *UserRecord) { u.ProviderUserInfo = u.ProviderUserInfo[:1] },
+		func(u *UserRecord) { u.ProviderUserInfo[1].UID = "other" },
+		func(u *UserRecord) { u.UserMetadata.LastRefreshTimestamp = 1 },
+	}
+	for i, change := range changes {
+		u := copyUser()
+		change(u)
+		if testUser.Equal(u) || u.Equal(testUser) {
+			t.Errorf("Equal(change %d) = true; want = false", i)
+		}
+	}
+}
+
 func TestHTTPError(t *testing.T) {
 	s := echoServer([]byte(`{"error":"test"}`), t)
 	defer s.Close()
@@ -744,6 +1065,7 @@ func echoServer(resp interface{}, t *testing.T) *mockAuthServer {
 		t.Fatal(err)
 	}
 	authClient.is.BasePath = s.Srv.URL + "/"
+	authClient.idToolkitV1Endpoint = s.Srv.URL
 	s.Client = authClient
 	return &s
 }
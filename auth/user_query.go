@@ -0,0 +1,218 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/net/context"
+
+	"firebase.google.com/go/internal"
+)
+
+const maxQueryResults = 500
+
+// UserSortField is a field by which the results of QueryUsers can be sorted.
+type UserSortField string
+
+const (
+	// SortByUID sorts users by their UID. This is the default.
+	SortByUID UserSortField = "USER_ID"
+
+	// SortByName sorts users by their display name.
+	SortByName UserSortField = "NAME"
+
+	// SortByCreatedAt sorts users by their creation time.
+	SortByCreatedAt UserSortField = "CREATED_AT"
+
+	// SortByLastLoginAt sorts users by their last sign-in time.
+	SortByLastLoginAt UserSortField = "LAST_LOGIN_AT"
+
+	// SortByUserEmail sorts users by their email address.
+	SortByUserEmail UserSortField = "USER_EMAIL"
+)
+
+// UserQuery is the parameter struct for the QueryUsers function.
+//
+// At most one of Email, PhoneNumber and UID may be set, to restrict the results to the users
+// with the given email address, phone number or UID. When none is set, all the users of the
+// project are queried.
+type UserQuery struct {
+	Email       string
+	PhoneNumber string
+	UID         string
+
+	// SortBy is the field the results are sorted by, in ascending order unless Descending is set.
+	SortBy     UserSortField
+	Descending bool
+
+	// Offset is the number of matching users to skip. Limit is the maximum number of users to
+	// return, up to 500. A zero Limit returns up to 500 users.
+	Offset int64
+	Limit  int64
+
+	// CountOnly requests only the total number of matching users, regardless of Offset and
+	// Limit. No users are returned.
+	CountOnly bool
+}
+
+// QueryUsersResult is the result of the QueryUsers function.
+type QueryUsersResult struct {
+	// Count is the total number of users that match the query when CountOnly is set. Otherwise
+	// the backend only counts the users in the returned page, and Count equals len(Users). Make
+	// a separate query with CountOnly set to get the total alongside a page of users.
+	Count int64
+	Users []*ExportedUserRecord
+}
+
+type queryUsersRequest struct {
+	ReturnUserInfo bool             `json:"returnUserInfo"`
+	Limit          string           `json:"limit,omitempty"`
+	Offset         string           `json:"offset,omitempty"`
+	SortBy         UserSortField    `json:"sortBy,omitempty"`
+	Order          string           `json:"order,omitempty"`
+	Expression     []*userQueryExpr `json:"expression,omitempty"`
+}
+
+type userQueryExpr struct {
+	Email       string `json:"email,omitempty"`
+	PhoneNumber string `json:"phoneNumber,omitempty"`
+	UserID      string `json:"userId,omitempty"`
+}
+
+type queryUsersResponse struct {
+	RecordsCount int64             `json:"recordsCount,string"`
+	UserInfo     []json.RawMessage `json:"userInfo"`
+}
+
+// QueryUsers returns a page of the users that match the given query, sorted by the given field.
+//
+// Unlike Users, which can only iterate over all the users of the project in UID order,
+// QueryUsers can return an arbitrary page of users sorted by creation time, last sign-in time,
+// display name or email, such as the most recent sign-ups. QueryUsers uses the accounts:query
+// endpoint of the Identity Toolkit v1 API, and requires the project ID to be set.
+func (c *Client) QueryUsers(ctx context.Context, q *UserQuery) (*QueryUsersResult, error) {
+	if c.projectID == "" {
+		return nil, errors.New("project id not available")
+	}
+	req, err := q.request()
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/projects/%s/accounts:query", c.idToolkitV1Endpoint, c.projectID)
+	resp, err := c.hc.Do(ctx, &internal.Request{
+		Method: http.MethodPost,
+		URL:    url,
+		Body:   internal.NewJSONEntity(req),
+		Opts:   []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result queryUsersResponse
+	if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+		return nil, err
+	}
+
+	qr := &QueryUsersResult{Count: result.RecordsCount}
+	for _, u := range result.UserInfo {
+		eu, err := parseUserResponse(u)
+		if err != nil {
+			return nil, err
+		}
+		qr.Users = append(qr.Users, eu)
+	}
+	return qr, nil
+}
+
+func (q *UserQuery) request() (*queryUsersRequest, error) {
+	if q == nil {
+		q = &UserQuery{}
+	}
+	if q.Offset < 0 {
+		return nil, errors.New("offset must not be negative")
+	}
+	if q.Limit < 0 || q.Limit > maxQueryResults {
+		return nil, fmt.Errorf("limit must be between 0 and %d", maxQueryResults)
+	}
+	switch q.SortBy {
+	case "", SortByUID, SortByName, SortByCreatedAt, SortByLastLoginAt, SortByUserEmail:
+	default:
+		return nil, fmt.Errorf("unsupported sort field: %q", q.SortBy)
+	}
+
+	req := &queryUsersRequest{
+		ReturnUserInfo: !q.CountOnly,
+		SortBy:         q.SortBy,
+	}
+	if q.Descending {
+		req.Order = "DESC"
+	} else if q.SortBy != "" {
+		req.Order = "ASC"
+	}
+	if q.Offset > 0 {
+		req.Offset = strconv.FormatInt(q.Offset, 10)
+	}
+	if q.Limit > 0 {
+		req.Limit = strconv.FormatInt(q.Limit, 10)
+	}
+
+	expr := &userQueryExpr{Email: q.Email, PhoneNumber: q.PhoneNumber, UserID: q.UID}
+	var set int
+	for _, v := range []string{expr.Email, expr.PhoneNumber, expr.UserID} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("at most one of email, phone number and uid may be specified")
+	}
+	if expr.Email != "" {
+		if err := validateEmail(expr.Email); err != nil {
+			return nil, err
+		}
+	}
+	if expr.PhoneNumber != "" {
+		if err := validatePhone(expr.PhoneNumber); err != nil {
+			return nil, err
+		}
+	}
+	if expr.UserID != "" {
+		if err := validateUID(expr.UserID); err != nil {
+			return nil, err
+		}
+	}
+	if set == 1 {
+		req.Expression = []*userQueryExpr{expr}
+	}
+	return req, nil
+}
+
+func parseErrorResponse(b []byte) string {
+	var p struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return ""
+	}
+	return p.Error.Message
+}
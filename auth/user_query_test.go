@@ -0,0 +1,169 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestQueryUsers(t *testing.T) {
+	resp := `{
+		"recordsCount": "2",
+		"userInfo": [
+			{
+				"localId": "user2",
+				"email": "user2@example.com",
+				"createdAt": "2000",
+				"lastRefreshAt": "2017-07-14T02:40:00.500Z",
+				"tenantId": "tenant1"
+			},
+			{"localId": "user1", "email": "user1@example.com", "createdAt": "1000"}
+		]
+	}`
+	s := echoServer([]byte(resp), t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+
+	result, err := s.Client.QueryUsers(context.Background(), &UserQuery{
+		SortBy:     SortByCreatedAt,
+		Descending: true,
+		Offset:     10,
+		Limit:      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 2 || len(result.Users) != 2 {
+		t.Fatalf("QueryUsers() = (%d, %d users); want = (2, 2 users)", result.Count, len(result.Users))
+	}
+	if result.Users[0].UID != "user2" || result.Users[0].UserMetadata.CreationTimestamp != 2000 {
+		t.Errorf("QueryUsers() = %#v; want = user2", result.Users[0].UserRecord)
+	}
+	if u := result.Users[0]; u.TenantID != "tenant1" || u.UserMetadata.LastRefreshTimestamp != 1500000000500 {
+		t.Errorf("QueryUsers() = (%q, %d); want = (%q, %d)",
+			u.TenantID, u.UserMetadata.LastRefreshTimestamp, "tenant1", 1500000000500)
+	}
+
+	req := s.Req[0]
+	if req.Method != http.MethodPost || req.URL.Path != "/projects/mock-project-id/accounts:query" {
+		t.Errorf("QueryUsers() = %s %s; want = POST /projects/mock-project-id/accounts:query", req.Method, req.URL.Path)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"returnUserInfo": true,
+		"sortBy":         "CREATED_AT",
+		"order":          "DESC",
+		"offset":         "10",
+		"limit":          "2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryUsers() request = %v; want = %v", got, want)
+	}
+}
+
+func TestQueryUsersExpression(t *testing.T) {
+	s := echoServer([]byte(`{"recordsCount": "1"}`), t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+
+	cases := []struct {
+		query *UserQuery
+		want  string
+	}{
+		{
+			&UserQuery{CountOnly: true},
+			`{"returnUserInfo":false}`,
+		},
+		{
+			&UserQuery{Email: "user@example.com", SortBy: SortByUserEmail},
+			`{"returnUserInfo":true,"sortBy":"USER_EMAIL","order":"ASC","expression":[{"email":"user@example.com"}]}`,
+		},
+		{
+			&UserQuery{PhoneNumber: "+1234567890", CountOnly: true},
+			`{"returnUserInfo":false,"expression":[{"phoneNumber":"+1234567890"}]}`,
+		},
+		{
+			&UserQuery{UID: "user1"},
+			`{"returnUserInfo":true,"expression":[{"userId":"user1"}]}`,
+		},
+		{
+			nil,
+			`{"returnUserInfo":true}`,
+		},
+	}
+	for _, tc := range cases {
+		result, err := s.Client.QueryUsers(context.Background(), tc.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Count != 1 || result.Users != nil {
+			t.Errorf("QueryUsers(%+v) = %+v; want = {Count: 1}", tc.query, result)
+		}
+		if string(s.Rbody) != tc.want {
+			t.Errorf("QueryUsers(%+v) request = %s; want = %s", tc.query, string(s.Rbody), tc.want)
+		}
+	}
+}
+
+func TestInvalidQueryUsers(t *testing.T) {
+	s := echoServer(nil, t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+
+	cases := []*UserQuery{
+		{Offset: -1},
+		{Limit: -1},
+		{Limit: 501},
+		{SortBy: "UNKNOWN"},
+		{Email: "user@example.com", UID: "user1"},
+		{Email: "not-an-email"},
+		{PhoneNumber: "1234"},
+		{UID: strings.Repeat("a", 129)},
+	}
+	for _, q := range cases {
+		if result, err := s.Client.QueryUsers(context.Background(), q); result != nil || err == nil {
+			t.Errorf("QueryUsers(%+v) = (%v, %v); want = (nil, error)", q, result, err)
+		}
+	}
+	if len(s.Req) != 0 {
+		t.Errorf("QueryUsers() sent %d requests; want = 0", len(s.Req))
+	}
+
+	s.Client.projectID = ""
+	if result, err := s.Client.QueryUsers(context.Background(), &UserQuery{}); result != nil || err == nil {
+		t.Errorf("QueryUsers() = (%v, %v); want = (nil, error)", result, err)
+	}
+}
+
+func TestQueryUsersError(t *testing.T) {
+	s := echoServer([]byte(`{"error": {"message": "INVALID_PAGE_SELECTION"}}`), t)
+	defer s.Close()
+	s.Client.projectID = "mock-project-id"
+	s.Status = http.StatusBadRequest
+
+	result, err := s.Client.QueryUsers(context.Background(), &UserQuery{})
+	if result != nil || err == nil || !strings.Contains(err.Error(), "INVALID_PAGE_SELECTION") {
+		t.Errorf("QueryUsers() = (%v, %v); want = (nil, INVALID_PAGE_SELECTION)", result, err)
+	}
+}
@@ -25,9 +25,13 @@ import (
 
 	"cloud.google.com/go/firestore"
 
+	"firebase.google.com/go/appcheck"
 	"firebase.google.com/go/auth"
 	"firebase.google.com/go/iid"
 	"firebase.google.com/go/internal"
+	"firebase.google.com/go/projectmanagement"
+	"firebase.google.com/go/remoteconfig"
+	"firebase.google.com/go/securityrules"
 	"firebase.google.com/go/storage"
 
 	"golang.org/x/net/context"
@@ -36,15 +40,6 @@ import (
 	"google.golang.org/api/transport"
 )
 
-var firebaseScopes = []string{
-	"https://www.googleapis.com/auth/cloud-platform",
-	"https://www.googleapis.com/auth/datastore",
-	"https://www.googleapis.com/auth/devstorage.full_control",
-	"https://www.googleapis.com/auth/firebase",
-	"https://www.googleapis.com/auth/identitytoolkit",
-	"https://www.googleapis.com/auth/userinfo.email",
-}
-
 // Version of the Firebase Go Admin SDK.
 const Version = "2.4.0"
 
@@ -53,25 +48,41 @@ const firebaseEnvName = "FIREBASE_CONFIG"
 
 // An App holds configuration and state common to all Firebase services that are exposed from the SDK.
 type App struct {
-	creds         *google.DefaultCredentials
-	projectID     string
-	storageBucket string
-	opts          []option.ClientOption
+	creds            *google.DefaultCredentials
+	projectID        string
+	serviceAccountID string
+	storageBucket    string
+	opts             []option.ClientOption
 }
 
 // Config represents the configuration used to initialize an App.
+//
+// ServiceAccountID is the email of the service account used to sign data (custom tokens and
+// signed URLs) when the credentials of the App do not contain a private key. Signing is then
+// performed remotely by the IAM service.
 type Config struct {
-	ProjectID     string `json:"projectId"`
-	StorageBucket string `json:"storageBucket"`
+	ProjectID        string `json:"projectId"`
+	ServiceAccountID string `json:"serviceAccountId"`
+	StorageBucket    string `json:"storageBucket"`
+}
+
+// AppCheck returns an instance of appcheck.Client.
+func (a *App) AppCheck(ctx context.Context) (*appcheck.Client, error) {
+	conf := &internal.AppCheckConfig{
+		ProjectID: a.projectID,
+		Opts:      a.opts,
+	}
+	return appcheck.NewClient(ctx, conf)
 }
 
 // Auth returns an instance of auth.Client.
 func (a *App) Auth(ctx context.Context) (*auth.Client, error) {
 	conf := &internal.AuthConfig{
-		Creds:     a.creds,
-		ProjectID: a.projectID,
-		Opts:      a.opts,
-		Version:   Version,
+		Creds:            a.creds,
+		ProjectID:        a.projectID,
+		ServiceAccountID: a.serviceAccountID,
+		Opts:             a.opts,
+		Version:          Version,
 	}
 	return auth.NewClient(ctx, conf)
 }
@@ -79,8 +90,11 @@ func (a *App) Auth(ctx context.Context) (*auth.Client, error) {
 // Storage returns a new instance of storage.Client.
 func (a *App) Storage(ctx context.Context) (*storage.Client, error) {
 	conf := &internal.StorageConfig{
-		Opts:   a.opts,
-		Bucket: a.storageBucket,
+		Opts:             a.opts,
+		Creds:            a.creds,
+		ProjectID:        a.projectID,
+		Bucket:           a.storageBucket,
+		ServiceAccountID: a.serviceAccountID,
 	}
 	return storage.NewClient(ctx, conf)
 }
@@ -103,6 +117,37 @@ func (a *App) InstanceID(ctx context.Context) (*iid.Client, error) {
 	return iid.NewClient(ctx, conf)
 }
 
+// ProjectManagement returns an instance of projectmanagement.Client.
+func (a *App) ProjectManagement(ctx context.Context) (*projectmanagement.Client, error) {
+	conf := &internal.ProjectManagementConfig{
+		ProjectID: a.projectID,
+		Opts:      a.opts,
+		Version:   Version,
+	}
+	return projectmanagement.NewClient(ctx, conf)
+}
+
+// RemoteConfig returns an instance of remoteconfig.Client.
+func (a *App) RemoteConfig(ctx context.Context) (*remoteconfig.Client, error) {
+	conf := &internal.RemoteConfigConfig{
+		ProjectID: a.projectID,
+		Opts:      a.opts,
+		Version:   Version,
+	}
+	return remoteconfig.NewClient(ctx, conf)
+}
+
+// SecurityRules returns an instance of securityrules.Client.
+func (a *App) SecurityRules(ctx context.Context) (*securityrules.Client, error) {
+	conf := &internal.SecurityRulesConfig{
+		ProjectID: a.projectID,
+		Bucket:    a.storageBucket,
+		Opts:      a.opts,
+		Version:   Version,
+	}
+	return securityrules.NewClient(ctx, conf)
+}
+
 // NewApp creates a new App from the provided config and client options.
 //
 // If the client options contain a valid credential (a service account file, a refresh token
@@ -112,7 +157,7 @@ func (a *App) InstanceID(ctx context.Context) (*iid.Client, error) {
 // `FIREBASE_CONFIG` environment variable. If the value in it starts with a `{` it is parsed as a
 // JSON object, otherwise it is assumed to be the name of the JSON file containing the options.
 func NewApp(ctx context.Context, config *Config, opts ...option.ClientOption) (*App, error) {
-	o := []option.ClientOption{option.WithScopes(firebaseScopes...)}
+	o := []option.ClientOption{option.WithScopes(internal.FirebaseScopes...)}
 	o = append(o, opts...)
 	creds, err := transport.Creds(ctx, o...)
 	if err != nil {
@@ -134,10 +179,11 @@ func NewApp(ctx context.Context, config *Config, opts ...option.ClientOption) (*
 	}
 
 	return &App{
-		creds:         creds,
-		projectID:     pid,
-		storageBucket: config.StorageBucket,
-		opts:          o,
+		creds:            creds,
+		projectID:        pid,
+		serviceAccountID: config.ServiceAccountID,
+		storageBucket:    config.StorageBucket,
+		opts:             o,
 	}, nil
 }
 
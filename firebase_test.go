@@ -214,6 +214,18 @@ func TestInvalidCredentialFile(t *testing.T) {
 	}
 }
 
+func TestAppCheck(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.AppCheck(ctx); c == nil || err != nil {
+		t.Errorf("AppCheck() = (%v, %v); want (appcheck, nil)", c, err)
+	}
+}
+
 func TestAuth(t *testing.T) {
 	ctx := context.Background()
 	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
@@ -303,6 +315,42 @@ func TestInstanceID(t *testing.T) {
 	}
 }
 
+func TestProjectManagement(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.ProjectManagement(ctx); c == nil || err != nil {
+		t.Errorf("ProjectManagement() = (%v, %v); want (projectmanagement, nil)", c, err)
+	}
+}
+
+func TestRemoteConfig(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.RemoteConfig(ctx); c == nil || err != nil {
+		t.Errorf("RemoteConfig() = (%v, %v); want (remoteconfig, nil)", c, err)
+	}
+}
+
+func TestSecurityRules(t *testing.T) {
+	ctx := context.Background()
+	app, err := NewApp(ctx, nil, option.WithCredentialsFile("testdata/service_account.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c, err := app.SecurityRules(ctx); c == nil || err != nil {
+		t.Errorf("SecurityRules() = (%v, %v); want (securityrules, nil)", c, err)
+	}
+}
+
 func TestCustomTokenSource(t *testing.T) {
 	ctx := context.Background()
 	ts := &testTokenSource{AccessToken: "mock-token-from-custom"}
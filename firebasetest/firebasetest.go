@@ -0,0 +1,79 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package firebasetest contains utilities for writing deterministic tests against the Admin SDK.
+//
+// WithRecorder returns a client option that records the HTTP interactions of the SDK to a file,
+// or replays them from that file without network access. Tests are typically run once in record
+// mode against a real project, and the resulting file is checked in and replayed in CI:
+//
+//	opt, err := firebasetest.WithRecorder("testdata/users.json",
+//		option.WithCredentialsFile("service_account.json"))
+//	...
+//	app, err := firebase.NewApp(ctx, config, option.WithCredentialsFile("service_account.json"), opt)
+package firebasetest
+
+import (
+	"net/http"
+	"os"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
+
+	"firebase.google.com/go/internal"
+)
+
+// RecordEnvVar is the name of the environment variable that enables record mode. When it is
+// set to a non-empty value, WithRecorder records interactions instead of replaying them.
+const RecordEnvVar = "FIREBASE_TEST_RECORD"
+
+// WithRecorder returns a client option that records or replays the HTTP interactions of the
+// clients created with it.
+//
+// In record mode, requests are sent to the real services, authorized with the credentials
+// specified in opts (or Google application default credentials if opts specifies none), and
+// the interactions are written to the file at path. Bearer tokens, API keys, and the token,
+// session cookie, action code and password fields of JSON bodies are redacted before they are
+// written. In replay mode, which is the
+// default, no requests are sent: each request is served the matching response recorded in the
+// file, and fails if there is none.
+//
+// The option applies to all the HTTP clients the SDK creates from it, including those of
+// auth.Client, iid.Client and storage.Client. It should be passed to firebase.NewApp after any
+// other options that configure the HTTP client.
+func WithRecorder(path string, opts ...option.ClientOption) (option.ClientOption, error) {
+	if os.Getenv(RecordEnvVar) == "" {
+		rt, err := internal.NewReplayingTransport(path)
+		if err != nil {
+			return nil, err
+		}
+		return option.WithHTTPClient(&http.Client{Transport: rt}), nil
+	}
+
+	ctx := context.Background()
+	o := []option.ClientOption{option.WithScopes(internal.FirebaseScopes...)}
+	creds, err := transport.Creds(ctx, append(o, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	hc := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: creds.TokenSource,
+			Base:   &internal.RecordingTransport{Path: path},
+		},
+	}
+	return option.WithHTTPClient(hc), nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firebasetest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
+
+	"firebase.google.com/go/iid"
+	"firebase.google.com/go/internal"
+)
+
+func tempFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "firebasetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "recording.json"), func() { os.RemoveAll(dir) }
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	path, cleanup := tempFile(t)
+	defer cleanup()
+
+	os.Setenv(RecordEnvVar, "1")
+	opt, err := WithRecorder(path, option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}))
+	os.Unsetenv(RecordEnvVar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc, _, err := transport.NewHTTPClient(context.Background(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hc.Get(server.URL + "/resource"); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer test-token" {
+		t.Errorf("Authorization = %q; want = %q", auth, "Bearer test-token")
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || strings.Contains(string(b), "test-token") {
+		t.Errorf("ReadFile() = (%q, %v); want redacted recording", string(b), err)
+	}
+
+	server.Close()
+	opt, err = WithRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc, _, err = transport.NewHTTPClient(context.Background(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hc.Get(server.URL + "/resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "ok" {
+		t.Errorf("Get() = %q; want = %q", string(b), "ok")
+	}
+}
+
+func TestReplayInstanceID(t *testing.T) {
+	path, cleanup := tempFile(t)
+	defer cleanup()
+	recording := `[{
+		"request": {
+			"method": "DELETE",
+			"url": "https://console.firebase.google.com/v1/project/mock-project-id/instanceId/test-iid"
+		},
+		"response": {"status": 200, "body": "{}"}
+	}]`
+	if err := ioutil.WriteFile(path, []byte(recording), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opt, err := WithRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := iid.NewClient(context.Background(), &internal.InstanceIDConfig{
+		Opts:      []option.ClientOption{opt},
+		ProjectID: "mock-project-id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteInstanceID(context.Background(), "test-iid"); err != nil {
+		t.Errorf("DeleteInstanceID() = %v; want = nil", err)
+	}
+	if err := client.DeleteInstanceID(context.Background(), "other-iid"); err == nil {
+		t.Errorf("DeleteInstanceID() = nil; want = error")
+	}
+}
+
+func TestWithRecorderError(t *testing.T) {
+	if opt, err := WithRecorder("../testdata/non_existing.json"); opt != nil || err == nil {
+		t.Errorf("WithRecorder() = (%v, %v); want = (nil, error)", opt, err)
+	}
+}
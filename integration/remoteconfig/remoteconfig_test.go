@@ -0,0 +1,93 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remoteconfig contains integration tests for the firebase.google.com/go/remoteconfig package.
+package remoteconfig
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"testing"
+
+	"google.golang.org/api/iterator"
+
+	"firebase.google.com/go/integration/internal"
+	"firebase.google.com/go/remoteconfig"
+)
+
+var client *remoteconfig.Client
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if testing.Short() {
+		log.Println("skipping remote config integration tests in short mode.")
+		os.Exit(0)
+	}
+
+	ctx := context.Background()
+	app, err := internal.NewTestApp(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	client, err = app.RemoteConfig(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestGetAndValidateTemplate(t *testing.T) {
+	ctx := context.Background()
+	template, err := client.GetTemplate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.ETag == "" {
+		t.Errorf("GetTemplate().ETag = %q; want non-empty", template.ETag)
+	}
+
+	template.Parameters = map[string]*remoteconfig.Parameter{
+		"admin_sdk_integration_test": {
+			DefaultValue: &remoteconfig.ParameterValue{Value: "true"},
+			ValueType:    remoteconfig.ValueTypeBoolean,
+		},
+	}
+	validated, err := client.ValidateTemplate(ctx, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validated.ETag != template.ETag {
+		t.Errorf("ValidateTemplate().ETag = %q; want = %q", validated.ETag, template.ETag)
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	it := client.ListVersions(context.Background(), nil)
+	for i := 0; i < 5; i++ {
+		v, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.VersionNumber <= 0 {
+			t.Errorf("VersionNumber = %d; want > 0", v.VersionNumber)
+		}
+	}
+}
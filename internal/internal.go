@@ -21,24 +21,66 @@ import (
 	"google.golang.org/api/option"
 )
 
+// FirebaseScopes is the set of OAuth2 scopes used by the Admin SDK.
+var FirebaseScopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+	"https://www.googleapis.com/auth/datastore",
+	"https://www.googleapis.com/auth/devstorage.full_control",
+	"https://www.googleapis.com/auth/firebase",
+	"https://www.googleapis.com/auth/identitytoolkit",
+	"https://www.googleapis.com/auth/userinfo.email",
+}
+
+// AppCheckConfig represents the configuration of Firebase App Check service.
+type AppCheckConfig struct {
+	Opts      []option.ClientOption
+	ProjectID string
+}
+
 // AuthConfig represents the configuration of Firebase Auth service.
 type AuthConfig struct {
+	Opts             []option.ClientOption
+	Creds            *google.DefaultCredentials
+	ProjectID        string
+	ServiceAccountID string
+	Version          string
+}
+
+// InstanceIDConfig represents the configuration of Firebase Instance ID service.
+type InstanceIDConfig struct {
+	Opts      []option.ClientOption
+	ProjectID string
+}
+
+// ProjectManagementConfig represents the configuration of Firebase Project Management service.
+type ProjectManagementConfig struct {
 	Opts      []option.ClientOption
-	Creds     *google.DefaultCredentials
 	ProjectID string
 	Version   string
 }
 
-// InstanceIDConfig represents the configuration of Firebase Instance ID service.
-type InstanceIDConfig struct {
+// RemoteConfigConfig represents the configuration of Firebase Remote Config service.
+type RemoteConfigConfig struct {
 	Opts      []option.ClientOption
 	ProjectID string
+	Version   string
+}
+
+// SecurityRulesConfig represents the configuration of Firebase Security Rules service.
+type SecurityRulesConfig struct {
+	Opts      []option.ClientOption
+	ProjectID string
+	Bucket    string
+	Version   string
 }
 
 // StorageConfig represents the configuration of Google Cloud Storage service.
 type StorageConfig struct {
-	Opts   []option.ClientOption
-	Bucket string
+	Opts             []option.ClientOption
+	Creds            *google.DefaultCredentials
+	ProjectID        string
+	Bucket           string
+	ServiceAccountID string
 }
 
 // MockTokenSource is a TokenSource implementation that can be used for testing.
@@ -0,0 +1,277 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const redacted = "REDACTED"
+
+// Headers, query parameters and JSON fields whose values are replaced with "REDACTED" in
+// recordings, since they carry credentials, or user passwords and the parameters of their hashes.
+var (
+	redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Goog-Api-Key"}
+	redactedParams  = []string{"access_token", "key"}
+	redactedFields  = map[string]bool{
+		"access_token":  true,
+		"id_token":      true,
+		"idToken":       true,
+		"oobCode":       true,
+		"oobLink":       true,
+		"password":      true,
+		"passwordHash":  true,
+		"private_key":   true,
+		"refresh_token": true,
+		"refreshToken":  true,
+		"salt":          true,
+		"sessionCookie": true,
+		"signerKey":     true,
+		"token":         true,
+	}
+)
+
+// Interaction is a recorded HTTP request, along with the response it received.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the redacted form of an HTTP request.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is the redacted form of an HTTP response.
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordingTransport is an http.RoundTripper that records the requests it sends, and the
+// responses it receives, to a file.
+//
+// Requests are sent with the Base transport. Credentials are redacted before interactions are
+// recorded. The file is rewritten after each interaction, so that it is complete even if the
+// process exits abruptly.
+type RecordingTransport struct {
+	Path string
+	Base http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []*Interaction
+}
+
+// RoundTrip sends the given request, and records it along with its response.
+func (t *RecordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	req, err := recordRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	header := redactHeader(resp.Header)
+	header.Del("Content-Length")
+	i := &Interaction{
+		Request: *req,
+		Response: RecordedResponse{
+			Status: resp.StatusCode,
+			Header: header,
+			Body:   redactBody(b),
+		},
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.interactions = append(t.interactions, i)
+	if err := writeInteractions(t.Path, t.interactions); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReplayingTransport is an http.RoundTripper that serves responses from a file written by
+// RecordingTransport, without sending any requests.
+//
+// A request is served the response of the first recorded interaction that has not been served
+// yet, and whose method, URL and body match those of the request after redaction.
+type ReplayingTransport struct {
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewReplayingTransport creates a new ReplayingTransport from the interactions recorded in the
+// specified file.
+func NewReplayingTransport(path string) (*ReplayingTransport, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var interactions []*Interaction
+	if err := json.Unmarshal(b, &interactions); err != nil {
+		return nil, fmt.Errorf("failed to parse recording %q: %v", path, err)
+	}
+	return &ReplayingTransport{
+		interactions: interactions,
+		used:         make([]bool, len(interactions)),
+	}, nil
+}
+
+// RoundTrip returns the recorded response to the given request.
+func (t *ReplayingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	req, err := recordRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for idx, i := range t.interactions {
+		if t.used[idx] || i.Request.Method != req.Method || i.Request.URL != req.URL ||
+			i.Request.Body != req.Body {
+			continue
+		}
+		t.used[idx] = true
+		header := http.Header{}
+		for k, v := range i.Response.Header {
+			header[k] = v
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.Response.Status, http.StatusText(i.Response.Status)),
+			StatusCode:    i.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader([]byte(i.Response.Body))),
+			ContentLength: int64(len(i.Response.Body)),
+			Request:       r,
+		}, nil
+	}
+	return nil, fmt.Errorf("no recorded interaction for request: %s %s", req.Method, req.URL)
+}
+
+func recordRequest(r *http.Request) (*RecordedRequest, error) {
+	var b []byte
+	if r.Body != nil {
+		var err error
+		if b, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+	return &RecordedRequest{
+		Method: r.Method,
+		URL:    redactURL(r.URL),
+		Header: redactHeader(r.Header),
+		Body:   redactBody(b),
+	}, nil
+}
+
+func redactHeader(h http.Header) http.Header {
+	result := http.Header{}
+	for k, v := range h {
+		result[k] = v
+	}
+	for _, k := range redactedHeaders {
+		if result.Get(k) != "" {
+			result.Set(k, redacted)
+		}
+	}
+	return result
+}
+
+func redactURL(u *url.URL) string {
+	c := *u
+	q := c.Query()
+	for _, p := range redactedParams {
+		if q.Get(p) != "" {
+			q.Set(p, redacted)
+		}
+	}
+	c.RawQuery = q.Encode()
+	return c.String()
+}
+
+// redactBody redacts the credentials in a JSON body. Bodies that are not JSON objects or
+// arrays are returned unchanged.
+func redactBody(b []byte) string {
+	var v interface{}
+	if len(b) == 0 || json.Unmarshal(b, &v) != nil {
+		return string(b)
+	}
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return string(b)
+	}
+	rb, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return string(b)
+	}
+	return string(rb)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, e := range val {
+			if redactedFields[k] {
+				val[k] = redacted
+			} else {
+				val[k] = redactValue(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range val {
+			val[i] = redactValue(e)
+		}
+	}
+	return v
+}
+
+func writeInteractions(path string, interactions []*Interaction) error {
+	b, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"localId": "user1", "refreshToken": "secret-refresh-token"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "not found"}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording.json")
+
+	send := func(hc *http.Client) (*http.Response, *http.Response) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/signup?key=secret-api-key",
+			strings.NewReader(`{"email": "user@example.com", "idToken": "secret-id-token"}`))
+		req.Header.Set("Authorization", "Bearer secret-access-token")
+		post, err := hc.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		get, err := hc.Get(server.URL + "/users/unknown")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return post, get
+	}
+
+	recorded, _ := send(&http.Client{Transport: &RecordingTransport{Path: path}})
+	if calls != 2 {
+		t.Errorf("Calls = %d; want = 2", calls)
+	}
+	if b, _ := ioutil.ReadAll(recorded.Body); !strings.Contains(string(b), "secret-refresh-token") {
+		t.Errorf("RoundTrip() = %q; want unredacted response", string(b))
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-api-key", "secret-id-token", "secret-access-token", "secret-refresh-token"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("Recording contains %q; want redacted", secret)
+		}
+	}
+
+	rt, err := NewReplayingTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := &http.Client{Transport: rt}
+	post, get := send(hc)
+	if calls != 2 {
+		t.Errorf("Calls = %d; want = 2", calls)
+	}
+	if b, _ := ioutil.ReadAll(post.Body); post.StatusCode != http.StatusOK ||
+		string(b) != `{"localId":"user1","refreshToken":"REDACTED"}` {
+		t.Errorf("Replay(POST) = (%d, %q); want = (200, recorded body)", post.StatusCode, string(b))
+	}
+	if post.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q; want = %q", post.Header.Get("Content-Type"), "application/json")
+	}
+	if b, _ := ioutil.ReadAll(get.Body); get.StatusCode != http.StatusNotFound || string(b) != `{"error":"not found"}` {
+		t.Errorf("Replay(GET) = (%d, %q); want = (404, recorded body)", get.StatusCode, string(b))
+	}
+
+	// Each interaction is replayed once.
+	if resp, err := hc.Get(server.URL + "/users/unknown"); err == nil {
+		t.Errorf("Replay(GET) = %v; want = error", resp)
+	}
+}
+
+func TestRecordRedactsBodySecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"sessionCookie": "secret-session-cookie",
+			"oobCode": "secret-oob-code",
+			"oobLink": "https://example.com/action?oobCode=secret-oob-link",
+			"users": [{"localId": "user1", "passwordHash": "secret-hash"}]
+		}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording.json")
+
+	hc := &http.Client{Transport: &RecordingTransport{Path: path}}
+	body := `{"token": "secret-custom-token", "returnSecureToken": true, "oobCode": "secret-request-oob-code"}`
+	resp, err := hc.Post(server.URL+"/accounts:signInWithCustomToken", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var interactions []*Interaction
+	if err := json.Unmarshal(b, &interactions); err != nil {
+		t.Fatal(err)
+	}
+	if len(interactions) != 1 {
+		t.Fatalf("Interactions = %d; want = 1", len(interactions))
+	}
+	i := interactions[0]
+	wantReq := `{"oobCode":"REDACTED","returnSecureToken":true,"token":"REDACTED"}`
+	if i.Request.Body != wantReq {
+		t.Errorf("Request.Body = %s; want = %s", i.Request.Body, wantReq)
+	}
+	wantResp := `{"oobCode":"REDACTED","oobLink":"REDACTED","sessionCookie":"REDACTED",` +
+		`"users":[{"localId":"user1","passwordHash":"REDACTED"}]}`
+	if i.Response.Body != wantResp {
+		t.Errorf("Response.Body = %s; want = %s", i.Response.Body, wantResp)
+	}
+}
+
+func TestReplayUnmatchedRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording.json")
+	recording := `[{
+		"request": {"method": "GET", "url": "https://example.com/foo"},
+		"response": {"status": 200, "body": "ok"}
+	}]`
+	if err := ioutil.WriteFile(path, []byte(recording), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := NewReplayingTransport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := &http.Client{Transport: rt}
+	for _, u := range []string{"https://example.com/bar", "https://example.com/foo?key=value"} {
+		if resp, err := hc.Get(u); err == nil {
+			t.Errorf("Get(%q) = %v; want = error", u, resp)
+		}
+	}
+	resp, err := hc.Get("https://example.com/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(resp.Body); string(b) != "ok" {
+		t.Errorf("Get() = %q; want = %q", string(b), "ok")
+	}
+}
+
+func TestReplayingTransportError(t *testing.T) {
+	if rt, err := NewReplayingTransport("../testdata/non_existing.json"); rt != nil || err == nil {
+		t.Errorf("NewReplayingTransport() = (%v, %v); want = (nil, error)", rt, err)
+	}
+	if rt, err := NewReplayingTransport("../testdata/firebase_config_invalid.json"); rt != nil || err == nil {
+		t.Errorf("NewReplayingTransport() = (%v, %v); want = (nil, error)", rt, err)
+	}
+}
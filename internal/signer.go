@@ -0,0 +1,168 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+)
+
+const iamSignBlobURL = "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:signBlob"
+
+// Signer signs byte strings on behalf of a Google service account.
+//
+// Sign computes an RSA SHA-256 signature of the input, which can be verified with the public
+// keys of the service account identified by Email. Signers that sign remotely bind the signing
+// request to ctx.
+type Signer interface {
+	Email() (string, error)
+	Sign(ctx context.Context, b []byte) ([]byte, error)
+}
+
+// NewSigner returns a Signer for the given credentials.
+//
+// If the credentials contain a service account private key, data is signed locally with that
+// key. Otherwise, if a service account ID is specified, data is signed remotely by the IAM
+// service, using the HTTP client hc. Otherwise, the signer of the runtime platform is used:
+// on App Engine data is signed with appengine.SignBytes, and elsewhere signing fails.
+func NewSigner(ctx context.Context, creds *google.DefaultCredentials, serviceAccountID string, hc *http.Client) (Signer, error) {
+	var (
+		err   error
+		email string
+		pk    *rsa.PrivateKey
+	)
+	if creds != nil && len(creds.JSON) > 0 {
+		var svcAcct struct {
+			ClientEmail string `json:"client_email"`
+			PrivateKey  string `json:"private_key"`
+		}
+		if err := json.Unmarshal(creds.JSON, &svcAcct); err != nil {
+			return nil, err
+		}
+		if svcAcct.PrivateKey != "" {
+			pk, err = ParsePrivateKey(svcAcct.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+		email = svcAcct.ClientEmail
+	}
+
+	if email != "" && pk != nil {
+		return NewServiceAccountSigner(email, pk), nil
+	}
+	if serviceAccountID != "" {
+		return &iamSigner{
+			hc:               &HTTPClient{Client: hc},
+			serviceAccountID: serviceAccountID,
+			endpoint:         iamSignBlobURL,
+		}, nil
+	}
+	return newPlatformSigner(ctx)
+}
+
+// NewServiceAccountSigner returns a Signer that signs data locally with the given service account
+// private key.
+func NewServiceAccountSigner(email string, pk *rsa.PrivateKey) Signer {
+	return serviceAcctSigner{email: email, pk: pk}
+}
+
+// ParsePrivateKey parses an RSA private key in PEM format.
+func ParsePrivateKey(key string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, fmt.Errorf("no private key data found in: %v", key)
+	}
+	k := block.Bytes
+	parsedKey, err := x509.ParsePKCS8PrivateKey(k)
+	if err != nil {
+		parsedKey, err = x509.ParsePKCS1PrivateKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("private key should be a PEM or plain PKSC1 or PKCS8; parse error: %v", err)
+		}
+	}
+	parsed, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return parsed, nil
+}
+
+type serviceAcctSigner struct {
+	email string
+	pk    *rsa.PrivateKey
+}
+
+func (s serviceAcctSigner) Email() (string, error) {
+	if s.email == "" {
+		return "", errors.New("service account email not available")
+	}
+	return s.email, nil
+}
+
+func (s serviceAcctSigner) Sign(ctx context.Context, ss []byte) ([]byte, error) {
+	if s.pk == nil {
+		return nil, errors.New("private key not available")
+	}
+	hash := sha256.New()
+	hash.Write([]byte(ss))
+	return rsa.SignPKCS1v15(rand.Reader, s.pk, crypto.SHA256, hash.Sum(nil))
+}
+
+// iamSigner signs data remotely using the signBlob API of the IAM service.
+type iamSigner struct {
+	hc               *HTTPClient
+	serviceAccountID string
+	endpoint         string // To enable testing against arbitrary endpoints.
+}
+
+func (s *iamSigner) Email() (string, error) {
+	return s.serviceAccountID, nil
+}
+
+func (s *iamSigner) Sign(ctx context.Context, ss []byte) ([]byte, error) {
+	req := &Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf(s.endpoint, url.PathEscape(s.serviceAccountID)),
+		Body: NewJSONEntity(map[string]interface{}{
+			"payload": base64.StdEncoding.EncodeToString(ss),
+		}),
+	}
+	resp, err := s.hc.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		SignedBlob string `json:"signedBlob"`
+	}
+	if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.SignedBlob)
+}
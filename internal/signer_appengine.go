@@ -14,7 +14,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package auth
+package internal
 
 import (
 	"golang.org/x/net/context"
@@ -26,7 +26,7 @@ type aeSigner struct {
 	ctx context.Context
 }
 
-func newSigner(ctx context.Context) (signer, error) {
+func newPlatformSigner(ctx context.Context) (Signer, error) {
 	return aeSigner{ctx}, nil
 }
 
@@ -34,7 +34,9 @@ func (s aeSigner) Email() (string, error) {
 	return appengine.ServiceAccount(s.ctx)
 }
 
-func (s aeSigner) Sign(ss []byte) ([]byte, error) {
+// Sign signs with the App Engine context the signer was created with, since appengine.SignBytes
+// requires one. ctx is not used.
+func (s aeSigner) Sign(ctx context.Context, ss []byte) ([]byte, error) {
 	_, sig, err := appengine.SignBytes(s.ctx, ss)
 	return sig, err
 }
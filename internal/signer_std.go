@@ -14,10 +14,10 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package auth
+package internal
 
-import "context"
+import "golang.org/x/net/context"
 
-func newSigner(ctx context.Context) (signer, error) {
+func newPlatformSigner(ctx context.Context) (Signer, error) {
 	return serviceAcctSigner{}, nil
 }
@@ -0,0 +1,156 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+)
+
+func TestNewSignerServiceAccount(t *testing.T) {
+	b, err := ioutil.ReadFile("../testdata/service_account.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snr, err := NewSigner(context.Background(), &google.DefaultCredentials{JSON: b}, "", http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var svcAcct struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	if err := json.Unmarshal(b, &svcAcct); err != nil {
+		t.Fatal(err)
+	}
+	if email, err := snr.Email(); email != svcAcct.ClientEmail || err != nil {
+		t.Errorf("Email() = (%q, %v); want = (%q, nil)", email, err, svcAcct.ClientEmail)
+	}
+
+	pk, err := ParsePrivateKey(svcAcct.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := snr.Sign(context.Background(), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256([]byte("data"))
+	if err := rsa.VerifyPKCS1v15(&pk.PublicKey, crypto.SHA256, h[:], sig); err != nil {
+		t.Errorf("Sign() = %v; want valid signature", err)
+	}
+}
+
+func TestNewSignerInvalidPrivateKey(t *testing.T) {
+	b := []byte(`{"client_email": "foo@bar", "private_key": "invalid"}`)
+	if snr, err := NewSigner(context.Background(), &google.DefaultCredentials{JSON: b}, "", http.DefaultClient); snr != nil || err == nil {
+		t.Errorf("NewSigner() = (%v, %v); want = (nil, error)", snr, err)
+	}
+}
+
+func TestDefaultServiceAcctSigner(t *testing.T) {
+	signer := &serviceAcctSigner{}
+	if email, err := signer.Email(); email != "" || err == nil {
+		t.Errorf("Email() = (%v, %v); want = ('', error)", email, err)
+	}
+	if sig, err := signer.Sign(context.Background(), []byte("")); sig != nil || err == nil {
+		t.Errorf("Sign() = (%v, %v); want = ('', error)", sig, err)
+	}
+}
+
+func TestIAMSigner(t *testing.T) {
+	var req *http.Request
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"keyId": "key1", "signedBlob": "` + base64.StdEncoding.EncodeToString([]byte("signature")) + `"}`))
+	}))
+	defer server.Close()
+
+	snr, err := NewSigner(context.Background(), nil, "test@example.com", http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snr.(*iamSigner).endpoint = server.URL + "/%s:signBlob"
+
+	if email, err := snr.Email(); email != "test@example.com" || err != nil {
+		t.Errorf("Email() = (%q, %v); want = (%q, nil)", email, err, "test@example.com")
+	}
+	sig, err := snr.Sign(context.Background(), []byte("data"))
+	if string(sig) != "signature" || err != nil {
+		t.Errorf("Sign() = (%q, %v); want = (%q, nil)", string(sig), err, "signature")
+	}
+	if req.Method != http.MethodPost {
+		t.Errorf("Method = %q; want = %q", req.Method, http.MethodPost)
+	}
+	if req.URL.Path != "/test@example.com:signBlob" {
+		t.Errorf("Path = %q; want = %q", req.URL.Path, "/test@example.com:signBlob")
+	}
+	if want := base64.StdEncoding.EncodeToString([]byte("data")); body["payload"] != want {
+		t.Errorf("payload = %v; want = %q", body["payload"], want)
+	}
+}
+
+func TestIAMSignerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"message": "permission denied"}}`))
+	}))
+	defer server.Close()
+
+	snr, err := NewSigner(context.Background(), nil, "test@example.com", http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snr.(*iamSigner).endpoint = server.URL + "/%s:signBlob"
+	if sig, err := snr.Sign(context.Background(), []byte("data")); sig != nil || err == nil {
+		t.Errorf("Sign() = (%v, %v); want = (nil, error)", sig, err)
+	}
+}
+
+func TestIAMSignerContext(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer server.Close()
+	defer close(block)
+
+	snr, err := NewSigner(context.Background(), nil, "test@example.com", http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snr.(*iamSigner).endpoint = server.URL + "/%s:signBlob"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if sig, err := snr.Sign(ctx, []byte("data")); sig != nil || err == nil {
+		t.Errorf("Sign() = (%v, %v); want = (nil, error)", sig, err)
+	}
+}
@@ -0,0 +1,585 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package projectmanagement contains functions for managing the Android, iOS and Web apps of a
+// Firebase project.
+package projectmanagement
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/transport"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+const projectManagementEndpoint = "https://firebase.googleapis.com"
+
+const maxListAppsResults = 100
+
+// Polling parameters used when waiting for long-running operations to complete.
+const (
+	initialPollInterval = 500 * time.Millisecond
+	maxPollInterval     = 8 * time.Second
+	maxPollAttempts     = 12
+)
+
+// Client is the interface for the Firebase Project Management service.
+type Client struct {
+	// To enable testing against arbitrary endpoints.
+	endpoint     string
+	client       *internal.HTTPClient
+	project      string
+	version      string
+	pollInterval time.Duration
+}
+
+// NewClient creates a new instance of the Firebase Project Management Client.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// the Project Management service through firebase.App.
+func NewClient(ctx context.Context, c *internal.ProjectManagementConfig) (*Client, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project id is required to access project management client")
+	}
+
+	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		endpoint:     projectManagementEndpoint,
+		client:       &internal.HTTPClient{Client: hc, ErrParser: parseErrorResponse},
+		project:      c.ProjectID,
+		version:      "Go/Admin/" + c.Version,
+		pollInterval: initialPollInterval,
+	}, nil
+}
+
+// AndroidAppMetadata contains the metadata of an Android app registered in a Firebase project.
+type AndroidAppMetadata struct {
+	Name        string `json:"name"`
+	AppID       string `json:"appId"`
+	DisplayName string `json:"displayName"`
+	ProjectID   string `json:"projectId"`
+	PackageName string `json:"packageName"`
+}
+
+// IOSAppMetadata contains the metadata of an iOS app registered in a Firebase project.
+type IOSAppMetadata struct {
+	Name        string `json:"name"`
+	AppID       string `json:"appId"`
+	DisplayName string `json:"displayName"`
+	ProjectID   string `json:"projectId"`
+	BundleID    string `json:"bundleId"`
+}
+
+// WebAppMetadata contains the metadata of a Web app registered in a Firebase project.
+type WebAppMetadata struct {
+	Name        string   `json:"name"`
+	AppID       string   `json:"appId"`
+	DisplayName string   `json:"displayName"`
+	ProjectID   string   `json:"projectId"`
+	AppURLs     []string `json:"appUrls"`
+}
+
+// WebAppConfig contains the configuration of a Web app, which is used to initialize the Firebase
+// JavaScript SDK.
+type WebAppConfig struct {
+	ProjectID         string `json:"projectId"`
+	AppID             string `json:"appId"`
+	APIKey            string `json:"apiKey"`
+	AuthDomain        string `json:"authDomain"`
+	DatabaseURL       string `json:"databaseURL"`
+	StorageBucket     string `json:"storageBucket"`
+	MessagingSenderID string `json:"messagingSenderId"`
+	MeasurementID     string `json:"measurementId"`
+	LocationID        string `json:"locationId"`
+}
+
+// Types of SHA certificates.
+const (
+	SHA1   = "SHA_1"
+	SHA256 = "SHA_256"
+)
+
+// SHACertificate is a SHA certificate associated with an Android app.
+//
+// Name is the fully qualified resource name of the certificate, which is assigned by the server
+// and required for deleting the certificate.
+type SHACertificate struct {
+	Name     string `json:"name,omitempty"`
+	SHAHash  string `json:"shaHash"`
+	CertType string `json:"certType"`
+}
+
+// AndroidApps returns the metadata of all the Android apps in the project.
+func (c *Client) AndroidApps(ctx context.Context) ([]*AndroidAppMetadata, error) {
+	var result []*AndroidAppMetadata
+	err := c.listApps(ctx, "androidApps", func(b []byte) (string, error) {
+		var page struct {
+			Apps          []*AndroidAppMetadata `json:"apps"`
+			NextPageToken string                `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return "", err
+		}
+		result = append(result, page.Apps...)
+		return page.NextPageToken, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// IOSApps returns the metadata of all the iOS apps in the project.
+func (c *Client) IOSApps(ctx context.Context) ([]*IOSAppMetadata, error) {
+	var result []*IOSAppMetadata
+	err := c.listApps(ctx, "iosApps", func(b []byte) (string, error) {
+		var page struct {
+			Apps          []*IOSAppMetadata `json:"apps"`
+			NextPageToken string            `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return "", err
+		}
+		result = append(result, page.Apps...)
+		return page.NextPageToken, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WebApps returns the metadata of all the Web apps in the project.
+func (c *Client) WebApps(ctx context.Context) ([]*WebAppMetadata, error) {
+	var result []*WebAppMetadata
+	err := c.listApps(ctx, "webApps", func(b []byte) (string, error) {
+		var page struct {
+			Apps          []*WebAppMetadata `json:"apps"`
+			NextPageToken string            `json:"nextPageToken"`
+		}
+		if err := json.Unmarshal(b, &page); err != nil {
+			return "", err
+		}
+		result = append(result, page.Apps...)
+		return page.NextPageToken, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CreateAndroidApp registers a new Android app with the given package name in the project.
+//
+// App creation is a long-running operation. CreateAndroidApp polls the service until the
+// operation completes, and returns the metadata of the new app.
+func (c *Client) CreateAndroidApp(ctx context.Context, packageName, displayName string) (*AndroidAppMetadata, error) {
+	if packageName == "" {
+		return nil, errors.New("package name must not be empty")
+	}
+	req := map[string]string{"packageName": packageName}
+	if displayName != "" {
+		req["displayName"] = displayName
+	}
+
+	var app AndroidAppMetadata
+	if err := c.createApp(ctx, "androidApps", req, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// CreateIOSApp registers a new iOS app with the given bundle ID in the project.
+//
+// App creation is a long-running operation. CreateIOSApp polls the service until the operation
+// completes, and returns the metadata of the new app.
+func (c *Client) CreateIOSApp(ctx context.Context, bundleID, displayName string) (*IOSAppMetadata, error) {
+	if bundleID == "" {
+		return nil, errors.New("bundle id must not be empty")
+	}
+	req := map[string]string{"bundleId": bundleID}
+	if displayName != "" {
+		req["displayName"] = displayName
+	}
+
+	var app IOSAppMetadata
+	if err := c.createApp(ctx, "iosApps", req, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// CreateWebApp registers a new Web app in the project.
+//
+// App creation is a long-running operation. CreateWebApp polls the service until the operation
+// completes, and returns the metadata of the new app.
+func (c *Client) CreateWebApp(ctx context.Context, displayName string) (*WebAppMetadata, error) {
+	req := map[string]string{}
+	if displayName != "" {
+		req["displayName"] = displayName
+	}
+
+	var app WebAppMetadata
+	if err := c.createApp(ctx, "webApps", req, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// AndroidApp returns a handle to the Android app with the given app ID.
+func (c *Client) AndroidApp(appID string) *AndroidApp {
+	return &AndroidApp{client: c, appID: appID}
+}
+
+// IOSApp returns a handle to the iOS app with the given app ID.
+func (c *Client) IOSApp(appID string) *IOSApp {
+	return &IOSApp{client: c, appID: appID}
+}
+
+// WebApp returns a handle to the Web app with the given app ID.
+func (c *Client) WebApp(appID string) *WebApp {
+	return &WebApp{client: c, appID: appID}
+}
+
+// AndroidApp is a handle to an Android app in a Firebase project.
+type AndroidApp struct {
+	client *Client
+	appID  string
+}
+
+// Metadata retrieves the metadata of the app.
+func (a *AndroidApp) Metadata(ctx context.Context) (*AndroidAppMetadata, error) {
+	var app AndroidAppMetadata
+	if err := a.client.getResource(ctx, "androidApps", a.appID, "", &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// SetDisplayName updates the display name of the app.
+func (a *AndroidApp) SetDisplayName(ctx context.Context, displayName string) error {
+	return a.client.setDisplayName(ctx, "androidApps", a.appID, displayName)
+}
+
+// GetConfig returns the contents of the google-services.json configuration file of the app.
+func (a *AndroidApp) GetConfig(ctx context.Context) ([]byte, error) {
+	return a.client.getConfig(ctx, "androidApps", a.appID)
+}
+
+// SHACertificates returns the SHA certificates associated with the app.
+func (a *AndroidApp) SHACertificates(ctx context.Context) ([]*SHACertificate, error) {
+	var result struct {
+		Certificates []*SHACertificate `json:"certificates"`
+	}
+	if err := a.client.getResource(ctx, "androidApps", a.appID, "/sha", &result); err != nil {
+		return nil, err
+	}
+	return result.Certificates, nil
+}
+
+// AddSHACertificate associates a SHA certificate with the app.
+//
+// shaHash must be a hex-encoded SHA-1 or SHA-256 certificate fingerprint, optionally with the
+// bytes separated by colons as printed by keytool. The type of the certificate is inferred from
+// the size of the fingerprint.
+func (a *AndroidApp) AddSHACertificate(ctx context.Context, shaHash string) (*SHACertificate, error) {
+	if err := validateAppID(a.appID); err != nil {
+		return nil, err
+	}
+	cert, err := newSHACertificate(shaHash)
+	if err != nil {
+		return nil, err
+	}
+
+	c := a.client
+	req := &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/v1beta1/projects/-/androidApps/%s/sha", c.endpoint, a.appID),
+		Body:   internal.NewJSONEntity(cert),
+	}
+	var result SHACertificate
+	if err := c.do(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteSHACertificate removes a SHA certificate from the app.
+//
+// The certificate must have been obtained from SHACertificates or AddSHACertificate, so that its
+// resource name is known.
+func (a *AndroidApp) DeleteSHACertificate(ctx context.Context, cert *SHACertificate) error {
+	if cert == nil || cert.Name == "" {
+		return errors.New("certificate must be non-nil and have a resource name")
+	}
+	c := a.client
+	req := &internal.Request{
+		Method: http.MethodDelete,
+		URL:    fmt.Sprintf("%s/v1beta1/%s", c.endpoint, cert.Name),
+	}
+	return c.do(ctx, req, nil)
+}
+
+func newSHACertificate(shaHash string) (*SHACertificate, error) {
+	hash := strings.Replace(shaHash, ":", "", -1)
+	b, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sha hash %q; must be a hex-encoded SHA-1 or SHA-256 fingerprint", shaHash)
+	}
+	cert := &SHACertificate{SHAHash: hash}
+	switch len(b) {
+	case 20:
+		cert.CertType = SHA1
+	case 32:
+		cert.CertType = SHA256
+	default:
+		return nil, fmt.Errorf("invalid sha hash %q; must be a hex-encoded SHA-1 or SHA-256 fingerprint", shaHash)
+	}
+	return cert, nil
+}
+
+// IOSApp is a handle to an iOS app in a Firebase project.
+type IOSApp struct {
+	client *Client
+	appID  string
+}
+
+// Metadata retrieves the metadata of the app.
+func (a *IOSApp) Metadata(ctx context.Context) (*IOSAppMetadata, error) {
+	var app IOSAppMetadata
+	if err := a.client.getResource(ctx, "iosApps", a.appID, "", &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// SetDisplayName updates the display name of the app.
+func (a *IOSApp) SetDisplayName(ctx context.Context, displayName string) error {
+	return a.client.setDisplayName(ctx, "iosApps", a.appID, displayName)
+}
+
+// GetConfig returns the contents of the GoogleService-Info.plist configuration file of the app.
+func (a *IOSApp) GetConfig(ctx context.Context) ([]byte, error) {
+	return a.client.getConfig(ctx, "iosApps", a.appID)
+}
+
+// WebApp is a handle to a Web app in a Firebase project.
+type WebApp struct {
+	client *Client
+	appID  string
+}
+
+// Metadata retrieves the metadata of the app.
+func (a *WebApp) Metadata(ctx context.Context) (*WebAppMetadata, error) {
+	var app WebAppMetadata
+	if err := a.client.getResource(ctx, "webApps", a.appID, "", &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// SetDisplayName updates the display name of the app.
+func (a *WebApp) SetDisplayName(ctx context.Context, displayName string) error {
+	return a.client.setDisplayName(ctx, "webApps", a.appID, displayName)
+}
+
+// GetConfig returns the configuration of the app. Unlike the configuration of Android and iOS
+// apps, which is served as a file, the configuration of Web apps is served as a JSON object.
+func (a *WebApp) GetConfig(ctx context.Context) (*WebAppConfig, error) {
+	var config WebAppConfig
+	if err := a.client.getResource(ctx, "webApps", a.appID, "/config", &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (c *Client) listApps(ctx context.Context, platform string, parse func([]byte) (string, error)) error {
+	var pageToken string
+	for {
+		opts := []internal.HTTPOption{
+			internal.WithQueryParam("pageSize", strconv.Itoa(maxListAppsResults)),
+		}
+		if pageToken != "" {
+			opts = append(opts, internal.WithQueryParam("pageToken", pageToken))
+		}
+		req := &internal.Request{
+			Method: http.MethodGet,
+			URL:    fmt.Sprintf("%s/v1beta1/projects/%s/%s", c.endpoint, c.project, platform),
+			Opts:   opts,
+		}
+		var page json.RawMessage
+		if err := c.do(ctx, req, &page); err != nil {
+			return err
+		}
+
+		next, err := parse(page)
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		pageToken = next
+	}
+}
+
+func (c *Client) createApp(ctx context.Context, platform string, body, v interface{}) error {
+	req := &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/v1beta1/projects/%s/%s", c.endpoint, c.project, platform),
+		Body:   internal.NewJSONEntity(body),
+	}
+	var op operation
+	if err := c.do(ctx, req, &op); err != nil {
+		return err
+	}
+	if op.Name == "" {
+		return errors.New("app creation did not return a long-running operation")
+	}
+	return c.waitForOperation(ctx, op.Name, v)
+}
+
+type operation struct {
+	Name     string          `json:"name"`
+	Done     bool            `json:"done"`
+	Response json.RawMessage `json:"response"`
+	Error    *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// waitForOperation polls the named long-running operation with exponential backoff, until it
+// completes or the maximum number of attempts is reached. The response of a successful operation
+// is unmarshaled into v.
+func (c *Client) waitForOperation(ctx context.Context, name string, v interface{}) error {
+	interval := c.pollInterval
+	for i := 0; i < maxPollAttempts; i++ {
+		req := &internal.Request{
+			Method: http.MethodGet,
+			URL:    fmt.Sprintf("%s/v1/%s", c.endpoint, name),
+		}
+		var op operation
+		if err := c.do(ctx, req, &op); err != nil {
+			return err
+		}
+		if op.Done {
+			if op.Error != nil {
+				return fmt.Errorf("operation %q failed: %s", name, op.Error.Message)
+			}
+			if r := strings.TrimSpace(string(op.Response)); r == "" || r == "null" || r == "{}" {
+				return fmt.Errorf("operation %q completed without a response", name)
+			}
+			return json.Unmarshal(op.Response, v)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		if interval *= 2; interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+	}
+	return fmt.Errorf("operation %q did not complete after %d attempts", name, maxPollAttempts)
+}
+
+func (c *Client) getResource(ctx context.Context, platform, appID, suffix string, v interface{}) error {
+	if err := validateAppID(appID); err != nil {
+		return err
+	}
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/v1beta1/projects/-/%s/%s%s", c.endpoint, platform, appID, suffix),
+	}
+	return c.do(ctx, req, v)
+}
+
+func (c *Client) setDisplayName(ctx context.Context, platform, appID, displayName string) error {
+	if err := validateAppID(appID); err != nil {
+		return err
+	}
+	if displayName == "" {
+		return errors.New("display name must not be empty")
+	}
+	req := &internal.Request{
+		Method: http.MethodPatch,
+		URL:    fmt.Sprintf("%s/v1beta1/projects/-/%s/%s", c.endpoint, platform, appID),
+		Body:   internal.NewJSONEntity(map[string]string{"displayName": displayName}),
+		Opts:   []internal.HTTPOption{internal.WithQueryParam("updateMask", "displayName")},
+	}
+	return c.do(ctx, req, nil)
+}
+
+func (c *Client) getConfig(ctx context.Context, platform, appID string) ([]byte, error) {
+	var result struct {
+		ConfigFilename     string `json:"configFilename"`
+		ConfigFileContents string `json:"configFileContents"`
+	}
+	if err := c.getResource(ctx, platform, appID, "/config", &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.ConfigFileContents)
+}
+
+func (c *Client) do(ctx context.Context, req *internal.Request, v interface{}) error {
+	req.Opts = append(req.Opts, internal.WithHeader("X-Client-Version", c.version))
+	resp, err := c.client.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return resp.CheckStatus(http.StatusOK)
+	}
+	return resp.Unmarshal(http.StatusOK, v)
+}
+
+func validateAppID(appID string) error {
+	if appID == "" {
+		return errors.New("app id must not be empty")
+	}
+	return nil
+}
+
+func parseErrorResponse(b []byte) string {
+	var p struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(b, &p); err != nil || p.Error.Message == "" {
+		return ""
+	}
+	if p.Error.Status != "" {
+		return fmt.Sprintf("%s: %s", p.Error.Status, p.Error.Message)
+	}
+	return p.Error.Message
+}
@@ -0,0 +1,528 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projectmanagement
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+var testProjectManagementConfig = &internal.ProjectManagementConfig{
+	ProjectID: "test-project",
+	Opts: []option.ClientOption{
+		option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}),
+	},
+	Version: "test-version",
+}
+
+type request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+type mockServer struct {
+	Resps  []string
+	Status int
+	Reqs   []*request
+	Srv    *httptest.Server
+	Client *Client
+}
+
+// newMockServer creates a server that responds to consecutive requests with the given response
+// bodies, repeating the last one once all others have been consumed.
+func newMockServer(t *testing.T, resps ...string) *mockServer {
+	s := &mockServer{Resps: resps}
+	s.Srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Reqs = append(s.Reqs, &request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Body:   string(b),
+		})
+		if h := r.Header.Get("Authorization"); h != "Bearer test-token" {
+			t.Errorf("Authorization = %q; want = %q", h, "Bearer test-token")
+		}
+		if h := r.Header.Get("X-Client-Version"); h != "Go/Admin/test-version" {
+			t.Errorf("X-Client-Version = %q; want = %q", h, "Go/Admin/test-version")
+		}
+
+		resp := s.Resps[len(s.Resps)-1]
+		if len(s.Reqs) <= len(s.Resps) {
+			resp = s.Resps[len(s.Reqs)-1]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if s.Status != 0 {
+			w.WriteHeader(s.Status)
+		}
+		w.Write([]byte(resp))
+	}))
+
+	client, err := NewClient(context.Background(), testProjectManagementConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = s.Srv.URL
+	client.pollInterval = time.Millisecond
+	s.Client = client
+	return s
+}
+
+func (s *mockServer) Close() {
+	s.Srv.Close()
+}
+
+func (s *mockServer) checkRequests(t *testing.T, want []*request) {
+	if len(s.Reqs) != len(want) {
+		t.Fatalf("Requests = %d; want = %d", len(s.Reqs), len(want))
+	}
+	for i, r := range want {
+		if !reflect.DeepEqual(s.Reqs[i], r) {
+			t.Errorf("Request[%d] = %#v; want = %#v", i, s.Reqs[i], r)
+		}
+	}
+}
+
+func TestNoProjectID(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.ProjectManagementConfig{})
+	if client != nil || err == nil {
+		t.Errorf("NewClient() = (%v, %v); want = (nil, error)", client, err)
+	}
+}
+
+func TestAndroidApps(t *testing.T) {
+	s := newMockServer(t,
+		`{"apps": [{"appId": "app1", "packageName": "com.example.one"}], "nextPageToken": "token"}`,
+		`{"apps": [{"appId": "app2", "packageName": "com.example.two", "displayName": "Two"}]}`)
+	defer s.Close()
+
+	apps, err := s.Client.AndroidApps(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*AndroidAppMetadata{
+		{AppID: "app1", PackageName: "com.example.one"},
+		{AppID: "app2", PackageName: "com.example.two", DisplayName: "Two"},
+	}
+	if !reflect.DeepEqual(apps, want) {
+		t.Errorf("AndroidApps() = %v; want = %v", apps, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1beta1/projects/test-project/androidApps", "pageSize=100", ""},
+		{http.MethodGet, "/v1beta1/projects/test-project/androidApps", "pageSize=100&pageToken=token", ""},
+	})
+}
+
+func TestIOSApps(t *testing.T) {
+	s := newMockServer(t, `{"apps": [{"appId": "app1", "bundleId": "com.example.ios"}]}`)
+	defer s.Close()
+
+	apps, err := s.Client.IOSApps(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*IOSAppMetadata{{AppID: "app1", BundleID: "com.example.ios"}}
+	if !reflect.DeepEqual(apps, want) {
+		t.Errorf("IOSApps() = %v; want = %v", apps, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1beta1/projects/test-project/iosApps", "pageSize=100", ""},
+	})
+}
+
+func TestWebApps(t *testing.T) {
+	s := newMockServer(t, `{"apps": [{"appId": "app1", "displayName": "Web", "appUrls": ["https://example.com"]}]}`)
+	defer s.Close()
+
+	apps, err := s.Client.WebApps(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*WebAppMetadata{{AppID: "app1", DisplayName: "Web", AppURLs: []string{"https://example.com"}}}
+	if !reflect.DeepEqual(apps, want) {
+		t.Errorf("WebApps() = %v; want = %v", apps, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1beta1/projects/test-project/webApps", "pageSize=100", ""},
+	})
+}
+
+func TestCreateAndroidApp(t *testing.T) {
+	s := newMockServer(t,
+		`{"name": "operations/op1"}`,
+		`{"name": "operations/op1", "done": false}`,
+		`{"name": "operations/op1", "done": true, "response": {
+			"appId": "new-app", "packageName": "com.example", "displayName": "Example"}}`)
+	defer s.Close()
+
+	app, err := s.Client.CreateAndroidApp(context.Background(), "com.example", "Example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &AndroidAppMetadata{AppID: "new-app", PackageName: "com.example", DisplayName: "Example"}
+	if !reflect.DeepEqual(app, want) {
+		t.Errorf("CreateAndroidApp() = %v; want = %v", app, want)
+	}
+	s.checkRequests(t, []*request{
+		{
+			http.MethodPost,
+			"/v1beta1/projects/test-project/androidApps",
+			"",
+			`{"displayName":"Example","packageName":"com.example"}`,
+		},
+		{http.MethodGet, "/v1/operations/op1", "", ""},
+		{http.MethodGet, "/v1/operations/op1", "", ""},
+	})
+}
+
+func TestCreateIOSApp(t *testing.T) {
+	s := newMockServer(t,
+		`{"name": "operations/op1"}`,
+		`{"name": "operations/op1", "done": true, "response": {"appId": "new-app", "bundleId": "com.example"}}`)
+	defer s.Close()
+
+	app, err := s.Client.CreateIOSApp(context.Background(), "com.example", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &IOSAppMetadata{AppID: "new-app", BundleID: "com.example"}
+	if !reflect.DeepEqual(app, want) {
+		t.Errorf("CreateIOSApp() = %v; want = %v", app, want)
+	}
+	if s.Reqs[0].Body != `{"bundleId":"com.example"}` {
+		t.Errorf("CreateIOSApp() request = %s; want = %s", s.Reqs[0].Body, `{"bundleId":"com.example"}`)
+	}
+}
+
+func TestCreateWebApp(t *testing.T) {
+	s := newMockServer(t,
+		`{"name": "operations/op1"}`,
+		`{"name": "operations/op1", "done": true, "response": {"appId": "new-app", "displayName": "Web"}}`)
+	defer s.Close()
+
+	app, err := s.Client.CreateWebApp(context.Background(), "Web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &WebAppMetadata{AppID: "new-app", DisplayName: "Web"}
+	if !reflect.DeepEqual(app, want) {
+		t.Errorf("CreateWebApp() = %v; want = %v", app, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodPost, "/v1beta1/projects/test-project/webApps", "", `{"displayName":"Web"}`},
+		{http.MethodGet, "/v1/operations/op1", "", ""},
+	})
+}
+
+func TestCreateAppOperationError(t *testing.T) {
+	s := newMockServer(t,
+		`{"name": "operations/op1"}`,
+		`{"name": "operations/op1", "done": true, "error": {"code": 6, "message": "already exists"}}`)
+	defer s.Close()
+
+	app, err := s.Client.CreateAndroidApp(context.Background(), "com.example", "")
+	if app != nil || err == nil {
+		t.Fatalf("CreateAndroidApp() = (%v, %v); want = (nil, error)", app, err)
+	}
+	want := `operation "operations/op1" failed: already exists`
+	if err.Error() != want {
+		t.Errorf("CreateAndroidApp() = %v; want = %v", err, want)
+	}
+}
+
+func TestCreateAppOperationNoResponse(t *testing.T) {
+	for _, resp := range []string{``, `, "response": null`, `, "response": {}`} {
+		s := newMockServer(t,
+			`{"name": "operations/op1"}`,
+			`{"name": "operations/op1", "done": true`+resp+`}`)
+
+		app, err := s.Client.CreateAndroidApp(context.Background(), "com.example", "")
+		s.Close()
+		if app != nil || err == nil {
+			t.Errorf("CreateAndroidApp(%q) = (%v, %v); want = (nil, error)", resp, app, err)
+			continue
+		}
+		want := `operation "operations/op1" completed without a response`
+		if err.Error() != want {
+			t.Errorf("CreateAndroidApp(%q) = %v; want = %v", resp, err, want)
+		}
+	}
+}
+
+func TestCreateAppOperationTimeout(t *testing.T) {
+	s := newMockServer(t, `{"name": "operations/op1"}`, `{"name": "operations/op1", "done": false}`)
+	defer s.Close()
+
+	app, err := s.Client.CreateAndroidApp(context.Background(), "com.example", "")
+	if app != nil || err == nil {
+		t.Fatalf("CreateAndroidApp() = (%v, %v); want = (nil, error)", app, err)
+	}
+	if len(s.Reqs) != maxPollAttempts+1 {
+		t.Errorf("Requests = %d; want = %d", len(s.Reqs), maxPollAttempts+1)
+	}
+}
+
+func TestSetDisplayName(t *testing.T) {
+	s := newMockServer(t, `{}`)
+	defer s.Close()
+
+	ctx := context.Background()
+	if err := s.Client.AndroidApp("app1").SetDisplayName(ctx, "New Name"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Client.IOSApp("app2").SetDisplayName(ctx, "New Name"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Client.WebApp("app3").SetDisplayName(ctx, "New Name"); err != nil {
+		t.Fatal(err)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodPatch, "/v1beta1/projects/-/androidApps/app1", "updateMask=displayName", `{"displayName":"New Name"}`},
+		{http.MethodPatch, "/v1beta1/projects/-/iosApps/app2", "updateMask=displayName", `{"displayName":"New Name"}`},
+		{http.MethodPatch, "/v1beta1/projects/-/webApps/app3", "updateMask=displayName", `{"displayName":"New Name"}`},
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	s := newMockServer(t, `{"appId": "app1", "packageName": "com.example", "projectId": "test-project"}`)
+	defer s.Close()
+
+	app, err := s.Client.AndroidApp("app1").Metadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &AndroidAppMetadata{AppID: "app1", PackageName: "com.example", ProjectID: "test-project"}
+	if !reflect.DeepEqual(app, want) {
+		t.Errorf("Metadata() = %v; want = %v", app, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1beta1/projects/-/androidApps/app1", "", ""},
+	})
+}
+
+func TestGetConfig(t *testing.T) {
+	config := `{"project_info": {"project_id": "test-project"}}`
+	resp := `{"configFilename": "google-services.json", "configFileContents": "` +
+		base64.StdEncoding.EncodeToString([]byte(config)) + `"}`
+	s := newMockServer(t, resp)
+	defer s.Close()
+
+	ctx := context.Background()
+	b, err := s.Client.AndroidApp("app1").GetConfig(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != config {
+		t.Errorf("GetConfig() = %q; want = %q", string(b), config)
+	}
+	if _, err := s.Client.IOSApp("app2").GetConfig(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1beta1/projects/-/androidApps/app1/config", "", ""},
+		{http.MethodGet, "/v1beta1/projects/-/iosApps/app2/config", "", ""},
+	})
+}
+
+func TestWebAppMetadata(t *testing.T) {
+	s := newMockServer(t, `{"appId": "app1", "displayName": "Web", "projectId": "test-project"}`)
+	defer s.Close()
+
+	app, err := s.Client.WebApp("app1").Metadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &WebAppMetadata{AppID: "app1", DisplayName: "Web", ProjectID: "test-project"}
+	if !reflect.DeepEqual(app, want) {
+		t.Errorf("Metadata() = %v; want = %v", app, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1beta1/projects/-/webApps/app1", "", ""},
+	})
+}
+
+func TestWebAppConfig(t *testing.T) {
+	s := newMockServer(t, `{
+		"projectId": "test-project",
+		"appId": "app1",
+		"apiKey": "api-key",
+		"authDomain": "test-project.firebaseapp.com",
+		"storageBucket": "test-project.appspot.com",
+		"messagingSenderId": "1234"
+	}`)
+	defer s.Close()
+
+	config, err := s.Client.WebApp("app1").GetConfig(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &WebAppConfig{
+		ProjectID:         "test-project",
+		AppID:             "app1",
+		APIKey:            "api-key",
+		AuthDomain:        "test-project.firebaseapp.com",
+		StorageBucket:     "test-project.appspot.com",
+		MessagingSenderID: "1234",
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("GetConfig() = %v; want = %v", config, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1beta1/projects/-/webApps/app1/config", "", ""},
+	})
+}
+
+func TestSHACertificates(t *testing.T) {
+	s := newMockServer(t, `{"certificates": [
+		{"name": "projects/p/androidApps/app1/sha/cert1", "shaHash": "abc", "certType": "SHA_1"}
+	]}`)
+	defer s.Close()
+
+	certs, err := s.Client.AndroidApp("app1").SHACertificates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*SHACertificate{
+		{Name: "projects/p/androidApps/app1/sha/cert1", SHAHash: "abc", CertType: SHA1},
+	}
+	if !reflect.DeepEqual(certs, want) {
+		t.Errorf("SHACertificates() = %v; want = %v", certs, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1beta1/projects/-/androidApps/app1/sha", "", ""},
+	})
+}
+
+func TestAddSHACertificate(t *testing.T) {
+	s := newMockServer(t, `{"name": "projects/p/androidApps/app1/sha/cert1", "shaHash": "hash", "certType": "SHA_256"}`)
+	defer s.Close()
+
+	ctx := context.Background()
+	sha1 := strings.Repeat("a", 40)
+	sha256 := strings.Repeat("b", 64)
+	app := s.Client.AndroidApp("app1")
+	if _, err := app.AddSHACertificate(ctx, sha1); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := app.AddSHACertificate(ctx, sha256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Name != "projects/p/androidApps/app1/sha/cert1" {
+		t.Errorf("Name = %q; want = %q", cert.Name, "projects/p/androidApps/app1/sha/cert1")
+	}
+	// Fingerprints printed by keytool separate the bytes with colons.
+	if _, err := app.AddSHACertificate(ctx, strings.Repeat("AB:", 19)+"AB"); err != nil {
+		t.Fatal(err)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodPost, "/v1beta1/projects/-/androidApps/app1/sha", "", `{"shaHash":"` + sha1 + `","certType":"SHA_1"}`},
+		{http.MethodPost, "/v1beta1/projects/-/androidApps/app1/sha", "", `{"shaHash":"` + sha256 + `","certType":"SHA_256"}`},
+		{
+			http.MethodPost,
+			"/v1beta1/projects/-/androidApps/app1/sha",
+			"",
+			`{"shaHash":"` + strings.Repeat("AB", 20) + `","certType":"SHA_1"}`,
+		},
+	})
+}
+
+func TestDeleteSHACertificate(t *testing.T) {
+	s := newMockServer(t, `{}`)
+	defer s.Close()
+
+	cert := &SHACertificate{Name: "projects/p/androidApps/app1/sha/cert1"}
+	if err := s.Client.AndroidApp("app1").DeleteSHACertificate(context.Background(), cert); err != nil {
+		t.Fatal(err)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodDelete, "/v1beta1/projects/p/androidApps/app1/sha/cert1", "", ""},
+	})
+}
+
+func TestInvalidArguments(t *testing.T) {
+	client, err := NewClient(context.Background(), testProjectManagementConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := client.CreateAndroidApp(ctx, "", ""); err == nil {
+		t.Errorf("CreateAndroidApp('') = nil; want error")
+	}
+	if _, err := client.CreateIOSApp(ctx, "", ""); err == nil {
+		t.Errorf("CreateIOSApp('') = nil; want error")
+	}
+	if _, err := client.AndroidApp("").Metadata(ctx); err == nil {
+		t.Errorf("Metadata('') = nil; want error")
+	}
+	if err := client.AndroidApp("app1").SetDisplayName(ctx, ""); err == nil {
+		t.Errorf("SetDisplayName('') = nil; want error")
+	}
+	if _, err := client.IOSApp("").GetConfig(ctx); err == nil {
+		t.Errorf("GetConfig('') = nil; want error")
+	}
+	if _, err := client.WebApp("").GetConfig(ctx); err == nil {
+		t.Errorf("WebApp('').GetConfig() = nil; want error")
+	}
+	invalidHashes := []string{
+		"abc",
+		strings.Repeat("z", 40),
+		strings.Repeat("a", 39),
+		strings.Repeat("a", 48),
+		strings.Repeat("g", 64),
+	}
+	for _, h := range invalidHashes {
+		if _, err := client.AndroidApp("app1").AddSHACertificate(ctx, h); err == nil {
+			t.Errorf("AddSHACertificate(%q) = nil; want error", h)
+		}
+	}
+	if err := client.AndroidApp("app1").DeleteSHACertificate(ctx, &SHACertificate{}); err == nil {
+		t.Errorf("DeleteSHACertificate(no name) = nil; want error")
+	}
+}
+
+func TestProjectManagementError(t *testing.T) {
+	s := newMockServer(t, `{"error": {"status": "NOT_FOUND", "message": "app not found"}}`)
+	defer s.Close()
+	s.Status = http.StatusNotFound
+
+	app, err := s.Client.AndroidApp("app1").Metadata(context.Background())
+	if app != nil || err == nil {
+		t.Fatalf("Metadata() = (%v, %v); want = (nil, error)", app, err)
+	}
+	want := "http error status: 404; reason: NOT_FOUND: app not found"
+	if err.Error() != want {
+		t.Errorf("Metadata() = %v; want = %v", err, want)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxConditionDepth is the maximum nesting depth of condition trees supported by the service.
+const maxConditionDepth = 10
+
+// totalMicroPercentiles is the number of buckets that percent conditions distribute contexts into.
+const totalMicroPercentiles = 100 * 1000 * 1000
+
+// maxSemanticVersionSegments is the maximum number of segments in a semantic version string.
+const maxSemanticVersionSegments = 5
+
+// evaluateConditions evaluates each of the named conditions against the given context, and
+// returns the results keyed by condition name.
+func evaluateConditions(conditions []*NamedCondition, ec *EvaluationContext) map[string]bool {
+	results := make(map[string]bool)
+	for _, c := range conditions {
+		results[c.Name] = evaluateCondition(c.Condition, ec, 0)
+	}
+	return results
+}
+
+func evaluateCondition(c *OneOfCondition, ec *EvaluationContext, depth int) bool {
+	if c == nil || depth > maxConditionDepth {
+		return false
+	}
+	switch {
+	case c.OrCondition != nil:
+		for _, sub := range c.OrCondition.Conditions {
+			if evaluateCondition(sub, ec, depth+1) {
+				return true
+			}
+		}
+		return false
+	case c.AndCondition != nil:
+		for _, sub := range c.AndCondition.Conditions {
+			if !evaluateCondition(sub, ec, depth+1) {
+				return false
+			}
+		}
+		return true
+	case c.Percent != nil:
+		return evaluatePercentCondition(c.Percent, ec)
+	case c.CustomSignal != nil:
+		return evaluateCustomSignalCondition(c.CustomSignal, ec)
+	case c.True != nil:
+		return true
+	}
+	return false
+}
+
+func evaluatePercentCondition(c *PercentCondition, ec *EvaluationContext) bool {
+	if ec.RandomizationID == "" {
+		return false
+	}
+
+	p := microPercentile(c.Seed, ec.RandomizationID)
+	switch c.PercentOperator {
+	case PercentLessOrEqual:
+		return p <= c.MicroPercent
+	case PercentGreaterThan:
+		return p > c.MicroPercent
+	case PercentBetween:
+		if c.MicroPercentRange == nil {
+			return false
+		}
+		return p > c.MicroPercentRange.MicroPercentLowerBound &&
+			p <= c.MicroPercentRange.MicroPercentUpperBound
+	}
+	return false
+}
+
+// microPercentile computes the percentile of a randomization ID in the same way as the Remote
+// Config backend: the SHA-256 hash of "<seed>.<id>" (or just "<id>" when there is no seed) is
+// interpreted as a big-endian integer, and reduced modulo the number of micro-percentiles.
+func microPercentile(seed, randomizationID string) int64 {
+	s := randomizationID
+	if seed != "" {
+		s = seed + "." + randomizationID
+	}
+	sum := sha256.Sum256([]byte(s))
+	h := new(big.Int)
+	h.SetString(hex.EncodeToString(sum[:]), 16)
+	return h.Mod(h, big.NewInt(totalMicroPercentiles)).Int64()
+}
+
+func evaluateCustomSignalCondition(c *CustomSignalCondition, ec *EvaluationContext) bool {
+	if c.CustomSignalKey == "" || len(c.TargetCustomSignalValues) == 0 {
+		return false
+	}
+	signal, ok := ec.CustomSignals[c.CustomSignalKey]
+	if !ok || signal == nil {
+		return false
+	}
+	actual := fmt.Sprint(signal)
+	targets := c.TargetCustomSignalValues
+
+	switch c.CustomSignalOperator {
+	case StringContains:
+		return anyTarget(targets, func(t string) bool { return strings.Contains(actual, t) })
+	case StringDoesNotContain:
+		return !anyTarget(targets, func(t string) bool { return strings.Contains(actual, t) })
+	case StringExactlyMatches:
+		return anyTarget(targets, func(t string) bool {
+			return strings.TrimSpace(actual) == strings.TrimSpace(t)
+		})
+	case StringContainsRegex:
+		return anyTarget(targets, func(t string) bool {
+			re, err := regexp.Compile(t)
+			return err == nil && re.MatchString(actual)
+		})
+
+	case NumericLessThan:
+		return compareNumbers(actual, targets[0], func(r int) bool { return r < 0 })
+	case NumericLessEqual:
+		return compareNumbers(actual, targets[0], func(r int) bool { return r <= 0 })
+	case NumericEqual:
+		return compareNumbers(actual, targets[0], func(r int) bool { return r == 0 })
+	case NumericNotEqual:
+		return compareNumbers(actual, targets[0], func(r int) bool { return r != 0 })
+	case NumericGreaterThan:
+		return compareNumbers(actual, targets[0], func(r int) bool { return r > 0 })
+	case NumericGreaterEqual:
+		return compareNumbers(actual, targets[0], func(r int) bool { return r >= 0 })
+
+	case SemanticVersionLessThan:
+		return compareSemanticVersions(actual, targets[0], func(r int) bool { return r < 0 })
+	case SemanticVersionLessEqual:
+		return compareSemanticVersions(actual, targets[0], func(r int) bool { return r <= 0 })
+	case SemanticVersionEqual:
+		return compareSemanticVersions(actual, targets[0], func(r int) bool { return r == 0 })
+	case SemanticVersionNotEqual:
+		return compareSemanticVersions(actual, targets[0], func(r int) bool { return r != 0 })
+	case SemanticVersionGreaterThan:
+		return compareSemanticVersions(actual, targets[0], func(r int) bool { return r > 0 })
+	case SemanticVersionGreaterEqual:
+		return compareSemanticVersions(actual, targets[0], func(r int) bool { return r >= 0 })
+	}
+	return false
+}
+
+func anyTarget(targets []string, match func(string) bool) bool {
+	for _, t := range targets {
+		if match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareNumbers parses both arguments as numbers, and reports whether the result of comparing
+// them satisfies the given predicate. Returns false if either argument is not numeric.
+func compareNumbers(actual, target string, pred func(int) bool) bool {
+	a, err := strconv.ParseFloat(strings.TrimSpace(actual), 64)
+	if err != nil {
+		return false
+	}
+	t, err := strconv.ParseFloat(strings.TrimSpace(target), 64)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case a < t:
+		return pred(-1)
+	case a > t:
+		return pred(1)
+	}
+	return pred(0)
+}
+
+// compareSemanticVersions parses both arguments as dot-separated version strings, and reports
+// whether the result of comparing them satisfies the given predicate. Versions with fewer
+// segments are padded with zeros. Returns false if either argument is not a valid version.
+func compareSemanticVersions(actual, target string, pred func(int) bool) bool {
+	a, err := parseSemanticVersion(actual)
+	if err != nil {
+		return false
+	}
+	t, err := parseSemanticVersion(target)
+	if err != nil {
+		return false
+	}
+
+	for i := 0; i < maxSemanticVersionSegments; i++ {
+		if a[i] < t[i] {
+			return pred(-1)
+		} else if a[i] > t[i] {
+			return pred(1)
+		}
+	}
+	return pred(0)
+}
+
+func parseSemanticVersion(v string) ([]int64, error) {
+	segments := strings.Split(strings.TrimSpace(v), ".")
+	if len(segments) > maxSemanticVersionSegments {
+		return nil, fmt.Errorf("version %q has more than %d segments", v, maxSemanticVersionSegments)
+	}
+
+	result := make([]int64, maxSemanticVersionSegments)
+	for i, s := range segments {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid segment in version %q: %q", v, s)
+		}
+		result[i] = n
+	}
+	return result, nil
+}
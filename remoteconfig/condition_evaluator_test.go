@@ -0,0 +1,195 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteconfig
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestMicroPercentile(t *testing.T) {
+	cases := []struct {
+		seed string
+		id   string
+		want int64
+	}{
+		{"", "user-1", 24996379},
+		{"seed", "user-1", 44552431},
+		{"abc", "def", 57694486},
+	}
+	for _, tc := range cases {
+		if got := microPercentile(tc.seed, tc.id); got != tc.want {
+			t.Errorf("microPercentile(%q, %q) = %d; want = %d", tc.seed, tc.id, got, tc.want)
+		}
+	}
+}
+
+func TestPercentCondition(t *testing.T) {
+	cases := []struct {
+		name string
+		cond *PercentCondition
+		want bool
+	}{
+		{"LessOrEqual", &PercentCondition{PercentOperator: PercentLessOrEqual, MicroPercent: 44552431}, true},
+		{"LessOrEqualBelow", &PercentCondition{PercentOperator: PercentLessOrEqual, MicroPercent: 44552430}, false},
+		{"GreaterThan", &PercentCondition{PercentOperator: PercentGreaterThan, MicroPercent: 44552430}, true},
+		{"GreaterThanEqual", &PercentCondition{PercentOperator: PercentGreaterThan, MicroPercent: 44552431}, false},
+		{"Between", &PercentCondition{
+			PercentOperator:   PercentBetween,
+			MicroPercentRange: &MicroPercentRange{44552430, 44552431},
+		}, true},
+		{"BetweenLowerBound", &PercentCondition{
+			PercentOperator:   PercentBetween,
+			MicroPercentRange: &MicroPercentRange{44552431, 50000000},
+		}, false},
+		{"BetweenNoRange", &PercentCondition{PercentOperator: PercentBetween}, false},
+		{"UnknownOperator", &PercentCondition{PercentOperator: "UNKNOWN", MicroPercent: 100000000}, false},
+	}
+	ec := &EvaluationContext{RandomizationID: "user-1"}
+	for _, tc := range cases {
+		tc.cond.Seed = "seed"
+		if got := evaluatePercentCondition(tc.cond, ec); got != tc.want {
+			t.Errorf("evaluatePercentCondition(%s) = %v; want = %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestPercentConditionWithoutRandomizationID(t *testing.T) {
+	cond := &PercentCondition{PercentOperator: PercentLessOrEqual, MicroPercent: totalMicroPercentiles}
+	if evaluatePercentCondition(cond, &EvaluationContext{}) {
+		t.Errorf("evaluatePercentCondition() = true; want = false")
+	}
+}
+
+func TestPercentConditionDistribution(t *testing.T) {
+	cond := &PercentCondition{
+		PercentOperator: PercentLessOrEqual,
+		MicroPercent:    totalMicroPercentiles / 4,
+		Seed:            "distribution",
+	}
+	const total = 20000
+	count := 0
+	for i := 0; i < total; i++ {
+		ec := &EvaluationContext{RandomizationID: fmt.Sprintf("user-%d", i)}
+		if evaluatePercentCondition(cond, ec) {
+			count++
+		}
+	}
+	if got := float64(count) / total; math.Abs(got-0.25) > 0.02 {
+		t.Errorf("evaluatePercentCondition() matched %.3f of contexts; want ~0.25", got)
+	}
+}
+
+func TestCustomSignalCondition(t *testing.T) {
+	signals := map[string]interface{}{
+		"country": "Canada",
+		"count":   42,
+		"version": "1.2.3",
+	}
+	cases := []struct {
+		op      string
+		key     string
+		targets []string
+		want    bool
+	}{
+		{StringContains, "country", []string{"US", "ana"}, true},
+		{StringContains, "country", []string{"US", "UK"}, false},
+		{StringDoesNotContain, "country", []string{"US", "UK"}, true},
+		{StringDoesNotContain, "country", []string{"US", "Can"}, false},
+		{StringExactlyMatches, "country", []string{" Canada "}, true},
+		{StringExactlyMatches, "country", []string{"Can"}, false},
+		{StringContainsRegex, "country", []string{"^C.n"}, true},
+		{StringContainsRegex, "country", []string{"[invalid"}, false},
+
+		{NumericLessThan, "count", []string{"42.5"}, true},
+		{NumericLessThan, "count", []string{"42"}, false},
+		{NumericLessEqual, "count", []string{"42"}, true},
+		{NumericEqual, "count", []string{"42.0"}, true},
+		{NumericNotEqual, "count", []string{"42"}, false},
+		{NumericGreaterThan, "count", []string{"-1"}, true},
+		{NumericGreaterEqual, "count", []string{"43"}, false},
+		{NumericEqual, "country", []string{"42"}, false},
+		{NumericEqual, "count", []string{"not a number"}, false},
+
+		{SemanticVersionLessThan, "version", []string{"1.10"}, true},
+		{SemanticVersionLessEqual, "version", []string{"1.2.3.0"}, true},
+		{SemanticVersionEqual, "version", []string{"1.2.3"}, true},
+		{SemanticVersionEqual, "version", []string{"1.2"}, false},
+		{SemanticVersionNotEqual, "version", []string{"1.2"}, true},
+		{SemanticVersionGreaterThan, "version", []string{"1.2"}, true},
+		{SemanticVersionGreaterEqual, "version", []string{"2"}, false},
+		{SemanticVersionEqual, "version", []string{"1.2.3.4.5.6"}, false},
+		{SemanticVersionEqual, "version", []string{"1.x"}, false},
+		{SemanticVersionEqual, "country", []string{"1.2.3"}, false},
+
+		{StringContains, "missing", []string{""}, false},
+		{StringContains, "country", nil, false},
+		{"UNKNOWN", "country", []string{"Canada"}, false},
+	}
+	ec := &EvaluationContext{CustomSignals: signals}
+	for _, tc := range cases {
+		cond := &CustomSignalCondition{
+			CustomSignalOperator:     tc.op,
+			CustomSignalKey:          tc.key,
+			TargetCustomSignalValues: tc.targets,
+		}
+		if got := evaluateCustomSignalCondition(cond, ec); got != tc.want {
+			t.Errorf("evaluateCustomSignalCondition(%s, %q, %v) = %v; want = %v", tc.op, tc.key, tc.targets, got, tc.want)
+		}
+	}
+}
+
+func TestBooleanConditions(t *testing.T) {
+	tr := &OneOfCondition{True: &struct{}{}}
+	fa := &OneOfCondition{False: &struct{}{}}
+	cases := []struct {
+		name string
+		cond *OneOfCondition
+		want bool
+	}{
+		{"True", tr, true},
+		{"False", fa, false},
+		{"Empty", &OneOfCondition{}, false},
+		{"Nil", nil, false},
+		{"OrTrue", &OneOfCondition{OrCondition: &OrCondition{[]*OneOfCondition{fa, tr}}}, true},
+		{"OrFalse", &OneOfCondition{OrCondition: &OrCondition{[]*OneOfCondition{fa, fa}}}, false},
+		{"OrEmpty", &OneOfCondition{OrCondition: &OrCondition{}}, false},
+		{"AndTrue", &OneOfCondition{AndCondition: &AndCondition{[]*OneOfCondition{tr, tr}}}, true},
+		{"AndFalse", &OneOfCondition{AndCondition: &AndCondition{[]*OneOfCondition{tr, fa}}}, false},
+		{"AndEmpty", &OneOfCondition{AndCondition: &AndCondition{}}, true},
+	}
+	for _, tc := range cases {
+		if got := evaluateCondition(tc.cond, &EvaluationContext{}, 0); got != tc.want {
+			t.Errorf("evaluateCondition(%s) = %v; want = %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestConditionMaxDepth(t *testing.T) {
+	nest := func(depth int) *OneOfCondition {
+		c := &OneOfCondition{True: &struct{}{}}
+		for i := 0; i < depth; i++ {
+			c = &OneOfCondition{OrCondition: &OrCondition{[]*OneOfCondition{c}}}
+		}
+		return c
+	}
+	if !evaluateCondition(nest(maxConditionDepth), &EvaluationContext{}, 0) {
+		t.Errorf("evaluateCondition(depth = %d) = false; want = true", maxConditionDepth)
+	}
+	if evaluateCondition(nest(maxConditionDepth+1), &EvaluationContext{}, 0) {
+		t.Errorf("evaluateCondition(depth = %d) = true; want = false", maxConditionDepth+1)
+	}
+}
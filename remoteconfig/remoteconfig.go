@@ -0,0 +1,290 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remoteconfig contains functions for managing the Remote Config templates of Firebase
+// projects, and for evaluating server templates locally.
+package remoteconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/transport"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+const remoteConfigEndpoint = "https://firebaseremoteconfig.googleapis.com/v1"
+
+const maxListVersionsResults = 300
+
+// Client is the interface for the Firebase Remote Config service.
+type Client struct {
+	// To enable testing against arbitrary endpoints.
+	endpoint string
+	client   *internal.HTTPClient
+	project  string
+	version  string
+}
+
+// NewClient creates a new instance of the Firebase Remote Config Client.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// the Remote Config service through firebase.App.
+func NewClient(ctx context.Context, c *internal.RemoteConfigConfig) (*Client, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project id is required to access remote config client")
+	}
+
+	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		endpoint: remoteConfigEndpoint,
+		client:   &internal.HTTPClient{Client: hc, ErrParser: parseErrorResponse},
+		project:  c.ProjectID,
+		version:  "Go/Admin/" + c.Version,
+	}, nil
+}
+
+// GetTemplate retrieves the currently active Remote Config template.
+func (c *Client) GetTemplate(ctx context.Context) (*Template, error) {
+	return c.getTemplate(ctx, nil)
+}
+
+// GetTemplateAtVersion retrieves the Remote Config template with the given version number.
+func (c *Client) GetTemplateAtVersion(ctx context.Context, versionNumber int64) (*Template, error) {
+	if versionNumber <= 0 {
+		return nil, errors.New("version number must be a positive integer")
+	}
+	opt := internal.WithQueryParam("versionNumber", strconv.FormatInt(versionNumber, 10))
+	return c.getTemplate(ctx, []internal.HTTPOption{opt})
+}
+
+// ValidateTemplate validates the given template without publishing it.
+//
+// The template must have been obtained from the Remote Config service, so that it carries a
+// valid ETag. ValidateTemplate returns the validated template, with the same ETag as the input.
+func (c *Client) ValidateTemplate(ctx context.Context, t *Template) (*Template, error) {
+	if t == nil || t.ETag == "" {
+		return nil, errors.New("template must be non-nil and have an etag")
+	}
+	result, err := c.putTemplate(ctx, t, t.ETag, true)
+	if err != nil {
+		return nil, err
+	}
+	// The server returns a placeholder etag for validated templates.
+	result.ETag = t.ETag
+	return result, nil
+}
+
+// PublishTemplate publishes the given template, making it the active template of the project.
+//
+// The ETag of the template is sent along with the request, and publishing fails if the template
+// has been modified on the server since it was read. Use ForcePublishTemplate to publish the
+// template regardless of concurrent modifications.
+func (c *Client) PublishTemplate(ctx context.Context, t *Template) (*Template, error) {
+	if t == nil || t.ETag == "" {
+		return nil, errors.New("template must be non-nil and have an etag")
+	}
+	return c.putTemplate(ctx, t, t.ETag, false)
+}
+
+// ForcePublishTemplate publishes the given template, overwriting the active template of the
+// project even if it has been modified since the given template was read.
+func (c *Client) ForcePublishTemplate(ctx context.Context, t *Template) (*Template, error) {
+	if t == nil {
+		return nil, errors.New("template must not be nil")
+	}
+	return c.putTemplate(ctx, t, "*", false)
+}
+
+// Rollback makes the template with the given version number the active template of the
+// project.
+//
+// Rolling back creates a new version of the template, which is a copy of the specified version.
+// Rollback returns the newly published template.
+func (c *Client) Rollback(ctx context.Context, versionNumber int64) (*Template, error) {
+	if versionNumber <= 0 {
+		return nil, errors.New("version number must be a positive integer")
+	}
+	req := &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/projects/%s/remoteConfig:rollback", c.endpoint, c.project),
+		Body: internal.NewJSONEntity(map[string]string{
+			"versionNumber": strconv.FormatInt(versionNumber, 10),
+		}),
+	}
+	return c.doTemplateRequest(ctx, req)
+}
+
+// ListVersionsOptions specifies the constraints applied when listing template versions.
+//
+// All fields are optional. A zero value indicates that the corresponding constraint is not set.
+type ListVersionsOptions struct {
+	StartTime        time.Time
+	EndTime          time.Time
+	EndVersionNumber int64
+}
+
+// VersionIterator is an iterator over the versions of a Remote Config template.
+//
+// Versions are returned in reverse chronological order. Also see:
+// https://github.com/GoogleCloudPlatform/google-cloud-go/wiki/Iterator-Guidelines
+type VersionIterator struct {
+	client   *Client
+	ctx      context.Context
+	opts     ListVersionsOptions
+	nextFunc func() error
+	pageInfo *iterator.PageInfo
+	versions []*Version
+}
+
+// ListVersions returns an iterator over the published versions of the Remote Config template.
+//
+// opts may be nil, in which case all the versions stored by the service are returned.
+func (c *Client) ListVersions(ctx context.Context, opts *ListVersionsOptions) *VersionIterator {
+	it := &VersionIterator{
+		client: c,
+		ctx:    ctx,
+	}
+	if opts != nil {
+		it.opts = *opts
+	}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.versions) },
+		func() interface{} { b := it.versions; it.versions = nil; return b })
+	it.pageInfo.MaxSize = maxListVersionsResults
+	return it
+}
+
+func (it *VersionIterator) fetch(pageSize int, pageToken string) (string, error) {
+	params := map[string]string{
+		"pageSize": strconv.Itoa(pageSize),
+	}
+	if pageToken != "" {
+		params["pageToken"] = pageToken
+	}
+	if !it.opts.StartTime.IsZero() {
+		params["startTime"] = it.opts.StartTime.UTC().Format(time.RFC3339Nano)
+	}
+	if !it.opts.EndTime.IsZero() {
+		params["endTime"] = it.opts.EndTime.UTC().Format(time.RFC3339Nano)
+	}
+	if it.opts.EndVersionNumber > 0 {
+		params["endVersionNumber"] = strconv.FormatInt(it.opts.EndVersionNumber, 10)
+	}
+
+	c := it.client
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/projects/%s/remoteConfig:listVersions", c.endpoint, c.project),
+		Opts: []internal.HTTPOption{
+			internal.WithHeader("X-Client-Version", c.version),
+			internal.WithQueryParams(params),
+		},
+	}
+	resp, err := c.client.Do(it.ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Versions      []*Version `json:"versions"`
+		NextPageToken string     `json:"nextPageToken"`
+	}
+	if err := resp.Unmarshal(http.StatusOK, &result); err != nil {
+		return "", err
+	}
+	it.versions = append(it.versions, result.Versions...)
+	it.pageInfo.Token = result.NextPageToken
+	return result.NextPageToken, nil
+}
+
+// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
+func (it *VersionIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
+
+// Next returns the next result. Its second return value is iterator.Done if there are no more
+// results. Once Next returns iterator.Done, all subsequent calls will return iterator.Done.
+func (it *VersionIterator) Next() (*Version, error) {
+	if err := it.nextFunc(); err != nil {
+		return nil, err
+	}
+	v := it.versions[0]
+	it.versions = it.versions[1:]
+	return v, nil
+}
+
+func (c *Client) getTemplate(ctx context.Context, opts []internal.HTTPOption) (*Template, error) {
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/projects/%s/remoteConfig", c.endpoint, c.project),
+		Opts:   opts,
+	}
+	return c.doTemplateRequest(ctx, req)
+}
+
+func (c *Client) putTemplate(ctx context.Context, t *Template, etag string, validateOnly bool) (*Template, error) {
+	req := &internal.Request{
+		Method: http.MethodPut,
+		URL:    fmt.Sprintf("%s/projects/%s/remoteConfig", c.endpoint, c.project),
+		Body:   internal.NewJSONEntity(newTemplatePayload(t)),
+		Opts:   []internal.HTTPOption{internal.WithHeader("If-Match", etag)},
+	}
+	if validateOnly {
+		req.Opts = append(req.Opts, internal.WithQueryParam("validateOnly", "true"))
+	}
+	return c.doTemplateRequest(ctx, req)
+}
+
+func (c *Client) doTemplateRequest(ctx context.Context, req *internal.Request) (*Template, error) {
+	req.Opts = append(req.Opts, internal.WithHeader("X-Client-Version", c.version))
+	resp, err := c.client.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var t Template
+	if err := resp.Unmarshal(http.StatusOK, &t); err != nil {
+		return nil, err
+	}
+	t.ETag = resp.Header.Get("ETag")
+	return &t, nil
+}
+
+func parseErrorResponse(b []byte) string {
+	var p struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(b, &p); err != nil || p.Error.Message == "" {
+		return ""
+	}
+	if p.Error.Status != "" {
+		return fmt.Sprintf("%s: %s", p.Error.Status, p.Error.Message)
+	}
+	return p.Error.Message
+}
@@ -0,0 +1,387 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteconfig
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+var testRemoteConfigConfig = &internal.RemoteConfigConfig{
+	ProjectID: "test-project",
+	Opts: []option.ClientOption{
+		option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}),
+	},
+	Version: "test-version",
+}
+
+const testTemplateResponse = `{
+  "conditions": [
+    {"name": "ios", "expression": "device.os == 'ios'", "tagColor": "GREEN"}
+  ],
+  "parameters": {
+    "welcome_message": {
+      "defaultValue": {"value": "welcome"},
+      "conditionalValues": {"ios": {"useInAppDefault": true}},
+      "description": "text shown on launch",
+      "valueType": "STRING"
+    }
+  },
+  "parameterGroups": {
+    "flags": {
+      "description": "feature flags",
+      "parameters": {
+        "new_ui": {"defaultValue": {"value": "false"}, "valueType": "BOOLEAN"}
+      }
+    }
+  },
+  "version": {
+    "versionNumber": "6",
+    "updateTime": "2018-01-01T10:00:00Z",
+    "updateOrigin": "ADMIN_SDK_NODE",
+    "updateType": "INCREMENTAL_UPDATE",
+    "updateUser": {"email": "user@example.com"},
+    "description": "test version"
+  }
+}`
+
+var testTemplate = &Template{
+	Conditions: []*Condition{
+		{Name: "ios", Expression: "device.os == 'ios'", TagColor: "GREEN"},
+	},
+	Parameters: map[string]*Parameter{
+		"welcome_message": {
+			DefaultValue: &ParameterValue{Value: "welcome"},
+			ConditionalValues: map[string]*ParameterValue{
+				"ios": {UseInAppDefault: true},
+			},
+			Description: "text shown on launch",
+			ValueType:   ValueTypeString,
+		},
+	},
+	ParameterGroups: map[string]*ParameterGroup{
+		"flags": {
+			Description: "feature flags",
+			Parameters: map[string]*Parameter{
+				"new_ui": {
+					DefaultValue: &ParameterValue{Value: "false"},
+					ValueType:    ValueTypeBoolean,
+				},
+			},
+		},
+	},
+	Version: &Version{
+		VersionNumber: 6,
+		UpdateTime:    time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC),
+		UpdateOrigin:  "ADMIN_SDK_NODE",
+		UpdateType:    "INCREMENTAL_UPDATE",
+		UpdateUser:    &User{Email: "user@example.com"},
+		Description:   "test version",
+	},
+	ETag: "etag-123",
+}
+
+type mockServer struct {
+	Resp   string
+	Status int
+	Req    *http.Request
+	Rbody  []byte
+	Srv    *httptest.Server
+	Client *Client
+}
+
+func newMockServer(t *testing.T, resp string) *mockServer {
+	s := &mockServer{Resp: resp}
+	s.Srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Req = r
+		s.Rbody = b
+		if h := r.Header.Get("X-Client-Version"); h != "Go/Admin/test-version" {
+			t.Errorf("X-Client-Version = %q; want = %q", h, "Go/Admin/test-version")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", "etag-123")
+		if s.Status != 0 {
+			w.WriteHeader(s.Status)
+		}
+		w.Write([]byte(s.Resp))
+	}))
+
+	client, err := NewClient(context.Background(), testRemoteConfigConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = s.Srv.URL
+	s.Client = client
+	return s
+}
+
+func (s *mockServer) Close() {
+	s.Srv.Close()
+}
+
+func TestNoProjectID(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.RemoteConfigConfig{})
+	if client != nil || err == nil {
+		t.Errorf("NewClient() = (%v, %v); want = (nil, error)", client, err)
+	}
+}
+
+func TestGetTemplate(t *testing.T) {
+	s := newMockServer(t, testTemplateResponse)
+	defer s.Close()
+
+	template, err := s.Client.GetTemplate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(template, testTemplate) {
+		t.Errorf("GetTemplate() = %#v; want = %#v", template, testTemplate)
+	}
+	if s.Req.Method != http.MethodGet {
+		t.Errorf("Method = %q; want = %q", s.Req.Method, http.MethodGet)
+	}
+	if s.Req.URL.Path != "/projects/test-project/remoteConfig" {
+		t.Errorf("Path = %q; want = %q", s.Req.URL.Path, "/projects/test-project/remoteConfig")
+	}
+	if h := s.Req.Header.Get("Authorization"); h != "Bearer test-token" {
+		t.Errorf("Authorization = %q; want = %q", h, "Bearer test-token")
+	}
+}
+
+func TestGetTemplateAtVersion(t *testing.T) {
+	s := newMockServer(t, testTemplateResponse)
+	defer s.Close()
+
+	template, err := s.Client.GetTemplateAtVersion(context.Background(), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Version.VersionNumber != 6 {
+		t.Errorf("VersionNumber = %d; want = %d", template.Version.VersionNumber, 6)
+	}
+	if q := s.Req.URL.Query().Get("versionNumber"); q != "6" {
+		t.Errorf("versionNumber = %q; want = %q", q, "6")
+	}
+}
+
+func TestInvalidVersionNumber(t *testing.T) {
+	client, err := NewClient(context.Background(), testRemoteConfigConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, v := range []int64{0, -1} {
+		if template, err := client.GetTemplateAtVersion(ctx, v); template != nil || err == nil {
+			t.Errorf("GetTemplateAtVersion(%d) = (%v, %v); want = (nil, error)", v, template, err)
+		}
+		if template, err := client.Rollback(ctx, v); template != nil || err == nil {
+			t.Errorf("Rollback(%d) = (%v, %v); want = (nil, error)", v, template, err)
+		}
+	}
+}
+
+func TestPublishTemplate(t *testing.T) {
+	s := newMockServer(t, testTemplateResponse)
+	defer s.Close()
+
+	template, err := s.Client.PublishTemplate(context.Background(), testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.ETag != "etag-123" {
+		t.Errorf("ETag = %q; want = %q", template.ETag, "etag-123")
+	}
+	if s.Req.Method != http.MethodPut {
+		t.Errorf("Method = %q; want = %q", s.Req.Method, http.MethodPut)
+	}
+	if h := s.Req.Header.Get("If-Match"); h != "etag-123" {
+		t.Errorf("If-Match = %q; want = %q", h, "etag-123")
+	}
+	if q := s.Req.URL.Query().Get("validateOnly"); q != "" {
+		t.Errorf("validateOnly = %q; want = %q", q, "")
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(s.Rbody, &got); err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]interface{}
+	if err := json.Unmarshal([]byte(testTemplateResponse), &want); err != nil {
+		t.Fatal(err)
+	}
+	want["version"] = map[string]interface{}{"description": "test version"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PublishTemplate() request = %v; want = %v", got, want)
+	}
+}
+
+func TestForcePublishTemplate(t *testing.T) {
+	s := newMockServer(t, testTemplateResponse)
+	defer s.Close()
+
+	if _, err := s.Client.ForcePublishTemplate(context.Background(), &Template{}); err != nil {
+		t.Fatal(err)
+	}
+	if h := s.Req.Header.Get("If-Match"); h != "*" {
+		t.Errorf("If-Match = %q; want = %q", h, "*")
+	}
+	want := `{"conditions":[],"parameters":{},"parameterGroups":{}}`
+	if string(s.Rbody) != want {
+		t.Errorf("ForcePublishTemplate() request = %s; want = %s", string(s.Rbody), want)
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	s := newMockServer(t, testTemplateResponse)
+	defer s.Close()
+
+	in := &Template{ETag: "etag-original"}
+	template, err := s.Client.ValidateTemplate(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.ETag != in.ETag {
+		t.Errorf("ETag = %q; want = %q", template.ETag, in.ETag)
+	}
+	if h := s.Req.Header.Get("If-Match"); h != in.ETag {
+		t.Errorf("If-Match = %q; want = %q", h, in.ETag)
+	}
+	if q := s.Req.URL.Query().Get("validateOnly"); q != "true" {
+		t.Errorf("validateOnly = %q; want = %q", q, "true")
+	}
+}
+
+func TestTemplateWithoutETag(t *testing.T) {
+	client, err := NewClient(context.Background(), testRemoteConfigConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, tc := range []*Template{nil, {}} {
+		if template, err := client.PublishTemplate(ctx, tc); template != nil || err == nil {
+			t.Errorf("PublishTemplate(%v) = (%v, %v); want = (nil, error)", tc, template, err)
+		}
+		if template, err := client.ValidateTemplate(ctx, tc); template != nil || err == nil {
+			t.Errorf("ValidateTemplate(%v) = (%v, %v); want = (nil, error)", tc, template, err)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	s := newMockServer(t, testTemplateResponse)
+	defer s.Close()
+
+	if _, err := s.Client.Rollback(context.Background(), 4); err != nil {
+		t.Fatal(err)
+	}
+	if s.Req.Method != http.MethodPost {
+		t.Errorf("Method = %q; want = %q", s.Req.Method, http.MethodPost)
+	}
+	if s.Req.URL.Path != "/projects/test-project/remoteConfig:rollback" {
+		t.Errorf("Path = %q; want = %q", s.Req.URL.Path, "/projects/test-project/remoteConfig:rollback")
+	}
+	want := `{"versionNumber":"4"}`
+	if string(s.Rbody) != want {
+		t.Errorf("Rollback() request = %s; want = %s", string(s.Rbody), want)
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	pages := []string{
+		`{"versions": [{"versionNumber": "3"}, {"versionNumber": "2"}], "nextPageToken": "token"}`,
+		`{"versions": [{"versionNumber": "1"}]}`,
+	}
+	var queries []map[string][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(pages[len(queries)-1]))
+	}))
+	defer ts.Close()
+
+	client, err := NewClient(context.Background(), testRemoteConfigConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = ts.URL
+
+	opts := &ListVersionsOptions{
+		StartTime:        time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndVersionNumber: 3,
+	}
+	it := client.ListVersions(context.Background(), opts)
+	var got []int64
+	for {
+		v, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v.VersionNumber)
+	}
+
+	if want := []int64{3, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListVersions() = %v; want = %v", got, want)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("Requests = %d; want = %d", len(queries), 2)
+	}
+	want := map[string][]string{
+		"pageSize":         {"300"},
+		"startTime":        {"2018-01-01T00:00:00Z"},
+		"endVersionNumber": {"3"},
+	}
+	if !reflect.DeepEqual(queries[0], want) {
+		t.Errorf("ListVersions() query = %v; want = %v", queries[0], want)
+	}
+	want["pageToken"] = []string{"token"}
+	if !reflect.DeepEqual(queries[1], want) {
+		t.Errorf("ListVersions() query = %v; want = %v", queries[1], want)
+	}
+}
+
+func TestRemoteConfigError(t *testing.T) {
+	s := newMockServer(t, `{"error": {"status": "FAILED_PRECONDITION", "message": "etag mismatch"}}`)
+	defer s.Close()
+	s.Status = http.StatusPreconditionFailed
+
+	template, err := s.Client.PublishTemplate(context.Background(), testTemplate)
+	if template != nil || err == nil {
+		t.Fatalf("PublishTemplate() = (%v, %v); want = (nil, error)", template, err)
+	}
+	want := "http error status: 412; reason: FAILED_PRECONDITION: etag mismatch"
+	if err.Error() != want {
+		t.Errorf("PublishTemplate() = %v; want = %v", err, want)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+// ServerTemplate is a Remote Config template that can be evaluated locally on the server.
+//
+// Unlike client templates, the conditions of a server template are represented as structured
+// trees instead of expression strings. A ServerTemplate can be fetched once, and then evaluated
+// any number of times against different EvaluationContext values without further network calls.
+type ServerTemplate struct {
+	Conditions []*NamedCondition     `json:"conditions,omitempty"`
+	Parameters map[string]*Parameter `json:"parameters,omitempty"`
+	Version    *Version              `json:"version,omitempty"`
+	ETag       string                `json:"-"`
+
+	// Defaults contains the in-app default values of parameters. These values are used for
+	// parameters that are not defined in the template, or that are set to use the in-app
+	// default.
+	Defaults map[string]string `json:"-"`
+}
+
+// NamedCondition is a condition of a server template, along with its name.
+type NamedCondition struct {
+	Name      string          `json:"name"`
+	Condition *OneOfCondition `json:"condition"`
+}
+
+// OneOfCondition is a node of a condition tree. Exactly one of its fields must be set.
+type OneOfCondition struct {
+	OrCondition  *OrCondition           `json:"orCondition,omitempty"`
+	AndCondition *AndCondition          `json:"andCondition,omitempty"`
+	Percent      *PercentCondition      `json:"percent,omitempty"`
+	CustomSignal *CustomSignalCondition `json:"customSignal,omitempty"`
+	True         *struct{}              `json:"true,omitempty"`
+	False        *struct{}              `json:"false,omitempty"`
+}
+
+// OrCondition evaluates to true if any of its sub-conditions evaluates to true.
+type OrCondition struct {
+	Conditions []*OneOfCondition `json:"conditions,omitempty"`
+}
+
+// AndCondition evaluates to true if all of its sub-conditions evaluate to true.
+type AndCondition struct {
+	Conditions []*OneOfCondition `json:"conditions,omitempty"`
+}
+
+// Operators supported by PercentCondition.
+const (
+	PercentLessOrEqual = "LESS_OR_EQUAL"
+	PercentGreaterThan = "GREATER_THAN"
+	PercentBetween     = "BETWEEN"
+)
+
+// PercentCondition assigns evaluation contexts to a percentile based on their randomization ID.
+//
+// Percentages are expressed in micro-percents, ranging from 0 to 100,000,000. The percentile of
+// a context is determined by hashing its randomization ID together with the seed, which makes
+// the assignment stable across evaluations.
+type PercentCondition struct {
+	PercentOperator   string             `json:"percentOperator,omitempty"`
+	MicroPercent      int64              `json:"microPercent,omitempty"`
+	MicroPercentRange *MicroPercentRange `json:"microPercentRange,omitempty"`
+	Seed              string             `json:"seed,omitempty"`
+}
+
+// MicroPercentRange is the range used by the BETWEEN percent operator. The lower bound is
+// exclusive and the upper bound is inclusive.
+type MicroPercentRange struct {
+	MicroPercentLowerBound int64 `json:"microPercentLowerBound,omitempty"`
+	MicroPercentUpperBound int64 `json:"microPercentUpperBound,omitempty"`
+}
+
+// Operators supported by CustomSignalCondition.
+const (
+	StringContains              = "STRING_CONTAINS"
+	StringDoesNotContain        = "STRING_DOES_NOT_CONTAIN"
+	StringExactlyMatches        = "STRING_EXACTLY_MATCHES"
+	StringContainsRegex         = "STRING_CONTAINS_REGEX"
+	NumericLessThan             = "NUMERIC_LESS_THAN"
+	NumericLessEqual            = "NUMERIC_LESS_EQUAL"
+	NumericEqual                = "NUMERIC_EQUAL"
+	NumericNotEqual             = "NUMERIC_NOT_EQUAL"
+	NumericGreaterThan          = "NUMERIC_GREATER_THAN"
+	NumericGreaterEqual         = "NUMERIC_GREATER_EQUAL"
+	SemanticVersionLessThan     = "SEMANTIC_VERSION_LESS_THAN"
+	SemanticVersionLessEqual    = "SEMANTIC_VERSION_LESS_EQUAL"
+	SemanticVersionEqual        = "SEMANTIC_VERSION_EQUAL"
+	SemanticVersionNotEqual     = "SEMANTIC_VERSION_NOT_EQUAL"
+	SemanticVersionGreaterThan  = "SEMANTIC_VERSION_GREATER_THAN"
+	SemanticVersionGreaterEqual = "SEMANTIC_VERSION_GREATER_EQUAL"
+)
+
+// CustomSignalCondition compares a custom signal of the evaluation context against a set of
+// target values.
+type CustomSignalCondition struct {
+	CustomSignalOperator     string   `json:"customSignalOperator,omitempty"`
+	CustomSignalKey          string   `json:"customSignalKey,omitempty"`
+	TargetCustomSignalValues []string `json:"targetCustomSignalValues,omitempty"`
+}
+
+// GetServerTemplate retrieves the currently active server template of the project.
+func (c *Client) GetServerTemplate(ctx context.Context) (*ServerTemplate, error) {
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL: fmt.Sprintf("%s/projects/%s/namespaces/firebase-server/serverRemoteConfig",
+			c.endpoint, c.project),
+		Opts: []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	}
+	resp, err := c.client.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var t ServerTemplate
+	if err := resp.Unmarshal(http.StatusOK, &t); err != nil {
+		return nil, err
+	}
+	t.ETag = resp.Header.Get("ETag")
+	return &t, nil
+}
+
+// ParseServerTemplate parses the JSON representation of a server template, as returned by the
+// Remote Config service.
+//
+// This can be used to initialize a ServerTemplate from a cached copy, without making a network
+// call.
+func ParseServerTemplate(b []byte) (*ServerTemplate, error) {
+	var t ServerTemplate
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// EvaluationContext contains the attributes against which the conditions of a server template
+// are evaluated.
+type EvaluationContext struct {
+	// RandomizationID is used to assign the context to a percentile in percent conditions,
+	// typically a user ID. Percent conditions evaluate to false when it is empty.
+	RandomizationID string
+
+	// CustomSignals are matched against custom signal conditions. Values are compared as strings,
+	// numbers or semantic versions, depending on the operator of the condition.
+	CustomSignals map[string]interface{}
+}
+
+// Evaluate resolves the values of all parameters in the template for the given context.
+//
+// For each parameter, the conditional value of the first condition in the template that
+// evaluates to true is used. If no condition applies, the default value of the parameter is used.
+//
+// Conditions with unknown operators, or nested deeper than the service allows, evaluate to false.
+func (t *ServerTemplate) Evaluate(ec *EvaluationContext) *ServerConfig {
+	if ec == nil {
+		ec = &EvaluationContext{}
+	}
+	results := evaluateConditions(t.Conditions, ec)
+
+	values := make(map[string]*Value)
+	for k, v := range t.Defaults {
+		values[k] = &Value{source: SourceDefault, value: v}
+	}
+	for key, p := range t.Parameters {
+		pv := p.DefaultValue
+		for _, cond := range t.Conditions {
+			if cv, ok := p.ConditionalValues[cond.Name]; ok && results[cond.Name] {
+				pv = cv
+				break
+			}
+		}
+		if pv == nil || pv.UseInAppDefault {
+			continue
+		}
+		values[key] = &Value{source: SourceRemote, value: pv.Value}
+	}
+	return &ServerConfig{values: values}
+}
+
+// Sources of the values in a ServerConfig.
+const (
+	SourceStatic  = "static"
+	SourceDefault = "default"
+	SourceRemote  = "remote"
+)
+
+// ServerConfig contains the parameter values obtained by evaluating a ServerTemplate.
+type ServerConfig struct {
+	values map[string]*Value
+}
+
+// GetValue returns the Value of the given parameter.
+//
+// If the parameter is not defined in the template or in the defaults, GetValue returns a static
+// empty value.
+func (c *ServerConfig) GetValue(key string) *Value {
+	if v, ok := c.values[key]; ok {
+		return v
+	}
+	return &Value{source: SourceStatic}
+}
+
+// GetString returns the value of the given parameter as a string.
+func (c *ServerConfig) GetString(key string) string {
+	return c.GetValue(key).AsString()
+}
+
+// GetBoolean returns the value of the given parameter as a boolean.
+func (c *ServerConfig) GetBoolean(key string) bool {
+	return c.GetValue(key).AsBoolean()
+}
+
+// GetInt returns the value of the given parameter as an integer.
+func (c *ServerConfig) GetInt(key string) int {
+	return int(c.GetValue(key).AsNumber())
+}
+
+// GetFloat returns the value of the given parameter as a float.
+func (c *ServerConfig) GetFloat(key string) float64 {
+	return c.GetValue(key).AsNumber()
+}
+
+// Value is a parameter value resolved by evaluating a ServerTemplate.
+type Value struct {
+	source string
+	value  string
+}
+
+// Source returns where the value was obtained from: SourceRemote for values defined in the
+// template, SourceDefault for in-app defaults, and SourceStatic when no value is available.
+func (v *Value) Source() string {
+	return v.source
+}
+
+// AsString returns the value as a string.
+func (v *Value) AsString() string {
+	return v.value
+}
+
+// AsBoolean returns the value as a boolean.
+//
+// The strings "1", "true", "t", "yes", "y" and "on" are considered true, regardless of case.
+// All other values are considered false.
+func (v *Value) AsBoolean() bool {
+	switch strings.ToLower(v.value) {
+	case "1", "true", "t", "yes", "y", "on":
+		return true
+	}
+	return false
+}
+
+// AsNumber returns the value as a number, or 0 if the value is not numeric.
+func (v *Value) AsNumber() float64 {
+	f, err := strconv.ParseFloat(v.value, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteconfig
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+const testServerTemplateResponse = `{
+  "conditions": [
+    {
+      "name": "beta_testers",
+      "condition": {
+        "orCondition": {
+          "conditions": [{
+            "andCondition": {
+              "conditions": [
+                {"customSignal": {
+                  "customSignalOperator": "STRING_EXACTLY_MATCHES",
+                  "customSignalKey": "tier",
+                  "targetCustomSignalValues": ["beta"]
+                }},
+                {"customSignal": {
+                  "customSignalOperator": "SEMANTIC_VERSION_GREATER_EQUAL",
+                  "customSignalKey": "app_version",
+                  "targetCustomSignalValues": ["2.0"]
+                }}
+              ]
+            }
+          }]
+        }
+      }
+    },
+    {
+      "name": "everyone",
+      "condition": {"orCondition": {"conditions": [{"true": {}}]}}
+    }
+  ],
+  "parameters": {
+    "welcome_message": {
+      "defaultValue": {"value": "hello"},
+      "conditionalValues": {
+        "everyone": {"value": "hi everyone"},
+        "beta_testers": {"value": "hi tester"}
+      }
+    },
+    "new_ui": {
+      "defaultValue": {"value": "false"},
+      "conditionalValues": {"beta_testers": {"value": "true"}}
+    },
+    "max_items": {
+      "defaultValue": {"value": "10"}
+    },
+    "theme": {
+      "defaultValue": {"useInAppDefault": true}
+    }
+  },
+  "version": {"versionNumber": "12"}
+}`
+
+func TestGetServerTemplate(t *testing.T) {
+	s := newMockServer(t, testServerTemplateResponse)
+	defer s.Close()
+
+	template, err := s.Client.GetServerTemplate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Req.Method != http.MethodGet {
+		t.Errorf("Method = %q; want = %q", s.Req.Method, http.MethodGet)
+	}
+	want := "/projects/test-project/namespaces/firebase-server/serverRemoteConfig"
+	if s.Req.URL.Path != want {
+		t.Errorf("Path = %q; want = %q", s.Req.URL.Path, want)
+	}
+	if template.ETag != "etag-123" {
+		t.Errorf("ETag = %q; want = %q", template.ETag, "etag-123")
+	}
+	if len(template.Conditions) != 2 || len(template.Parameters) != 4 {
+		t.Errorf("GetServerTemplate() = (%d conditions, %d parameters); want = (2, 4)",
+			len(template.Conditions), len(template.Parameters))
+	}
+	if template.Version.VersionNumber != 12 {
+		t.Errorf("VersionNumber = %d; want = %d", template.Version.VersionNumber, 12)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	template, err := ParseServerTemplate([]byte(testServerTemplateResponse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Defaults = map[string]string{
+		"theme":   "dark",
+		"timeout": "2.5",
+	}
+
+	cases := []struct {
+		name    string
+		ec      *EvaluationContext
+		message string
+		newUI   bool
+	}{
+		{"NilContext", nil, "hi everyone", false},
+		{"NotBeta", &EvaluationContext{
+			CustomSignals: map[string]interface{}{"tier": "beta", "app_version": "1.9"},
+		}, "hi everyone", false},
+		{"Beta", &EvaluationContext{
+			CustomSignals: map[string]interface{}{"tier": "beta", "app_version": "2.0.1"},
+		}, "hi tester", true},
+	}
+	for _, tc := range cases {
+		config := template.Evaluate(tc.ec)
+		if got := config.GetString("welcome_message"); got != tc.message {
+			t.Errorf("Evaluate(%s).GetString() = %q; want = %q", tc.name, got, tc.message)
+		}
+		if got := config.GetBoolean("new_ui"); got != tc.newUI {
+			t.Errorf("Evaluate(%s).GetBoolean() = %v; want = %v", tc.name, got, tc.newUI)
+		}
+	}
+
+	config := template.Evaluate(nil)
+	if got := config.GetInt("max_items"); got != 10 {
+		t.Errorf("GetInt(max_items) = %d; want = %d", got, 10)
+	}
+	if got := config.GetFloat("timeout"); got != 2.5 {
+		t.Errorf("GetFloat(timeout) = %f; want = %f", got, 2.5)
+	}
+
+	sources := map[string]string{
+		"welcome_message": SourceRemote,
+		"theme":           SourceDefault,
+		"timeout":         SourceDefault,
+		"missing":         SourceStatic,
+	}
+	for key, want := range sources {
+		if got := config.GetValue(key).Source(); got != want {
+			t.Errorf("GetValue(%q).Source() = %q; want = %q", key, got, want)
+		}
+	}
+	if got := config.GetString("theme"); got != "dark" {
+		t.Errorf("GetString(theme) = %q; want = %q", got, "dark")
+	}
+	if got := config.GetString("missing"); got != "" {
+		t.Errorf("GetString(missing) = %q; want = %q", got, "")
+	}
+}
+
+func TestValueConversions(t *testing.T) {
+	cases := []struct {
+		value   string
+		boolean bool
+		number  float64
+	}{
+		{"true", true, 0},
+		{"ON", true, 0},
+		{"1", true, 1},
+		{"yes", true, 0},
+		{"false", false, 0},
+		{"0", false, 0},
+		{"3.75", false, 3.75},
+		{"", false, 0},
+	}
+	for _, tc := range cases {
+		v := &Value{source: SourceRemote, value: tc.value}
+		if got := v.AsBoolean(); got != tc.boolean {
+			t.Errorf("AsBoolean(%q) = %v; want = %v", tc.value, got, tc.boolean)
+		}
+		if got := v.AsNumber(); got != tc.number {
+			t.Errorf("AsNumber(%q) = %f; want = %f", tc.value, got, tc.number)
+		}
+	}
+}
+
+func TestParseServerTemplateError(t *testing.T) {
+	if template, err := ParseServerTemplate([]byte("not json")); template != nil || err == nil {
+		t.Errorf("ParseServerTemplate() = (%v, %v); want = (nil, error)", template, err)
+	}
+}
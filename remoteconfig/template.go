@@ -0,0 +1,156 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteconfig
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Parameter value types supported by Remote Config.
+const (
+	ValueTypeString  = "STRING"
+	ValueTypeBoolean = "BOOLEAN"
+	ValueTypeNumber  = "NUMBER"
+	ValueTypeJSON    = "JSON"
+)
+
+// Template represents a Remote Config template.
+//
+// A template is the set of parameters, parameter groups and conditions that make up the Remote
+// Config of a project. The ETag field identifies the exact version of the template it was read
+// from, and is used to detect concurrent modifications when the template is published.
+type Template struct {
+	Conditions      []*Condition               `json:"conditions,omitempty"`
+	Parameters      map[string]*Parameter      `json:"parameters,omitempty"`
+	ParameterGroups map[string]*ParameterGroup `json:"parameterGroups,omitempty"`
+	Version         *Version                   `json:"version,omitempty"`
+	ETag            string                     `json:"-"`
+}
+
+// Condition targets a specific group of users. Conditions are evaluated in the order in which
+// they appear in the template.
+type Condition struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	TagColor   string `json:"tagColor,omitempty"`
+}
+
+// Parameter is a single Remote Config parameter.
+//
+// A parameter has a default value, and optionally a set of values that apply when the named
+// conditions evaluate to true.
+type Parameter struct {
+	DefaultValue      *ParameterValue            `json:"defaultValue,omitempty"`
+	ConditionalValues map[string]*ParameterValue `json:"conditionalValues,omitempty"`
+	Description       string                     `json:"description,omitempty"`
+	ValueType         string                     `json:"valueType,omitempty"`
+}
+
+// ParameterGroup is a named collection of parameters.
+type ParameterGroup struct {
+	Description string                `json:"description,omitempty"`
+	Parameters  map[string]*Parameter `json:"parameters,omitempty"`
+}
+
+// ParameterValue is the value of a Parameter.
+//
+// A ParameterValue either holds an explicit value, or indicates that the client should fall back
+// to the in-app default value of the parameter.
+type ParameterValue struct {
+	Value           string
+	UseInAppDefault bool
+}
+
+// MarshalJSON marshals a ParameterValue into the JSON representation used by Remote Config.
+func (v *ParameterValue) MarshalJSON() ([]byte, error) {
+	if v.UseInAppDefault {
+		return json.Marshal(map[string]bool{"useInAppDefault": true})
+	}
+	return json.Marshal(map[string]string{"value": v.Value})
+}
+
+// UnmarshalJSON unmarshals the JSON representation of a parameter value.
+func (v *ParameterValue) UnmarshalJSON(b []byte) error {
+	var p struct {
+		Value           *string `json:"value"`
+		UseInAppDefault bool    `json:"useInAppDefault"`
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	v.UseInAppDefault = p.UseInAppDefault
+	v.Value = ""
+	if p.Value != nil {
+		v.Value = *p.Value
+	}
+	return nil
+}
+
+// Version contains metadata about a particular version of a Remote Config template.
+//
+// Version metadata is assigned by the Remote Config service. The only field that can be set
+// when publishing a template is Description.
+type Version struct {
+	VersionNumber  int64     `json:"versionNumber,string,omitempty"`
+	UpdateTime     time.Time `json:"updateTime"`
+	UpdateOrigin   string    `json:"updateOrigin,omitempty"`
+	UpdateType     string    `json:"updateType,omitempty"`
+	UpdateUser     *User     `json:"updateUser,omitempty"`
+	Description    string    `json:"description,omitempty"`
+	RollbackSource int64     `json:"rollbackSource,string,omitempty"`
+	IsLegacy       bool      `json:"isLegacy,omitempty"`
+}
+
+// User is the user who performed an update on a Remote Config template.
+type User struct {
+	Email    string `json:"email,omitempty"`
+	Name     string `json:"name,omitempty"`
+	ImageURL string `json:"imageUrl,omitempty"`
+}
+
+// templatePayload is the request body sent when validating or publishing a template. Version
+// metadata is output-only, apart from the description.
+type templatePayload struct {
+	Conditions      []*Condition               `json:"conditions"`
+	Parameters      map[string]*Parameter      `json:"parameters"`
+	ParameterGroups map[string]*ParameterGroup `json:"parameterGroups"`
+	Version         *versionPayload            `json:"version,omitempty"`
+}
+
+type versionPayload struct {
+	Description string `json:"description"`
+}
+
+func newTemplatePayload(t *Template) *templatePayload {
+	p := &templatePayload{
+		Conditions:      t.Conditions,
+		Parameters:      t.Parameters,
+		ParameterGroups: t.ParameterGroups,
+	}
+	if p.Conditions == nil {
+		p.Conditions = []*Condition{}
+	}
+	if p.Parameters == nil {
+		p.Parameters = map[string]*Parameter{}
+	}
+	if p.ParameterGroups == nil {
+		p.ParameterGroups = map[string]*ParameterGroup{}
+	}
+	if t.Version != nil && t.Version.Description != "" {
+		p.Version = &versionPayload{Description: t.Version.Description}
+	}
+	return p
+}
@@ -0,0 +1,489 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package securityrules contains functions for managing the Cloud Firestore and Cloud Storage
+// security rules of Firebase projects.
+package securityrules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/transport"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+const securityRulesEndpoint = "https://firebaserules.googleapis.com/v1"
+
+const maxListRulesetsResults = 100
+
+const (
+	firestoreRelease     = "cloud.firestore"
+	storageReleasePrefix = "firebase.storage/"
+)
+
+// Client is the interface for the Firebase Security Rules service.
+type Client struct {
+	// To enable testing against arbitrary endpoints.
+	endpoint string
+	client   *internal.HTTPClient
+	project  string
+	bucket   string
+	version  string
+}
+
+// NewClient creates a new instance of the Firebase Security Rules Client.
+//
+// This function can only be invoked from within the SDK. Client applications should access the
+// the Security Rules service through firebase.App.
+func NewClient(ctx context.Context, c *internal.SecurityRulesConfig) (*Client, error) {
+	if c.ProjectID == "" {
+		return nil, errors.New("project id is required to access security rules client")
+	}
+
+	hc, _, err := transport.NewHTTPClient(ctx, c.Opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		endpoint: securityRulesEndpoint,
+		client:   &internal.HTTPClient{Client: hc, ErrParser: parseErrorResponse},
+		project:  c.ProjectID,
+		bucket:   c.Bucket,
+		version:  "Go/Admin/" + c.Version,
+	}, nil
+}
+
+// RulesFile is a source file containing security rules.
+type RulesFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// ReadRulesFile reads the security rules source file at the given path.
+//
+// The base name of the path is used as the name of the returned RulesFile.
+func ReadRulesFile(path string) (*RulesFile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &RulesFile{Name: filepath.Base(path), Content: string(b)}, nil
+}
+
+// Ruleset is a set of security rules source files, identified by a name assigned by the
+// service.
+type Ruleset struct {
+	Name       string
+	Files      []*RulesFile
+	CreateTime time.Time
+}
+
+type rulesetResponse struct {
+	Name   string `json:"name"`
+	Source struct {
+		Files []*RulesFile `json:"files"`
+	} `json:"source"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+// RulesetMetadata contains the name and the creation time of a Ruleset.
+type RulesetMetadata struct {
+	Name       string    `json:"name"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+// GetFirestoreRuleset retrieves the Ruleset currently applied to Cloud Firestore.
+func (c *Client) GetFirestoreRuleset(ctx context.Context) (*Ruleset, error) {
+	return c.getReleasedRuleset(ctx, firestoreRelease)
+}
+
+// GetStorageRuleset retrieves the Ruleset currently applied to the given Cloud Storage bucket.
+//
+// If bucket is empty, the default bucket specified via firebase.Config is used.
+func (c *Client) GetStorageRuleset(ctx context.Context, bucket string) (*Ruleset, error) {
+	release, err := c.storageRelease(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return c.getReleasedRuleset(ctx, release)
+}
+
+// GetRuleset retrieves the Ruleset with the given name.
+//
+// The name may either be the fully qualified resource name of the Ruleset, or just its ID.
+func (c *Client) GetRuleset(ctx context.Context, name string) (*Ruleset, error) {
+	if name == "" {
+		return nil, errors.New("ruleset name must not be empty")
+	}
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/%s", c.endpoint, c.rulesetName(name)),
+	}
+	var result rulesetResponse
+	if err := c.do(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return result.toRuleset(), nil
+}
+
+// CreateRuleset creates a new Ruleset from the given source files.
+//
+// Creating a Ruleset does not apply it to any service. Call ReleaseFirestoreRuleset or
+// ReleaseStorageRuleset with the name of the returned Ruleset to apply it.
+func (c *Client) CreateRuleset(ctx context.Context, files ...*RulesFile) (*Ruleset, error) {
+	if err := validateRulesFiles(files); err != nil {
+		return nil, err
+	}
+
+	payload := map[string]interface{}{
+		"source": map[string]interface{}{"files": files},
+	}
+	req := &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/projects/%s/rulesets", c.endpoint, c.project),
+		Body:   internal.NewJSONEntity(payload),
+	}
+	var result rulesetResponse
+	if err := c.do(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return result.toRuleset(), nil
+}
+
+// ReleaseFirestoreRuleset applies the Ruleset with the given name to Cloud Firestore.
+func (c *Client) ReleaseFirestoreRuleset(ctx context.Context, rulesetName string) error {
+	return c.release(ctx, firestoreRelease, rulesetName)
+}
+
+// ReleaseStorageRuleset applies the Ruleset with the given name to the given Cloud Storage
+// bucket.
+//
+// If bucket is empty, the default bucket specified via firebase.Config is used.
+func (c *Client) ReleaseStorageRuleset(ctx context.Context, bucket, rulesetName string) error {
+	release, err := c.storageRelease(bucket)
+	if err != nil {
+		return err
+	}
+	return c.release(ctx, release, rulesetName)
+}
+
+// Deployment is the result of deploying a Ruleset with DeployFirestoreRuleset or
+// DeployStorageRuleset.
+type Deployment struct {
+	// Ruleset is the newly created Ruleset, which is applied to the service.
+	Ruleset *Ruleset
+
+	// PreviousRulesetName is the name of the Ruleset that was applied to the service before the
+	// deployment, or empty if no Ruleset was applied.
+	PreviousRulesetName string
+
+	client  *Client
+	release string
+}
+
+// DeployFirestoreRuleset creates a Ruleset from the given files and applies it to Cloud Firestore.
+//
+// The name of the previously applied Ruleset is recorded in the returned Deployment. If the new
+// Ruleset cannot be applied, the previous Ruleset is restored before returning the error. Call
+// Rollback on the Deployment to restore the previous Ruleset at a later point, for example when
+// checks run after the deployment fail.
+func (c *Client) DeployFirestoreRuleset(ctx context.Context, files ...*RulesFile) (*Deployment, error) {
+	return c.deploy(ctx, firestoreRelease, files)
+}
+
+// DeployStorageRuleset creates a Ruleset from the given files and applies it to the given Cloud
+// Storage bucket. See DeployFirestoreRuleset for details on how failures are handled.
+//
+// If bucket is empty, the default bucket specified via firebase.Config is used.
+func (c *Client) DeployStorageRuleset(ctx context.Context, bucket string, files ...*RulesFile) (*Deployment, error) {
+	release, err := c.storageRelease(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return c.deploy(ctx, release, files)
+}
+
+// Rollback applies the Ruleset that was applied before the deployment.
+//
+// Rollback returns an error if no Ruleset was applied to the service before the deployment. The
+// Ruleset created by the deployment is not deleted.
+func (d *Deployment) Rollback(ctx context.Context) error {
+	if d.PreviousRulesetName == "" {
+		return errors.New("no previous ruleset to roll back to")
+	}
+	return d.client.release(ctx, d.release, d.PreviousRulesetName)
+}
+
+// DeleteRuleset deletes the Ruleset with the given name.
+//
+// A Ruleset that is currently applied to a service cannot be deleted.
+func (c *Client) DeleteRuleset(ctx context.Context, name string) error {
+	if name == "" {
+		return errors.New("ruleset name must not be empty")
+	}
+	req := &internal.Request{
+		Method: http.MethodDelete,
+		URL:    fmt.Sprintf("%s/%s", c.endpoint, c.rulesetName(name)),
+	}
+	return c.do(ctx, req, nil)
+}
+
+// RulesetIterator is an iterator over the metadata of the Rulesets in a project.
+//
+// Rulesets are returned in reverse chronological order. Also see:
+// https://github.com/GoogleCloudPlatform/google-cloud-go/wiki/Iterator-Guidelines
+type RulesetIterator struct {
+	client   *Client
+	ctx      context.Context
+	nextFunc func() error
+	pageInfo *iterator.PageInfo
+	rulesets []*RulesetMetadata
+}
+
+// ListRulesetMetadata returns an iterator over the metadata of all the Rulesets in the project.
+func (c *Client) ListRulesetMetadata(ctx context.Context) *RulesetIterator {
+	it := &RulesetIterator{
+		client: c,
+		ctx:    ctx,
+	}
+	it.pageInfo, it.nextFunc = iterator.NewPageInfo(
+		it.fetch,
+		func() int { return len(it.rulesets) },
+		func() interface{} { b := it.rulesets; it.rulesets = nil; return b })
+	it.pageInfo.MaxSize = maxListRulesetsResults
+	return it
+}
+
+func (it *RulesetIterator) fetch(pageSize int, pageToken string) (string, error) {
+	params := map[string]string{
+		"pageSize": strconv.Itoa(pageSize),
+	}
+	if pageToken != "" {
+		params["pageToken"] = pageToken
+	}
+
+	c := it.client
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/projects/%s/rulesets", c.endpoint, c.project),
+		Opts:   []internal.HTTPOption{internal.WithQueryParams(params)},
+	}
+	var result struct {
+		Rulesets      []*RulesetMetadata `json:"rulesets"`
+		NextPageToken string             `json:"nextPageToken"`
+	}
+	if err := c.do(it.ctx, req, &result); err != nil {
+		return "", err
+	}
+	it.rulesets = append(it.rulesets, result.Rulesets...)
+	it.pageInfo.Token = result.NextPageToken
+	return result.NextPageToken, nil
+}
+
+// PageInfo supports pagination. See the google.golang.org/api/iterator package for details.
+func (it *RulesetIterator) PageInfo() *iterator.PageInfo { return it.pageInfo }
+
+// Next returns the next result. Its second return value is iterator.Done if there are no more
+// results. Once Next returns iterator.Done, all subsequent calls will return iterator.Done.
+func (it *RulesetIterator) Next() (*RulesetMetadata, error) {
+	if err := it.nextFunc(); err != nil {
+		return nil, err
+	}
+	r := it.rulesets[0]
+	it.rulesets = it.rulesets[1:]
+	return r, nil
+}
+
+type release struct {
+	Name        string `json:"name"`
+	RulesetName string `json:"rulesetName"`
+}
+
+func (c *Client) getReleasedRuleset(ctx context.Context, name string) (*Ruleset, error) {
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/%s", c.endpoint, c.releaseName(name)),
+	}
+	var r release
+	if err := c.do(ctx, req, &r); err != nil {
+		return nil, err
+	}
+	return c.GetRuleset(ctx, r.RulesetName)
+}
+
+// releasedRulesetName returns the name of the Ruleset applied by the given release, or an empty
+// string if the release does not exist.
+func (c *Client) releasedRulesetName(ctx context.Context, name string) (string, error) {
+	req := &internal.Request{
+		Method: http.MethodGet,
+		URL:    fmt.Sprintf("%s/%s", c.endpoint, c.releaseName(name)),
+		Opts:   []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	}
+	resp, err := c.client.Do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if resp.Status == http.StatusNotFound {
+		return "", nil
+	}
+	var r release
+	if err := resp.Unmarshal(http.StatusOK, &r); err != nil {
+		return "", err
+	}
+	return r.RulesetName, nil
+}
+
+func (c *Client) deploy(ctx context.Context, name string, files []*RulesFile) (*Deployment, error) {
+	if err := validateRulesFiles(files); err != nil {
+		return nil, err
+	}
+	prev, err := c.releasedRulesetName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := c.CreateRuleset(ctx, files...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.release(ctx, name, rs.Name); err != nil {
+		// The release may have been updated even though the request failed, for example when the
+		// response was lost. Restore the previous Ruleset to be sure.
+		if prev != "" {
+			if rerr := c.release(ctx, name, prev); rerr != nil {
+				return nil, fmt.Errorf("failed to release ruleset: %v; failed to restore %q: %v", err, prev, rerr)
+			}
+		}
+		return nil, err
+	}
+	return &Deployment{
+		Ruleset:             rs,
+		PreviousRulesetName: prev,
+		client:              c,
+		release:             name,
+	}, nil
+}
+
+// release points the named release to the given Ruleset, creating the release if it does not
+// exist yet.
+func (c *Client) release(ctx context.Context, name, rulesetName string) error {
+	if rulesetName == "" {
+		return errors.New("ruleset name must not be empty")
+	}
+	r := &release{
+		Name:        c.releaseName(name),
+		RulesetName: c.rulesetName(rulesetName),
+	}
+	req := &internal.Request{
+		Method: http.MethodPatch,
+		URL:    fmt.Sprintf("%s/%s", c.endpoint, r.Name),
+		Body:   internal.NewJSONEntity(map[string]interface{}{"release": r}),
+		Opts:   []internal.HTTPOption{internal.WithHeader("X-Client-Version", c.version)},
+	}
+	resp, err := c.client.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Status != http.StatusNotFound {
+		return resp.CheckStatus(http.StatusOK)
+	}
+
+	req = &internal.Request{
+		Method: http.MethodPost,
+		URL:    fmt.Sprintf("%s/projects/%s/releases", c.endpoint, c.project),
+		Body:   internal.NewJSONEntity(r),
+	}
+	return c.do(ctx, req, nil)
+}
+
+func validateRulesFiles(files []*RulesFile) error {
+	if len(files) == 0 {
+		return errors.New("at least one rules file must be specified")
+	}
+	for _, f := range files {
+		if f == nil || f.Name == "" {
+			return errors.New("rules files must be non-nil and have a name")
+		}
+	}
+	return nil
+}
+
+func (c *Client) storageRelease(bucket string) (string, error) {
+	if bucket == "" {
+		bucket = c.bucket
+	}
+	if bucket == "" {
+		return "", errors.New("bucket name not specified")
+	}
+	return storageReleasePrefix + bucket, nil
+}
+
+func (c *Client) releaseName(name string) string {
+	return fmt.Sprintf("projects/%s/releases/%s", c.project, name)
+}
+
+func (c *Client) rulesetName(name string) string {
+	if strings.HasPrefix(name, "projects/") {
+		return name
+	}
+	return fmt.Sprintf("projects/%s/rulesets/%s", c.project, name)
+}
+
+func (c *Client) do(ctx context.Context, req *internal.Request, v interface{}) error {
+	req.Opts = append(req.Opts, internal.WithHeader("X-Client-Version", c.version))
+	resp, err := c.client.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return resp.CheckStatus(http.StatusOK)
+	}
+	return resp.Unmarshal(http.StatusOK, v)
+}
+
+func (r *rulesetResponse) toRuleset() *Ruleset {
+	return &Ruleset{
+		Name:       r.Name,
+		Files:      r.Source.Files,
+		CreateTime: r.CreateTime,
+	}
+}
+
+func parseErrorResponse(b []byte) string {
+	var p struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(b, &p); err != nil || p.Error.Message == "" {
+		return ""
+	}
+	if p.Error.Status != "" {
+		return fmt.Sprintf("%s: %s", p.Error.Status, p.Error.Message)
+	}
+	return p.Error.Message
+}
@@ -0,0 +1,517 @@
+// Copyright 2017 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package securityrules
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+
+	"firebase.google.com/go/internal"
+
+	"golang.org/x/net/context"
+)
+
+var testSecurityRulesConfig = &internal.SecurityRulesConfig{
+	ProjectID: "test-project",
+	Bucket:    "test-bucket",
+	Opts: []option.ClientOption{
+		option.WithTokenSource(&internal.MockTokenSource{AccessToken: "test-token"}),
+	},
+	Version: "test-version",
+}
+
+const testRulesetResponse = `{
+  "name": "projects/test-project/rulesets/rs1",
+  "source": {"files": [{"name": "firestore.rules", "content": "service cloud.firestore {}"}]},
+  "createTime": "2018-01-01T10:00:00Z"
+}`
+
+var testRuleset = &Ruleset{
+	Name:       "projects/test-project/rulesets/rs1",
+	Files:      []*RulesFile{{Name: "firestore.rules", Content: "service cloud.firestore {}"}},
+	CreateTime: time.Date(2018, time.January, 1, 10, 0, 0, 0, time.UTC),
+}
+
+type request struct {
+	Method string
+	Path   string
+	Query  string
+	Body   string
+}
+
+type response struct {
+	Status int
+	Body   string
+}
+
+type mockServer struct {
+	Resps  []*response
+	Reqs   []*request
+	Srv    *httptest.Server
+	Client *Client
+}
+
+func newMockServer(t *testing.T, resps ...*response) *mockServer {
+	s := &mockServer{Resps: resps}
+	s.Srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Reqs = append(s.Reqs, &request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Body:   string(b),
+		})
+		if h := r.Header.Get("Authorization"); h != "Bearer test-token" {
+			t.Errorf("Authorization = %q; want = %q", h, "Bearer test-token")
+		}
+		if h := r.Header.Get("X-Client-Version"); h != "Go/Admin/test-version" {
+			t.Errorf("X-Client-Version = %q; want = %q", h, "Go/Admin/test-version")
+		}
+
+		if len(s.Reqs) > len(s.Resps) {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp := s.Resps[len(s.Reqs)-1]
+		w.Header().Set("Content-Type", "application/json")
+		if resp.Status != 0 {
+			w.WriteHeader(resp.Status)
+		}
+		w.Write([]byte(resp.Body))
+	}))
+
+	client, err := NewClient(context.Background(), testSecurityRulesConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.endpoint = s.Srv.URL + "/v1"
+	s.Client = client
+	return s
+}
+
+func (s *mockServer) Close() {
+	s.Srv.Close()
+}
+
+func (s *mockServer) checkRequests(t *testing.T, want []*request) {
+	if len(s.Reqs) != len(want) {
+		t.Fatalf("Requests = %d; want = %d", len(s.Reqs), len(want))
+	}
+	for i, r := range want {
+		if !reflect.DeepEqual(s.Reqs[i], r) {
+			t.Errorf("Request[%d] = %#v; want = %#v", i, s.Reqs[i], r)
+		}
+	}
+}
+
+func TestNoProjectID(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.SecurityRulesConfig{})
+	if client != nil || err == nil {
+		t.Errorf("NewClient() = (%v, %v); want = (nil, error)", client, err)
+	}
+}
+
+func TestGetFirestoreRuleset(t *testing.T) {
+	s := newMockServer(t,
+		&response{Body: `{"name": "projects/test-project/releases/cloud.firestore",
+			"rulesetName": "projects/test-project/rulesets/rs1"}`},
+		&response{Body: testRulesetResponse})
+	defer s.Close()
+
+	rs, err := s.Client.GetFirestoreRuleset(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rs, testRuleset) {
+		t.Errorf("GetFirestoreRuleset() = %v; want = %v", rs, testRuleset)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1/projects/test-project/releases/cloud.firestore", "", ""},
+		{http.MethodGet, "/v1/projects/test-project/rulesets/rs1", "", ""},
+	})
+}
+
+func TestGetStorageRuleset(t *testing.T) {
+	cases := []struct {
+		bucket string
+		want   string
+	}{
+		{"", "/v1/projects/test-project/releases/firebase.storage/test-bucket"},
+		{"other-bucket", "/v1/projects/test-project/releases/firebase.storage/other-bucket"},
+	}
+	for _, tc := range cases {
+		s := newMockServer(t,
+			&response{Body: `{"rulesetName": "projects/test-project/rulesets/rs1"}`},
+			&response{Body: testRulesetResponse})
+
+		rs, err := s.Client.GetStorageRuleset(context.Background(), tc.bucket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rs, testRuleset) {
+			t.Errorf("GetStorageRuleset(%q) = %v; want = %v", tc.bucket, rs, testRuleset)
+		}
+		if s.Reqs[0].Path != tc.want {
+			t.Errorf("GetStorageRuleset(%q) path = %q; want = %q", tc.bucket, s.Reqs[0].Path, tc.want)
+		}
+		s.Close()
+	}
+}
+
+func TestGetStorageRulesetNoBucket(t *testing.T) {
+	conf := *testSecurityRulesConfig
+	conf.Bucket = ""
+	client, err := NewClient(context.Background(), &conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := client.GetStorageRuleset(context.Background(), "")
+	if rs != nil || err == nil {
+		t.Errorf("GetStorageRuleset() = (%v, %v); want = (nil, error)", rs, err)
+	}
+}
+
+func TestGetRuleset(t *testing.T) {
+	for _, name := range []string{"rs1", "projects/test-project/rulesets/rs1"} {
+		s := newMockServer(t, &response{Body: testRulesetResponse})
+		rs, err := s.Client.GetRuleset(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rs, testRuleset) {
+			t.Errorf("GetRuleset(%q) = %v; want = %v", name, rs, testRuleset)
+		}
+		s.checkRequests(t, []*request{
+			{http.MethodGet, "/v1/projects/test-project/rulesets/rs1", "", ""},
+		})
+		s.Close()
+	}
+}
+
+func TestCreateRuleset(t *testing.T) {
+	s := newMockServer(t, &response{Body: testRulesetResponse})
+	defer s.Close()
+
+	rs, err := s.Client.CreateRuleset(context.Background(), testRuleset.Files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rs, testRuleset) {
+		t.Errorf("CreateRuleset() = %v; want = %v", rs, testRuleset)
+	}
+	s.checkRequests(t, []*request{
+		{
+			http.MethodPost,
+			"/v1/projects/test-project/rulesets",
+			"",
+			`{"source":{"files":[{"name":"firestore.rules","content":"service cloud.firestore {}"}]}}`,
+		},
+	})
+}
+
+func TestCreateRulesetInvalid(t *testing.T) {
+	client, err := NewClient(context.Background(), testSecurityRulesConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := [][]*RulesFile{
+		nil,
+		{nil},
+		{{Content: "no name"}},
+	}
+	for _, tc := range cases {
+		rs, err := client.CreateRuleset(context.Background(), tc...)
+		if rs != nil || err == nil {
+			t.Errorf("CreateRuleset(%v) = (%v, %v); want = (nil, error)", tc, rs, err)
+		}
+	}
+}
+
+func TestReadRulesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "securityrules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "storage.rules")
+	if err := ioutil.WriteFile(path, []byte("service firebase.storage {}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := ReadRulesFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &RulesFile{Name: "storage.rules", Content: "service firebase.storage {}"}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("ReadRulesFile() = %v; want = %v", f, want)
+	}
+
+	if f, err := ReadRulesFile(filepath.Join(dir, "missing.rules")); f != nil || err == nil {
+		t.Errorf("ReadRulesFile(missing) = (%v, %v); want = (nil, error)", f, err)
+	}
+}
+
+func TestReleaseFirestoreRuleset(t *testing.T) {
+	s := newMockServer(t, &response{Body: `{}`})
+	defer s.Close()
+
+	if err := s.Client.ReleaseFirestoreRuleset(context.Background(), "rs1"); err != nil {
+		t.Fatal(err)
+	}
+	s.checkRequests(t, []*request{
+		{
+			http.MethodPatch,
+			"/v1/projects/test-project/releases/cloud.firestore",
+			"",
+			`{"release":{"name":"projects/test-project/releases/cloud.firestore",` +
+				`"rulesetName":"projects/test-project/rulesets/rs1"}}`,
+		},
+	})
+}
+
+func TestReleaseStorageRulesetCreatesRelease(t *testing.T) {
+	s := newMockServer(t,
+		&response{Status: http.StatusNotFound, Body: `{"error": {"status": "NOT_FOUND", "message": "not found"}}`},
+		&response{Body: `{}`})
+	defer s.Close()
+
+	if err := s.Client.ReleaseStorageRuleset(context.Background(), "", "rs1"); err != nil {
+		t.Fatal(err)
+	}
+	release := `{"name":"projects/test-project/releases/firebase.storage/test-bucket",` +
+		`"rulesetName":"projects/test-project/rulesets/rs1"}`
+	s.checkRequests(t, []*request{
+		{
+			http.MethodPatch,
+			"/v1/projects/test-project/releases/firebase.storage/test-bucket",
+			"",
+			`{"release":` + release + `}`,
+		},
+		{http.MethodPost, "/v1/projects/test-project/releases", "", release},
+	})
+}
+
+func TestReleaseRulesetError(t *testing.T) {
+	s := newMockServer(t, &response{
+		Status: http.StatusBadRequest,
+		Body:   `{"error": {"status": "INVALID_ARGUMENT", "message": "invalid ruleset"}}`,
+	})
+	defer s.Close()
+
+	err := s.Client.ReleaseFirestoreRuleset(context.Background(), "rs1")
+	want := "http error status: 400; reason: INVALID_ARGUMENT: invalid ruleset"
+	if err == nil || err.Error() != want {
+		t.Errorf("ReleaseFirestoreRuleset() = %v; want = %v", err, want)
+	}
+	if err := s.Client.ReleaseFirestoreRuleset(context.Background(), ""); err == nil {
+		t.Errorf("ReleaseFirestoreRuleset('') = nil; want = error")
+	}
+}
+
+func TestDeployFirestoreRuleset(t *testing.T) {
+	s := newMockServer(t,
+		&response{Body: `{"name": "projects/test-project/releases/cloud.firestore",
+			"rulesetName": "projects/test-project/rulesets/rs0"}`},
+		&response{Body: testRulesetResponse},
+		&response{Body: `{}`},
+		&response{Body: `{}`})
+	defer s.Close()
+
+	ctx := context.Background()
+	d, err := s.Client.DeployFirestoreRuleset(ctx, testRuleset.Files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d.Ruleset, testRuleset) {
+		t.Errorf("Ruleset = %v; want = %v", d.Ruleset, testRuleset)
+	}
+	if d.PreviousRulesetName != "projects/test-project/rulesets/rs0" {
+		t.Errorf("PreviousRulesetName = %q; want = %q", d.PreviousRulesetName, "projects/test-project/rulesets/rs0")
+	}
+	if err := d.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	release := "/v1/projects/test-project/releases/cloud.firestore"
+	releaseBody := func(rs string) string {
+		return `{"release":{"name":"projects/test-project/releases/cloud.firestore",` +
+			`"rulesetName":"projects/test-project/rulesets/` + rs + `"}}`
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, release, "", ""},
+		{
+			http.MethodPost,
+			"/v1/projects/test-project/rulesets",
+			"",
+			`{"source":{"files":[{"name":"firestore.rules","content":"service cloud.firestore {}"}]}}`,
+		},
+		{http.MethodPatch, release, "", releaseBody("rs1")},
+		{http.MethodPatch, release, "", releaseBody("rs0")},
+	})
+}
+
+func TestDeployStorageRulesetRestoresOnFailure(t *testing.T) {
+	s := newMockServer(t,
+		&response{Body: `{"name": "projects/test-project/releases/firebase.storage/test-bucket",
+			"rulesetName": "projects/test-project/rulesets/rs0"}`},
+		&response{Body: testRulesetResponse},
+		&response{Status: http.StatusServiceUnavailable, Body: `{"error": {"status": "UNAVAILABLE", "message": "try again"}}`},
+		&response{Body: `{}`})
+	defer s.Close()
+
+	d, err := s.Client.DeployStorageRuleset(context.Background(), "", testRuleset.Files...)
+	want := "http error status: 503; reason: UNAVAILABLE: try again"
+	if d != nil || err == nil || err.Error() != want {
+		t.Fatalf("DeployStorageRuleset() = (%v, %v); want = (nil, %q)", d, err, want)
+	}
+	if len(s.Reqs) != 4 {
+		t.Fatalf("Requests = %d; want = 4", len(s.Reqs))
+	}
+	restore := s.Reqs[3]
+	wantBody := `{"release":{"name":"projects/test-project/releases/firebase.storage/test-bucket",` +
+		`"rulesetName":"projects/test-project/rulesets/rs0"}}`
+	if restore.Method != http.MethodPatch || restore.Body != wantBody {
+		t.Errorf("Request[3] = %s %s; want = PATCH %s", restore.Method, restore.Body, wantBody)
+	}
+}
+
+func TestDeployRulesetRestoreError(t *testing.T) {
+	s := newMockServer(t,
+		&response{Body: `{"name": "projects/test-project/releases/cloud.firestore",
+			"rulesetName": "projects/test-project/rulesets/rs0"}`},
+		&response{Body: testRulesetResponse},
+		&response{Status: http.StatusBadRequest, Body: `{"error": {"message": "invalid ruleset"}}`},
+		&response{Status: http.StatusInternalServerError, Body: `{"error": {"message": "internal error"}}`})
+	defer s.Close()
+
+	d, err := s.Client.DeployFirestoreRuleset(context.Background(), testRuleset.Files...)
+	if d != nil || err == nil {
+		t.Fatalf("DeployFirestoreRuleset() = (%v, %v); want = (nil, error)", d, err)
+	}
+	for _, msg := range []string{"invalid ruleset", "internal error"} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("DeployFirestoreRuleset() = %v; want = error containing %q", err, msg)
+		}
+	}
+}
+
+func TestDeployRulesetNoPreviousRelease(t *testing.T) {
+	s := newMockServer(t,
+		&response{Status: http.StatusNotFound, Body: `{"error": {"status": "NOT_FOUND", "message": "not found"}}`},
+		&response{Body: testRulesetResponse},
+		&response{Body: `{}`})
+	defer s.Close()
+
+	ctx := context.Background()
+	d, err := s.Client.DeployFirestoreRuleset(ctx, testRuleset.Files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.PreviousRulesetName != "" {
+		t.Errorf("PreviousRulesetName = %q; want = %q", d.PreviousRulesetName, "")
+	}
+	if err := d.Rollback(ctx); err == nil {
+		t.Errorf("Rollback() = nil; want = error")
+	}
+	if len(s.Reqs) != 3 {
+		t.Errorf("Requests = %d; want = 3", len(s.Reqs))
+	}
+}
+
+func TestDeployRulesetInvalid(t *testing.T) {
+	s := newMockServer(t, &response{Body: `{}`})
+	defer s.Close()
+
+	d, err := s.Client.DeployFirestoreRuleset(context.Background())
+	if d != nil || err == nil {
+		t.Errorf("DeployFirestoreRuleset() = (%v, %v); want = (nil, error)", d, err)
+	}
+	if len(s.Reqs) != 0 {
+		t.Errorf("Requests = %d; want = 0", len(s.Reqs))
+	}
+}
+
+func TestDeleteRuleset(t *testing.T) {
+	s := newMockServer(t, &response{Body: `{}`})
+	defer s.Close()
+
+	if err := s.Client.DeleteRuleset(context.Background(), "rs1"); err != nil {
+		t.Fatal(err)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodDelete, "/v1/projects/test-project/rulesets/rs1", "", ""},
+	})
+	if err := s.Client.DeleteRuleset(context.Background(), ""); err == nil {
+		t.Errorf("DeleteRuleset('') = nil; want = error")
+	}
+}
+
+func TestListRulesetMetadata(t *testing.T) {
+	s := newMockServer(t,
+		&response{Body: `{"rulesets": [
+			{"name": "projects/test-project/rulesets/rs2", "createTime": "2018-01-02T10:00:00Z"}
+		], "nextPageToken": "token"}`},
+		&response{Body: `{"rulesets": [
+			{"name": "projects/test-project/rulesets/rs1", "createTime": "2018-01-01T10:00:00Z"}
+		]}`})
+	defer s.Close()
+
+	it := s.Client.ListRulesetMetadata(context.Background())
+	var got []*RulesetMetadata
+	for {
+		rs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rs)
+	}
+
+	want := []*RulesetMetadata{
+		{
+			Name:       "projects/test-project/rulesets/rs2",
+			CreateTime: time.Date(2018, time.January, 2, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:       "projects/test-project/rulesets/rs1",
+			CreateTime: time.Date(2018, time.January, 1, 10, 0, 0, 0, time.UTC),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListRulesetMetadata() = %v; want = %v", got, want)
+	}
+	s.checkRequests(t, []*request{
+		{http.MethodGet, "/v1/projects/test-project/rulesets", "pageSize=100", ""},
+		{http.MethodGet, "/v1/projects/test-project/rulesets", "pageSize=100&pageToken=token", ""},
+	})
+}
@@ -16,16 +16,43 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 
 	"cloud.google.com/go/storage"
 	"firebase.google.com/go/internal"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
 )
 
+const downloadTokensKey = "firebaseStorageDownloadTokens"
+const downloadEndpoint = "https://firebasestorage.googleapis.com/v0"
+const emulatorHostEnvVar = "FIREBASE_STORAGE_EMULATOR_HOST"
+const maxTokenUpdateAttempts = 3
+
+// defaultBucketFormats lists the name formats of the default bucket of a project, in the order
+// they are tried when no bucket name is configured. Projects created before October 2024 have an
+// appspot.com default bucket, and projects created later have a firebasestorage.app one.
+var defaultBucketFormats = []string{"%s.appspot.com", "%s.firebasestorage.app"}
+
 // Client is the interface for the Firebase Storage service.
 type Client struct {
-	client *storage.Client
+	client           *storage.Client
+	projectID        string
+	snr              internal.Signer
+	emulator         bool
+	downloadEndpoint string // To enable testing against arbitrary endpoints.
+
+	mu     sync.Mutex
 	bucket string
 }
 
@@ -33,20 +60,118 @@ type Client struct {
 //
 // This function can only be invoked from within the SDK. Client applications should access the
 // the Storage service through firebase.App.
+//
+// If the FIREBASE_STORAGE_EMULATOR_HOST environment variable is set (e.g. to "localhost:9199"),
+// the client connects to the Firebase Storage emulator running at that address, without
+// authentication, and download URLs point to the emulator.
 func NewClient(ctx context.Context, c *internal.StorageConfig) (*Client, error) {
-	client, err := storage.NewClient(ctx, c.Opts...)
+	opts := c.Opts
+	endpoint := downloadEndpoint
+	emulatorHost := os.Getenv(emulatorHostEnvVar)
+	if emulatorHost != "" {
+		opts = append(opts[:len(opts):len(opts)],
+			option.WithEndpoint("http://"+emulatorHost+"/storage/v1/"),
+			option.WithoutAuthentication())
+		endpoint = "http://" + emulatorHost + "/v0"
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	hc, _, err := transport.NewHTTPClient(ctx, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &Client{client: client, bucket: c.Bucket}, nil
+	snr, err := internal.NewSigner(ctx, c.Creds, c.ServiceAccountID, hc)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		client:           client,
+		projectID:        c.ProjectID,
+		snr:              snr,
+		emulator:         emulatorHost != "",
+		downloadEndpoint: endpoint,
+		bucket:           c.Bucket,
+	}, nil
 }
 
 // DefaultBucket returns a handle to the default Cloud Storage bucket.
 //
-// To use this method, the default bucket name must be specified via firebase.Config when
-// initializing the App.
+// The default bucket is the one specified via firebase.Config when initializing the App. If none
+// is specified, DefaultBucket looks for the default bucket of the project, which is named either
+// <projectId>.appspot.com or <projectId>.firebasestorage.app, and verifies that it exists. When
+// connected to the emulator, <projectId>.appspot.com is used without verification. The lookup
+// cannot be cancelled; use DefaultBucketContext to bind it to a context.
 func (c *Client) DefaultBucket() (*storage.BucketHandle, error) {
-	return c.Bucket(c.bucket)
+	return c.DefaultBucketContext(context.Background())
+}
+
+// DefaultBucketContext is like DefaultBucket, but binds the lookup of the default bucket, if
+// one is needed, to ctx.
+func (c *Client) DefaultBucketContext(ctx context.Context) (*storage.BucketHandle, error) {
+	name, err := c.defaultBucketName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Bucket(name)
+}
+
+// defaultBucketName returns the name of the default bucket, discovering it if it is not
+// configured. A discovered name is cached for subsequent calls. The lock is not held during the
+// lookup, so that a slow lookup does not block callers whose context has expired; concurrent
+// first calls may therefore look up the bucket more than once.
+func (c *Client) defaultBucketName(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	bucket := c.bucket
+	c.mu.Unlock()
+	if bucket != "" {
+		return bucket, nil
+	}
+	if c.projectID == "" {
+		return "", errors.New("bucket name not specified, and project id not available to " +
+			"look up the default bucket")
+	}
+
+	bucket, err := c.lookupDefaultBucket(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.bucket = bucket
+	c.mu.Unlock()
+	return bucket, nil
+}
+
+func (c *Client) lookupDefaultBucket(ctx context.Context) (string, error) {
+	if c.emulator {
+		return fmt.Sprintf(defaultBucketFormats[0], c.projectID), nil
+	}
+
+	var names []string
+	for _, f := range defaultBucketFormats {
+		name := fmt.Sprintf(f, c.projectID)
+		_, err := c.client.Bucket(name).Attrs(ctx)
+		if err == storage.ErrBucketNotExist {
+			names = append(names, name)
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("failed to look up default bucket %q: %v", name, err)
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("bucket name not specified, and no default bucket found (tried %s)",
+		strings.Join(names, ", "))
+}
+
+// resolveBucket returns the given bucket name, or the default bucket name if it is empty.
+func (c *Client) resolveBucket(ctx context.Context, bucket string) (string, error) {
+	if bucket != "" {
+		return bucket, nil
+	}
+	return c.defaultBucketName(ctx)
 }
 
 // Bucket returns a handle to the specified Cloud Storage bucket.
@@ -56,3 +181,182 @@ func (c *Client) Bucket(name string) (*storage.BucketHandle, error) {
 	}
 	return c.client.Bucket(name), nil
 }
+
+// SignedURL returns a V4 signed URL for the specified object.
+//
+// If bucket is empty, the default bucket is used. opts must specify at least the expiry time of
+// the URL. Unless opts specifies a GoogleAccessID and a PrivateKey or a SignBytes function, the
+// URL is signed on behalf of the service account of the App: locally with its private key when
+// the credentials of the App contain one, with appengine.SignBytes on App Engine, or remotely by
+// the IAM service when a service account ID is specified in firebase.Config. Looking up the
+// default bucket and signing through the IAM service are bound to ctx.
+func (c *Client) SignedURL(ctx context.Context, bucket, object string, opts *storage.SignedURLOptions) (string, error) {
+	bucket, err := c.resolveBucket(ctx, bucket)
+	if err != nil {
+		return "", err
+	}
+	if object == "" {
+		return "", errors.New("object name not specified")
+	}
+	if opts == nil {
+		return "", errors.New("signed URL options must not be nil")
+	}
+
+	o := *opts
+	if o.Scheme == storage.SigningSchemeDefault {
+		o.Scheme = storage.SigningSchemeV4
+	}
+	if o.GoogleAccessID == "" {
+		email, err := c.snr.Email()
+		if err != nil {
+			return "", err
+		}
+		o.GoogleAccessID = email
+	}
+	if o.PrivateKey == nil && o.SignBytes == nil {
+		o.SignBytes = func(b []byte) ([]byte, error) {
+			return c.snr.Sign(ctx, b)
+		}
+	}
+	return storage.SignedURL(bucket, object, &o)
+}
+
+// DownloadURL returns a Firebase Storage download URL for the specified object.
+//
+// The URL has the same format as the download URLs produced by the Firebase client SDKs, and
+// grants read access to the object to anyone who has it. If the object already has download
+// tokens, the URL contains the first of them. Otherwise a new download token is created and
+// stored in the metadata of the object. If bucket is empty, the default bucket is used.
+func (c *Client) DownloadURL(ctx context.Context, bucket, object string) (string, error) {
+	return c.updateDownloadTokens(ctx, bucket, object, func(tokens []string) ([]string, error) {
+		if len(tokens) > 0 {
+			return tokens, nil
+		}
+		token, err := newDownloadToken()
+		if err != nil {
+			return nil, err
+		}
+		return []string{token}, nil
+	})
+}
+
+// RotateDownloadToken replaces all the download tokens of the specified object with a new one,
+// and returns the download URL that contains the new token.
+//
+// Download URLs previously handed out for the object stop working. If bucket is empty, the
+// default bucket is used.
+func (c *Client) RotateDownloadToken(ctx context.Context, bucket, object string) (string, error) {
+	return c.updateDownloadTokens(ctx, bucket, object, func(tokens []string) ([]string, error) {
+		token, err := newDownloadToken()
+		if err != nil {
+			return nil, err
+		}
+		return []string{token}, nil
+	})
+}
+
+// RevokeDownloadTokens deletes all the download tokens of the specified object.
+//
+// Download URLs previously handed out for the object stop working. A new download URL can be
+// obtained by calling DownloadURL. If bucket is empty, the default bucket is used.
+func (c *Client) RevokeDownloadTokens(ctx context.Context, bucket, object string) error {
+	_, err := c.updateDownloadTokens(ctx, bucket, object, func(tokens []string) ([]string, error) {
+		return nil, nil
+	})
+	return err
+}
+
+// updateDownloadTokens applies fn to the download tokens of an object, and stores the result in
+// the metadata of the object if it differs from the current tokens. The update is conditional
+// on the metageneration of the object, so that concurrent updates are not lost; it is retried
+// when a concurrent update is detected. Returns the download URL for the first resulting token.
+func (c *Client) updateDownloadTokens(
+	ctx context.Context, bucket, object string, fn func([]string) ([]string, error)) (string, error) {
+
+	bucket, err := c.resolveBucket(ctx, bucket)
+	if err != nil {
+		return "", err
+	}
+	if object == "" {
+		return "", errors.New("object name not specified")
+	}
+
+	o := c.client.Bucket(bucket).Object(object)
+	for i := 0; ; i++ {
+		attrs, err := o.Attrs(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		current := parseDownloadTokens(attrs.Metadata[downloadTokensKey])
+		tokens, err := fn(current)
+		if err != nil {
+			return "", err
+		}
+		if strings.Join(tokens, ",") != strings.Join(current, ",") {
+			update := storage.ObjectAttrsToUpdate{
+				Metadata: map[string]string{downloadTokensKey: strings.Join(tokens, ",")},
+			}
+			cond := storage.Conditions{MetagenerationMatch: attrs.Metageneration}
+			_, err = o.If(cond).Update(ctx, update)
+			if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusPreconditionFailed &&
+				i < maxTokenUpdateAttempts-1 {
+				continue
+			} else if err != nil {
+				return "", err
+			}
+		}
+
+		if len(tokens) == 0 {
+			return "", nil
+		}
+		return downloadURL(c.downloadEndpoint, bucket, object, tokens[0]), nil
+	}
+}
+
+func parseDownloadTokens(s string) []string {
+	var tokens []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+func downloadURL(endpoint, bucket, object, token string) string {
+	return fmt.Sprintf("%s/b/%s/o/%s?alt=media&token=%s",
+		endpoint, bucket, escapeObjectName(object), url.QueryEscape(token))
+}
+
+// escapeObjectName escapes an object name the way the client SDKs do with the JavaScript
+// encodeURIComponent function, so that download URLs match the ones they produce. Unlike
+// url.PathEscape, it escapes all the reserved characters, including slashes.
+func escapeObjectName(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("-_.!~*'()", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+// newDownloadToken returns a random (version 4) UUID, which is the format of the download tokens
+// created by Firebase Storage.
+func newDownloadToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -15,9 +15,24 @@
 package storage
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
 
 	"firebase.google.com/go/internal"
 	"golang.org/x/net/context"
@@ -39,6 +54,42 @@ func TestNewClientError(t *testing.T) {
 	}
 }
 
+// newTestClient returns a Client connected to a mock Cloud Storage JSON API served by handler.
+func newTestClient(t *testing.T, conf *internal.StorageConfig, handler http.HandlerFunc) (*Client, *httptest.Server) {
+	srv := httptest.NewServer(handler)
+	conf.Opts = []option.ClientOption{
+		option.WithEndpoint(srv.URL + "/storage/v1/"),
+		option.WithoutAuthentication(),
+	}
+	client, err := NewClient(context.Background(), conf)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return client, srv
+}
+
+// bucketHandler serves bucket metadata requests for the given buckets, and records the names of
+// the buckets requested.
+func bucketHandler(requested *[]string, buckets ...string) http.HandlerFunc {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/")
+		mu.Lock()
+		*requested = append(*requested, name)
+		mu.Unlock()
+		for _, b := range buckets {
+			if b == name {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "` + name + `"}`))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"code": 404, "message": "Not Found"}}`))
+	}
+}
+
 func TestNoBucketName(t *testing.T) {
 	client, err := NewClient(context.Background(), &internal.StorageConfig{
 		Opts: opts,
@@ -51,6 +102,120 @@ func TestNoBucketName(t *testing.T) {
 	}
 }
 
+func TestNoDefaultBucket(t *testing.T) {
+	var requested []string
+	client, srv := newTestClient(t, &internal.StorageConfig{ProjectID: "mock-project-id"},
+		bucketHandler(&requested))
+	defer srv.Close()
+
+	bucket, err := client.DefaultBucket()
+	if bucket != nil || err == nil {
+		t.Fatalf("DefaultBucket() = (%v, %v); want = (nil, error)", bucket, err)
+	}
+	want := []string{"mock-project-id.appspot.com", "mock-project-id.firebasestorage.app"}
+	for _, name := range want {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("DefaultBucket() = %v; want error mentioning %q", err, name)
+		}
+	}
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("DefaultBucket() requested = %v; want = %v", requested, want)
+	}
+}
+
+func TestDiscoverDefaultBucket(t *testing.T) {
+	cases := []struct {
+		buckets []string
+		want    string
+		lookups int
+	}{
+		{[]string{"mock-project-id.appspot.com"}, "mock-project-id.appspot.com", 1},
+		{[]string{"mock-project-id.firebasestorage.app"}, "mock-project-id.firebasestorage.app", 2},
+	}
+	for _, tc := range cases {
+		var requested []string
+		client, srv := newTestClient(t, &internal.StorageConfig{ProjectID: "mock-project-id"},
+			bucketHandler(&requested, tc.buckets...))
+
+		for i := 0; i < 2; i++ {
+			name, err := client.defaultBucketName(context.Background())
+			if name != tc.want || err != nil {
+				t.Errorf("defaultBucketName() = (%q, %v); want = (%q, nil)", name, err, tc.want)
+			}
+		}
+		// The discovered bucket is cached.
+		if len(requested) != tc.lookups {
+			t.Errorf("defaultBucketName() requested = %v; want = %d lookups", requested, tc.lookups)
+		}
+		if bucket, err := client.DefaultBucket(); bucket == nil || err != nil {
+			t.Errorf("DefaultBucket() = (%v, %v); want = (bucket, nil)", bucket, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestDefaultBucketLookupError(t *testing.T) {
+	var calls int
+	client, srv := newTestClient(t, &internal.StorageConfig{ProjectID: "mock-project-id"},
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": {"code": 403, "message": "Forbidden"}}`))
+		})
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		bucket, err := client.DefaultBucket()
+		if bucket != nil || err == nil || !strings.Contains(err.Error(), "mock-project-id.appspot.com") {
+			t.Errorf("DefaultBucket() = (%v, %v); want = (nil, lookup error)", bucket, err)
+		}
+	}
+	// Failed lookups are not cached.
+	if calls != 2 {
+		t.Errorf("DefaultBucket() calls = %d; want = 2", calls)
+	}
+}
+
+func TestDefaultBucketContextCancel(t *testing.T) {
+	block := make(chan struct{})
+	client, srv := newTestClient(t, &internal.StorageConfig{ProjectID: "mock-project-id"},
+		func(w http.ResponseWriter, r *http.Request) {
+			<-block
+		})
+	defer srv.Close()
+	defer close(block)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if bucket, err := client.DefaultBucketContext(ctx); bucket != nil || err == nil {
+		t.Errorf("DefaultBucketContext() = (%v, %v); want = (nil, error)", bucket, err)
+	}
+}
+
+func TestEmulator(t *testing.T) {
+	os.Setenv(emulatorHostEnvVar, "localhost:9199")
+	defer os.Unsetenv(emulatorHostEnvVar)
+
+	client, err := NewClient(context.Background(), &internal.StorageConfig{
+		ProjectID: "mock-project-id",
+		Opts:      opts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket, err := client.DefaultBucket(); bucket == nil || err != nil {
+		t.Errorf("DefaultBucket() = (%v, %v); want = (bucket, nil)", bucket, err)
+	}
+	if name, err := client.defaultBucketName(context.Background()); name != "mock-project-id.appspot.com" || err != nil {
+		t.Errorf("defaultBucketName() = (%q, %v); want = (%q, nil)", name, err, "mock-project-id.appspot.com")
+	}
+
+	want := "http://localhost:9199/v0/b/mock-project-id.appspot.com/o/file.txt?alt=media&token=token1"
+	if got := downloadURL(client.downloadEndpoint, "mock-project-id.appspot.com", "file.txt", "token1"); got != want {
+		t.Errorf("downloadURL() = %q; want = %q", got, want)
+	}
+}
+
 func TestEmptyBucketName(t *testing.T) {
 	client, err := NewClient(context.Background(), &internal.StorageConfig{
 		Opts: opts,
@@ -89,3 +254,362 @@ func TestBucket(t *testing.T) {
 		t.Errorf("Bucket() = (%v, %v); want: (bucket, nil)", bucket, err)
 	}
 }
+
+func TestSignedURL(t *testing.T) {
+	creds, err := transport.Creds(context.Background(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(context.Background(), &internal.StorageConfig{
+		Bucket: "bucket.name",
+		Creds:  creds,
+		Opts:   opts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bucket := range []string{"", "other.bucket"} {
+		want := "bucket.name"
+		if bucket != "" {
+			want = bucket
+		}
+		url, err := client.SignedURL(context.Background(), bucket, "path/to/file.txt", &storage.SignedURLOptions{
+			Method:  "GET",
+			Expires: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(url, "https://storage.googleapis.com/"+want+"/") {
+			t.Errorf("SignedURL(%q) = %q; want prefix = %q", bucket, url, want)
+		}
+		if !strings.Contains(url, "X-Goog-Algorithm=GOOG4-RSA-SHA256") {
+			t.Errorf("SignedURL(%q) = %q; want V4 signed URL", bucket, url)
+		}
+	}
+}
+
+func TestSignedURLSignBytes(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.StorageConfig{
+		Bucket: "bucket.name",
+		Opts:   opts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signed bool
+	url, err := client.SignedURL(context.Background(), "", "file.txt", &storage.SignedURLOptions{
+		GoogleAccessID: "test@example.com",
+		Method:         "GET",
+		Expires:        time.Now().Add(time.Hour),
+		SignBytes: func(b []byte) ([]byte, error) {
+			signed = true
+			return []byte("signature"), nil
+		},
+	})
+	if url == "" || err != nil {
+		t.Errorf("SignedURL() = (%q, %v); want = (url, nil)", url, err)
+	}
+	if !signed {
+		t.Errorf("SignBytes not called")
+	}
+}
+
+func TestSignedURLError(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.StorageConfig{
+		Opts: opts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := &storage.SignedURLOptions{Method: "GET", Expires: time.Now().Add(time.Hour)}
+	cases := []struct {
+		name   string
+		bucket string
+		object string
+		opts   *storage.SignedURLOptions
+	}{
+		{"NoBucket", "", "file.txt", valid},
+		{"NoObject", "bucket.name", "", valid},
+		{"NilOptions", "bucket.name", "file.txt", nil},
+		{"NoCredentials", "bucket.name", "file.txt", valid},
+	}
+	for _, tc := range cases {
+		if url, err := client.SignedURL(context.Background(), tc.bucket, tc.object, tc.opts); url != "" || err == nil {
+			t.Errorf("SignedURL(%s) = (%q, %v); want = (\"\", error)", tc.name, url, err)
+		}
+	}
+}
+
+func TestDownloadURLFormat(t *testing.T) {
+	cases := []struct {
+		bucket string
+		object string
+		token  string
+		want   string
+	}{
+		{"bucket.name", "file.txt", "token1",
+			"https://firebasestorage.googleapis.com/v0/b/bucket.name/o/file.txt?alt=media&token=token1"},
+		{"bucket.name", "path/to/my file.png", "token1",
+			"https://firebasestorage.googleapis.com/v0/b/bucket.name/o/path%2Fto%2Fmy%20file.png?alt=media&token=token1"},
+		{"bucket.name", "a&b=c+d:e@f$g,h;i(1)!~*'.png", "token1",
+			"https://firebasestorage.googleapis.com/v0/b/bucket.name/o/a%26b%3Dc%2Bd%3Ae%40f%24g%2Ch%3Bi(1)!~*'.png?alt=media&token=token1"},
+		{"bucket.name", "résumé.pdf", "token1",
+			"https://firebasestorage.googleapis.com/v0/b/bucket.name/o/r%C3%A9sum%C3%A9.pdf?alt=media&token=token1"},
+	}
+	for _, tc := range cases {
+		if got := downloadURL(downloadEndpoint, tc.bucket, tc.object, tc.token); got != tc.want {
+			t.Errorf("downloadURL(%q) = %q; want = %q", tc.object, got, tc.want)
+		}
+	}
+}
+
+func TestParseDownloadTokens(t *testing.T) {
+	cases := []struct {
+		metadata string
+		want     []string
+	}{
+		{"", nil},
+		{"token1", []string{"token1"}},
+		{"token1,token2", []string{"token1", "token2"}},
+		{" token1, ,token2 ", []string{"token1", "token2"}},
+	}
+	for _, tc := range cases {
+		if got := parseDownloadTokens(tc.metadata); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseDownloadTokens(%q) = %v; want = %v", tc.metadata, got, tc.want)
+		}
+	}
+}
+
+func TestNewDownloadToken(t *testing.T) {
+	pattern := regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$")
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		token, err := newDownloadToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pattern.MatchString(token) {
+			t.Errorf("newDownloadToken() = %q; want UUID", token)
+		}
+		if seen[token] {
+			t.Errorf("newDownloadToken() = %q; want unique token", token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestDownloadURLError(t *testing.T) {
+	client, err := NewClient(context.Background(), &internal.StorageConfig{
+		Opts: opts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if url, err := client.DownloadURL(ctx, "", "file.txt"); url != "" || err == nil {
+		t.Errorf("DownloadURL(NoBucket) = (%q, %v); want = (\"\", error)", url, err)
+	}
+	if url, err := client.DownloadURL(ctx, "bucket.name", ""); url != "" || err == nil {
+		t.Errorf("DownloadURL(NoObject) = (%q, %v); want = (\"\", error)", url, err)
+	}
+	if url, err := client.RotateDownloadToken(ctx, "", "file.txt"); url != "" || err == nil {
+		t.Errorf("RotateDownloadToken(NoBucket) = (%q, %v); want = (\"\", error)", url, err)
+	}
+	if err := client.RevokeDownloadTokens(ctx, "bucket.name", ""); err == nil {
+		t.Errorf("RevokeDownloadTokens(NoObject) = nil; want = error")
+	}
+}
+
+// objectServer is a mock Cloud Storage JSON API that serves the metadata of a single object, and
+// supports conditional metadata updates.
+type objectServer struct {
+	mu             sync.Mutex
+	metadata       map[string]string
+	metageneration int64
+	missing        bool
+	// conflicts is the number of upcoming updates that fail as if the object was concurrently
+	// updated.
+	conflicts int
+	patches   []url.Values
+}
+
+func (o *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.missing {
+		o.writeError(w, http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		o.patches = append(o.patches, r.URL.Query())
+		if r.URL.Query().Get("ifMetagenerationMatch") != strconv.FormatInt(o.metageneration, 10) {
+			o.writeError(w, http.StatusPreconditionFailed)
+			return
+		}
+		if o.conflicts > 0 {
+			o.conflicts--
+			o.metageneration++
+			o.writeError(w, http.StatusPreconditionFailed)
+			return
+		}
+		var req struct {
+			Metadata map[string]*string `json:"metadata"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			o.writeError(w, http.StatusBadRequest)
+			return
+		}
+		if o.metadata == nil {
+			o.metadata = make(map[string]string)
+		}
+		for k, v := range req.Metadata {
+			if v == nil {
+				delete(o.metadata, k)
+			} else {
+				o.metadata[k] = *v
+			}
+		}
+		o.metageneration++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bucket":         "bucket.name",
+		"name":           "file.txt",
+		"metadata":       o.metadata,
+		"metageneration": strconv.FormatInt(o.metageneration, 10),
+	})
+}
+
+func (o *objectServer) writeError(w http.ResponseWriter, code int) {
+	w.WriteHeader(code)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": %q}}`, code, http.StatusText(code))
+}
+
+func newObjectServer(t *testing.T, o *objectServer) (*Client, *httptest.Server) {
+	if o.metageneration == 0 {
+		o.metageneration = 1
+	}
+	return newTestClient(t, &internal.StorageConfig{Bucket: "bucket.name"}, o.ServeHTTP)
+}
+
+const testDownloadURLPrefix = "https://firebasestorage.googleapis.com/v0/b/bucket.name/o/file.txt?alt=media&token="
+
+func TestDownloadURLExistingToken(t *testing.T) {
+	o := &objectServer{metadata: map[string]string{downloadTokensKey: "token1,token2"}}
+	client, srv := newObjectServer(t, o)
+	defer srv.Close()
+
+	url, err := client.DownloadURL(context.Background(), "", "file.txt")
+	if want := testDownloadURLPrefix + "token1"; url != want || err != nil {
+		t.Errorf("DownloadURL() = (%q, %v); want = (%q, nil)", url, err, want)
+	}
+	if len(o.patches) != 0 {
+		t.Errorf("DownloadURL() updates = %d; want = 0", len(o.patches))
+	}
+}
+
+func TestDownloadURLNewToken(t *testing.T) {
+	o := &objectServer{metadata: map[string]string{"other": "value"}, metageneration: 5}
+	client, srv := newObjectServer(t, o)
+	defer srv.Close()
+
+	url, err := client.DownloadURL(context.Background(), "bucket.name", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := o.metadata[downloadTokensKey]
+	if token == "" || url != testDownloadURLPrefix+token {
+		t.Errorf("DownloadURL() = %q; want = %q", url, testDownloadURLPrefix+token)
+	}
+	if o.metadata["other"] != "value" {
+		t.Errorf("DownloadURL() metadata = %v; want other metadata preserved", o.metadata)
+	}
+	if len(o.patches) != 1 || o.patches[0].Get("ifMetagenerationMatch") != "5" {
+		t.Errorf("DownloadURL() updates = %v; want = [ifMetagenerationMatch=5]", o.patches)
+	}
+}
+
+func TestDownloadURLConcurrentUpdate(t *testing.T) {
+	o := &objectServer{conflicts: 1}
+	client, srv := newObjectServer(t, o)
+	defer srv.Close()
+
+	url, err := client.DownloadURL(context.Background(), "", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := o.metadata[downloadTokensKey]; token == "" || url != testDownloadURLPrefix+token {
+		t.Errorf("DownloadURL() = %q; want = %q", url, testDownloadURLPrefix+token)
+	}
+	// The update is retried with the metageneration read after the conflict.
+	if len(o.patches) != 2 || o.patches[0].Get("ifMetagenerationMatch") != "1" ||
+		o.patches[1].Get("ifMetagenerationMatch") != "2" {
+		t.Errorf("DownloadURL() updates = %v; want = 2 conditional updates", o.patches)
+	}
+}
+
+func TestDownloadURLTooManyConcurrentUpdates(t *testing.T) {
+	o := &objectServer{conflicts: maxTokenUpdateAttempts}
+	client, srv := newObjectServer(t, o)
+	defer srv.Close()
+
+	url, err := client.DownloadURL(context.Background(), "", "file.txt")
+	if e, ok := err.(*googleapi.Error); url != "" || !ok || e.Code != http.StatusPreconditionFailed {
+		t.Errorf("DownloadURL() = (%q, %v); want = (\"\", 412 error)", url, err)
+	}
+	if len(o.patches) != maxTokenUpdateAttempts {
+		t.Errorf("DownloadURL() updates = %d; want = %d", len(o.patches), maxTokenUpdateAttempts)
+	}
+}
+
+func TestRotateDownloadToken(t *testing.T) {
+	o := &objectServer{metadata: map[string]string{downloadTokensKey: "token1,token2"}}
+	client, srv := newObjectServer(t, o)
+	defer srv.Close()
+
+	url, err := client.RotateDownloadToken(context.Background(), "", "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := o.metadata[downloadTokensKey]
+	if token == "" || strings.Contains(token, ",") || strings.Contains(token, "token") {
+		t.Errorf("RotateDownloadToken() tokens = %q; want a single new token", token)
+	}
+	if url != testDownloadURLPrefix+token {
+		t.Errorf("RotateDownloadToken() = %q; want = %q", url, testDownloadURLPrefix+token)
+	}
+}
+
+func TestRevokeDownloadTokens(t *testing.T) {
+	o := &objectServer{metadata: map[string]string{downloadTokensKey: "token1", "other": "value"}}
+	client, srv := newObjectServer(t, o)
+	defer srv.Close()
+
+	if err := client.RevokeDownloadTokens(context.Background(), "", "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"other": "value"}; !reflect.DeepEqual(o.metadata, want) {
+		t.Errorf("RevokeDownloadTokens() metadata = %v; want = %v", o.metadata, want)
+	}
+
+	// Revoking the tokens of an object without tokens does not update it.
+	if err := client.RevokeDownloadTokens(context.Background(), "", "file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.patches) != 1 {
+		t.Errorf("RevokeDownloadTokens() updates = %d; want = 1", len(o.patches))
+	}
+}
+
+func TestDownloadURLObjectNotFound(t *testing.T) {
+	client, srv := newObjectServer(t, &objectServer{missing: true})
+	defer srv.Close()
+
+	if url, err := client.DownloadURL(context.Background(), "", "file.txt"); url != "" || err != storage.ErrObjectNotExist {
+		t.Errorf("DownloadURL() = (%q, %v); want = (\"\", %v)", url, err, storage.ErrObjectNotExist)
+	}
+}